@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// getGroups is getting groups.
+// @Summary get groups
+// @Description get groups
+// @ID groups#get
+// @Accept  json
+// @Produce  json
+// @Param page query int false "page" minimum(1)
+// @Param per_page query int false "per_page" minimum(1)
+// @Success 200 {array} waitingroom.Group
+// @Failure 500 {object} api.HTTPError
+// @Router /groups [get]
+// @Tags groups
+func (h *groupHandler) getGroups(c echo.Context) error {
+	page, perPage, err := paginate(c)
+	if err != nil {
+		slog.Error("pagenate error", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, total, err := h.groupModel.GetGroups(c.Request().Context(), perPage, page)
+	if err != nil {
+		slog.Error("cant get groups", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("X-Pagination-Total-Pages", strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, r)
+}
+
+// updateGroupByName is update group.
+// @Summary update group
+// @Description update group
+// @ID groups#put
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Group Name"
+// @Param group body waitingroom.Group true "Group Object"
+// @Success 200 "OK"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /groups/{name} [put]
+// @Tags groups
+func (h *groupHandler) updateGroupByName(c echo.Context) error {
+	m := &waitingroom.Group{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	m.Name = c.Param("name")
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.groupModel.SaveGroup(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// deleteGroupByName is delete group.
+// @Summary delete group
+// @Description delete group
+// @ID groups#delete
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Group Name"
+// @Success 204 "No Content"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /groups/{name} [delete]
+// @Tags groups
+func (h *groupHandler) deleteGroupByName(c echo.Context) error {
+	if err := h.groupModel.DeleteGroup(c.Request().Context(), c.Param("name")); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createGroup is create group.
+// @Summary create group
+// @Description create group
+// @ID groups#post
+// @Accept  json
+// @Produce  json
+// @Param group body waitingroom.Group true "Group Object"
+// @Success 201 "Created"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /groups [post]
+// @Tags groups
+func (h *groupHandler) createGroup(c echo.Context) error {
+	m := &waitingroom.Group{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.groupModel.SaveGroup(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusCreated, nil)
+}
+
+type groupHandler struct {
+	groupModel *waitingroom.GroupModel
+}
+
+func NewGroupHandler(redisC *redis.Client, config *waitingroom.Config) *groupHandler {
+	return &groupHandler{
+		groupModel: waitingroom.NewGroupModel(redisC, config),
+	}
+}
+
+func (h *groupHandler) SetConfig(config *waitingroom.Config) {
+	h.groupModel.SetConfig(config)
+}
+
+func (h *groupHandler) WatchInvalidations(ctx context.Context) error {
+	return h.groupModel.WatchInvalidations(ctx)
+}
+
+// 設定の再読み込みとキャッシュの破棄を受け取れるよう、ハンドラを返す
+func VironGroupEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config) *groupHandler {
+	h := NewGroupHandler(redisC, config)
+	g.GET("/groups", h.getGroups)
+	g.PUT("/groups/:name", h.updateGroupByName)
+	g.DELETE("/groups/:name", h.deleteGroupByName)
+	g.POST("/groups", h.createGroup)
+	return h
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+)
+
+// Redisの疎通確認を待つ時間
+const healthRedisTimeout = time.Second
+
+// 判定周期のこの倍数より前に判定していなければ、ワーカーが止まっているとみなす
+const workerStaleIntervals = 3
+
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusDegraded     = "degraded" // Redisに接続できないが、受付不可にするまでの猶予中
+	HealthStatusUnavailable  = "unavailable"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+type HealthRedis struct {
+	OK           bool       `json:"ok"`
+	LatencyMs    float64    `json:"latency_ms"`
+	Error        string     `json:"error,omitempty"`
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+}
+
+type HealthWorker struct {
+	waitingroom.WorkerStatus
+	Stale bool `json:"stale"`
+}
+
+type HealthResult struct {
+	Status        string       `json:"status"`
+	Redis         HealthRedis  `json:"redis"`
+	Worker        HealthWorker `json:"worker"`
+	Leader        bool         `json:"leader"` // 直近の判定で許可番号を進めた待合室があるか
+	ConfigVersion int64        `json:"config_version"`
+}
+
+// ロードバランサーやKubernetesに受付可否を返す
+type HealthHandler struct {
+	redisClient    *redis.Client
+	accessCtrl     *waitingroom.AccessController
+	settingVersion func() int64
+
+	ready atomic.Bool
+
+	mu           sync.Mutex
+	failingSince time.Time
+}
+
+// 設定はAccessControllerに反映されたものを使う
+func NewHealthHandler(rc *redis.Client, ac *waitingroom.AccessController, settingVersion func() int64) *HealthHandler {
+	return &HealthHandler{
+		redisClient:    rc,
+		accessCtrl:     ac,
+		settingVersion: settingVersion,
+	}
+}
+
+// 停止を始めたらfalseにし、新しいリクエストを振り分けないようにする
+func (h *HealthHandler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// プロセスが応答できれば200を返す
+func (h *HealthHandler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": HealthStatusOK})
+}
+
+// Redisに接続できない状態がReadinessRedisFailureSecを超えて続くか、停止中なら503を返す
+func (h *HealthHandler) Readyz(c echo.Context) error {
+	r := h.check(c.Request().Context())
+	if r.Status == HealthStatusOK || r.Status == HealthStatusDegraded {
+		return c.JSON(http.StatusOK, r)
+	}
+	return c.JSON(http.StatusServiceUnavailable, r)
+}
+
+func (h *HealthHandler) check(ctx context.Context) *HealthResult {
+	ctx, cancel := context.WithTimeout(ctx, healthRedisTimeout)
+	defer cancel()
+	start := time.Now()
+	err := h.redisClient.Ping(ctx).Err()
+	latency := time.Since(start)
+
+	config := h.accessCtrl.Config()
+	h.mu.Lock()
+	now := time.Now()
+	if err == nil {
+		h.failingSince = time.Time{}
+	} else if h.failingSince.IsZero() {
+		h.failingSince = now
+	}
+	failingSince := h.failingSince
+	h.mu.Unlock()
+
+	r := &HealthResult{
+		Status: HealthStatusOK,
+		Redis: HealthRedis{
+			OK:        err == nil,
+			LatencyMs: float64(latency.Microseconds()) / 1000,
+		},
+		ConfigVersion: h.settingVersion(),
+	}
+	if err != nil {
+		r.Redis.Error = err.Error()
+		r.Redis.FailingSince = &failingSince
+		r.Status = HealthStatusDegraded
+		if now.Sub(failingSince) >= time.Duration(config.ReadinessRedisFailureSec)*time.Second {
+			r.Status = HealthStatusUnavailable
+		}
+	}
+
+	status := h.accessCtrl.Status()
+	r.Worker = HealthWorker{
+		WorkerStatus: status,
+		Stale:        now.Sub(status.LastTick) > time.Duration(config.PermitIntervalSec)*time.Second*workerStaleIntervals,
+	}
+	r.Leader = len(status.LeaderQueues) > 0
+
+	if !h.ready.Load() {
+		r.Status = HealthStatusShuttingDown
+	}
+	return r
+}
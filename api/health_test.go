@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestHealth_Readyz(t *testing.T) {
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	tests := []struct {
+		name        string
+		redisClient *redis.Client
+		failureSec  int
+		ready       bool
+		wantCode    int
+		wantStatus  string
+	}{
+		{
+			name:        "ok",
+			redisClient: testutils.TestRedisClient(),
+			ready:       true,
+			wantCode:    http.StatusOK,
+			wantStatus:  HealthStatusOK,
+		},
+		{
+			name:        "shutting down",
+			redisClient: testutils.TestRedisClient(),
+			ready:       false,
+			wantCode:    http.StatusServiceUnavailable,
+			wantStatus:  HealthStatusShuttingDown,
+		},
+		{
+			name:        "redis unreachable within threshold",
+			redisClient: unreachable,
+			failureSec:  60,
+			ready:       true,
+			wantCode:    http.StatusOK,
+			wantStatus:  HealthStatusDegraded,
+		},
+		{
+			name:        "redis unreachable past threshold",
+			redisClient: unreachable,
+			ready:       true,
+			wantCode:    http.StatusServiceUnavailable,
+			wantStatus:  HealthStatusUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &waitingroom.Config{
+				PermitIntervalSec:        10,
+				ReadinessRedisFailureSec: tt.failureSec,
+			}
+			ac := waitingroom.NewAccessController(config, tt.redisClient)
+			h := NewHealthHandler(tt.redisClient, ac, func() int64 { return 3 })
+			h.SetReady(tt.ready)
+
+			ctx, rec := testutils.TestContext("/readyz", http.MethodGet, nil)
+			if err := h.Readyz(ctx); err != nil {
+				t.Fatalf("Readyz() error = %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("Readyz() code = %v, want %v", rec.Code, tt.wantCode)
+			}
+
+			r := HealthResult{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Status != tt.wantStatus {
+				t.Errorf("Readyz() status = %v, want %v", r.Status, tt.wantStatus)
+			}
+			if r.ConfigVersion != 3 {
+				t.Errorf("Readyz() config_version = %v, want 3", r.ConfigVersion)
+			}
+			if r.Redis.OK != (tt.redisClient != unreachable) {
+				t.Errorf("Readyz() redis = %+v", r.Redis)
+			}
+			// まだ一度も判定していない
+			if !r.Worker.Stale || r.Leader {
+				t.Errorf("Readyz() worker = %+v, leader = %v", r.Worker, r.Leader)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// getIPRules is getting ip rules.
+// @Summary get ip rules
+// @Description get ip rules
+// @ID iprules#get
+// @Accept  json
+// @Produce  json
+// @Param page query int false "page" minimum(1)
+// @Param per_page query int false "per_page" minimum(1)
+// @Success 200 {array} waitingroom.IPRule
+// @Failure 500 {object} api.HTTPError
+// @Router /iprules [get]
+// @Tags iprules
+func (h *ipRuleHandler) getIPRules(c echo.Context) error {
+	page, perPage, err := paginate(c)
+	if err != nil {
+		slog.Error("pagenate error", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, total, err := h.ipRuleModel.GetIPRules(c.Request().Context(), perPage, page)
+	if err != nil {
+		slog.Error("cant get ip rules", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("X-Pagination-Total-Pages", strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, r)
+}
+
+// deleteIPRuleByID is delete ip rule.
+// @Summary delete ip rule
+// @Description delete ip rule
+// @ID iprules#delete
+// @Accept  json
+// @Produce  json
+// @Param id path string true "IPRule ID(URL encoded)"
+// @Success 204 "No Content"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /iprules/{id} [delete]
+// @Tags iprules
+func (h *ipRuleHandler) deleteIPRuleByID(c echo.Context) error {
+	// CIDRの/はエンコードして渡される
+	id, err := url.PathUnescape(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := h.ipRuleModel.DeleteIPRule(c.Request().Context(), id); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createIPRule is create ip rule.
+// @Summary create ip rule
+// @Description create ip rule. domain is empty for all domains
+// @ID iprules#post
+// @Accept  json
+// @Produce  json
+// @Param iprule body waitingroom.IPRule true "IPRule Object"
+// @Success 201 "Created"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /iprules [post]
+// @Tags iprules
+func (h *ipRuleHandler) createIPRule(c echo.Context) error {
+	r := &waitingroom.IPRule{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := validator.New().Struct(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.ipRuleModel.SaveIPRule(c.Request().Context(), r); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusCreated, nil)
+}
+
+type ipRuleHandler struct {
+	ipRuleModel *waitingroom.IPRuleModel
+}
+
+func NewIPRuleHandler(redisC *redis.Client, config *waitingroom.Config) *ipRuleHandler {
+	return &ipRuleHandler{
+		ipRuleModel: waitingroom.NewIPRuleModel(redisC, config),
+	}
+}
+
+func (h *ipRuleHandler) SetConfig(config *waitingroom.Config) {
+	h.ipRuleModel.SetConfig(config)
+}
+
+func (h *ipRuleHandler) WatchInvalidations(ctx context.Context) error {
+	return h.ipRuleModel.WatchInvalidations(ctx)
+}
+
+// 設定の再読み込みとキャッシュの破棄を受け取れるよう、ハンドラを返す
+func VironIPRuleEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config) *ipRuleHandler {
+	h := NewIPRuleHandler(redisC, config)
+	g.GET("/iprules", h.getIPRules)
+	g.DELETE("/iprules/:id", h.deleteIPRuleByID)
+	g.POST("/iprules", h.createIPRule)
+	return h
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// getMaintenances is getting maintenances.
+// @Summary get maintenances
+// @Description get maintenances
+// @ID maintenances#get
+// @Accept  json
+// @Produce  json
+// @Param page query int false "page" minimum(1)
+// @Param per_page query int false "per_page" minimum(1)
+// @Success 200 {array} waitingroom.Maintenance
+// @Failure 500 {object} api.HTTPError
+// @Router /maintenances [get]
+// @Tags maintenances
+func (h *maintenanceHandler) getMaintenances(c echo.Context) error {
+	page, perPage, err := paginate(c)
+	if err != nil {
+		slog.Error("pagenate error", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, total, err := h.maintenanceModel.GetMaintenances(c.Request().Context(), perPage, page)
+	if err != nil {
+		slog.Error("cant get maintenances", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("X-Pagination-Total-Pages", strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, r)
+}
+
+// updateMaintenanceByName is update maintenance.
+// @Summary update maintenance
+// @Description update maintenance
+// @ID maintenances#put
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Maintenance Domain"
+// @Param maintenance body waitingroom.Maintenance true "Maintenance Object"
+// @Success 200 "OK"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /maintenances/{domain} [put]
+// @Tags maintenances
+func (h *maintenanceHandler) updateMaintenanceByName(c echo.Context) error {
+	m := &waitingroom.Maintenance{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	m.Domain = c.Param("domain")
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.maintenanceModel.SaveMaintenance(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// deleteMaintenanceByName is delete maintenance.
+// @Summary delete maintenance
+// @Description delete maintenance
+// @ID maintenances#delete
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Maintenance Domain"
+// @Success 204 "No Content"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /maintenances/{domain} [delete]
+// @Tags maintenances
+func (h *maintenanceHandler) deleteMaintenanceByName(c echo.Context) error {
+	if err := h.maintenanceModel.DeleteMaintenance(c.Request().Context(), c.Param("domain")); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createMaintenance is create maintenance.
+// @Summary create maintenance
+// @Description create maintenance
+// @ID maintenances#post
+// @Accept  json
+// @Produce  json
+// @Param maintenance body waitingroom.Maintenance true "Maintenance Object"
+// @Success 201 "Created"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /maintenances [post]
+// @Tags maintenances
+func (h *maintenanceHandler) createMaintenance(c echo.Context) error {
+	m := &waitingroom.Maintenance{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.maintenanceModel.SaveMaintenance(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusCreated, nil)
+}
+
+type maintenanceHandler struct {
+	maintenanceModel *waitingroom.MaintenanceModel
+}
+
+func NewMaintenanceHandler(redisC *redis.Client, config *waitingroom.Config) *maintenanceHandler {
+	return &maintenanceHandler{
+		maintenanceModel: waitingroom.NewMaintenanceModel(redisC, config),
+	}
+}
+
+func (h *maintenanceHandler) SetConfig(config *waitingroom.Config) {
+	h.maintenanceModel.SetConfig(config)
+}
+
+func (h *maintenanceHandler) WatchInvalidations(ctx context.Context) error {
+	return h.maintenanceModel.WatchInvalidations(ctx)
+}
+
+// 設定の再読み込みとキャッシュの破棄を受け取れるよう、ハンドラを返す
+func VironMaintenanceEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config) *maintenanceHandler {
+	h := NewMaintenanceHandler(redisC, config)
+	g.GET("/maintenances", h.getMaintenances)
+	g.PUT("/maintenances/:domain", h.updateMaintenanceByName)
+	g.DELETE("/maintenances/:domain", h.deleteMaintenanceByName)
+	g.POST("/maintenances", h.createMaintenance)
+	return h
+}
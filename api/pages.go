@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/pyama86/waitingroom/repository"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+type pageHandler struct {
+	sc       *securecookie.SecureCookie
+	wr       *waitingroom.Waitingroom
+	renderer *waitingroom.PageRenderer
+}
+
+func NewPageHandler(
+	sc *securecookie.SecureCookie,
+	redisC *redis.Client,
+	config *waitingroom.Config,
+	renderer *waitingroom.PageRenderer,
+) *pageHandler {
+	repo := repository.NewWaitingroomRepository(redisC)
+	wr := waitingroom.NewWaitingroom(config, repo)
+	// 他のインスタンスで変更された待機ページを、描画に使うキャッシュから破棄する
+	wr.SetPageRenderer(renderer)
+	return &pageHandler{
+		sc:       sc,
+		wr:       wr,
+		renderer: renderer,
+	}
+}
+
+func (h *pageHandler) SetConfig(config *waitingroom.Config) {
+	h.wr.SetConfig(config)
+}
+
+func (h *pageHandler) WatchInvalidations(ctx context.Context) error {
+	return h.wr.WatchInvalidations(ctx)
+}
+
+// 待機ページを描画する。クッキーのシリアル番号から待ち人数や待ち時間を算出する
+func (h *pageHandler) Show(c echo.Context) error {
+	domain := c.Param(paramDomainKey)
+	result := &waitingroom.QueueResult{Enabled: true}
+
+	m, err := h.wr.GetMaintenance(c.Request().Context(), domain)
+	if err != nil {
+		return newError(http.StatusInternalServerError, err, " can't get maintenance")
+	}
+	key, err := h.wr.ResolveQueueKey(c.Request().Context(), domain, originalPath(c.Request()))
+	if err != nil {
+		return newError(http.StatusInternalServerError, err, " can't resolve route")
+	}
+	limit, err := h.wr.GetQueueLimit(c.Request().Context(), key.String())
+	if err != nil {
+		return newError(http.StatusInternalServerError, err, " can't get queue limit")
+	}
+
+	client, err := waitingroom.NewClientByQueueKey(c.Response(), c.Request(), h.sc, key)
+	if m != nil && m.Active(time.Now()) {
+		result = m.Result()
+	} else if limit.SoldOut() && (err != nil || !client.HasSerialNumber()) {
+		result.SoldOut = true
+	} else if err != nil {
+		slog.Debug("can't decode client", slog.String("domain", domain), slog.String("error", err.Error()))
+	} else if client.HasSerialNumber() {
+		remainingWaitSecond, pn, err := h.wr.CalcRemainingWaitSecond(c.Request().Context(), key.String(), client.SerialNumber)
+		if err != nil {
+			return newError(http.StatusInternalServerError, err, " can't calc remaining wait second")
+		}
+		result.ID = client.ID
+		result.SerialNo = client.SerialNumber
+		result.PermittedNo = pn
+		result.RemainingWaitSecond = remainingWaitSecond
+	} else {
+		// 待機ページから作業証明の課題を解けるよう、まだ解いていないクライアントには課題を渡す
+		challenge, err := h.wr.RequiredChallenge(c.Request().Context(), c.Request(), h.sc, domain, key.String(), client)
+		if err != nil {
+			return newError(http.StatusInternalServerError, err, " can't issue challenge")
+		}
+		result.Challenge = challenge
+		result.Captcha = h.wr.RequiredCaptcha(domain, client)
+	}
+
+	var buf bytes.Buffer
+	data := waitingroom.NewPageData(domain, result, h.wr.Config())
+	if err := h.renderer.Render(c.Request().Context(), &buf, c.Request().Header.Get("Accept-Language"), data); err != nil {
+		return newError(http.StatusInternalServerError, err, " can't render page")
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// テンプレートディレクトリに置かれたロゴなどを返す
+func (h *pageHandler) Asset(c echo.Context) error {
+	path, ok := h.renderer.AssetPath(c.Param(paramDomainKey), c.Param("file"))
+	if !ok {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.File(path)
+}
+
+// getPages is getting pages.
+// @Summary get pages
+// @Description get waiting page settings
+// @ID pages#get
+// @Accept  json
+// @Produce  json
+// @Param page query int false "page" minimum(1)
+// @Param per_page query int false "per_page" minimum(1)
+// @Success 200 {array} waitingroom.Page
+// @Failure 500 {object} api.HTTPError
+// @Router /pages [get]
+// @Tags pages
+func (h *pageModelHandler) getPages(c echo.Context) error {
+	page, perPage, err := paginate(c)
+	if err != nil {
+		slog.Error("pagenate error", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, total, err := h.pageModel.GetPages(c.Request().Context(), perPage, page)
+	if err != nil {
+		slog.Error("cant get pages", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("X-Pagination-Total-Pages", strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, r)
+}
+
+// updatePageByName is update page.
+// @Summary update page
+// @Description update waiting page setting
+// @ID pages#put
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Page Domain"
+// @Param page body waitingroom.Page true "Page Object"
+// @Success 200 "OK"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /pages/{domain} [put]
+// @Tags pages
+func (h *pageModelHandler) updatePageByName(c echo.Context) error {
+	p := &waitingroom.Page{}
+	if err := c.Bind(p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	p.Domain = c.Param("domain")
+	if err := validator.New().Struct(p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.pageModel.SavePage(c.Request().Context(), p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// deletePageByName is delete page.
+// @Summary delete page
+// @Description delete waiting page setting
+// @ID pages#delete
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Page Domain"
+// @Success 204 "No Content"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /pages/{domain} [delete]
+// @Tags pages
+func (h *pageModelHandler) deletePageByName(c echo.Context) error {
+	if err := h.pageModel.DeletePage(c.Request().Context(), c.Param("domain")); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createPage is create page.
+// @Summary create page
+// @Description create waiting page setting
+// @ID pages#post
+// @Accept  json
+// @Produce  json
+// @Param page body waitingroom.Page true "Page Object"
+// @Success 201 "Created"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /pages [post]
+// @Tags pages
+func (h *pageModelHandler) createPage(c echo.Context) error {
+	p := &waitingroom.Page{}
+	if err := c.Bind(p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := validator.New().Struct(p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.pageModel.SavePage(c.Request().Context(), p); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	return c.JSON(http.StatusCreated, nil)
+}
+
+type pageModelHandler struct {
+	pageModel *waitingroom.PageModel
+}
+
+func NewPageModelHandler(redisC *redis.Client, config *waitingroom.Config, renderer *waitingroom.PageRenderer) *pageModelHandler {
+	return &pageModelHandler{
+		pageModel: waitingroom.NewPageModel(redisC, config, renderer),
+	}
+}
+
+func (h *pageModelHandler) SetConfig(config *waitingroom.Config) {
+	h.pageModel.SetConfig(config)
+}
+
+// 設定の再読み込みを受け取れるよう、ハンドラを返す
+func VironPageEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config, renderer *waitingroom.PageRenderer) *pageModelHandler {
+	h := NewPageModelHandler(redisC, config, renderer)
+	g.GET("/pages", h.getPages)
+	g.PUT("/pages/:domain", h.updatePageByName)
+	g.DELETE("/pages/:domain", h.deletePageByName)
+	g.POST("/pages", h.createPage)
+	return h
+}
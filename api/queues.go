@@ -1,8 +1,11 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/go-redis/redis/v8"
@@ -152,89 +155,48 @@ func NewQueueHandler(
 	}
 }
 
-const paramDomainKey = "domain"
-
-type QueueResult struct {
-	ID                  string
-	Enabled             bool  `json:"enabled"`
-	PermittedClient     bool  `json:"permitted_client"`
-	SerialNo            int64 `json:"serial_no"`
-	PermittedNo         int64 `json:"permitted_no"`
-	RemainingWaitSecond int64 `json:"remaining_wait_second"`
+func (p *queueHandler) SetConfig(config *waitingroom.Config) {
+	p.wr.SetConfig(config)
+	p.queueModel.SetConfig(config)
 }
 
-func (p *queueHandler) Check(c echo.Context) error {
-
-	// 歴史的な経緯でGETでwaitingroomを有効にしているが、POSTで有効にするべき
-	if c.Param("enable") != "" {
-		if err := p.wr.EnableQueue(c.Request().Context(),
-			c.Param(paramDomainKey)); err != nil {
-			return newError(http.StatusInternalServerError, err, " can't enable queue")
-		}
-	} else {
-		ok, err := p.wr.IsEnabledQueue(c.Request().Context(), c.Param(paramDomainKey))
-		if err != nil {
-			return newError(http.StatusInternalServerError, err, " can't get enable status")
-		}
-
-		if !ok {
-			return c.JSON(http.StatusOK, QueueResult{Enabled: false, PermittedClient: false})
-		}
-
-	}
-
-	// ホワイトリストに含まれているドメインならば即時許可応答する
-	ok, err := p.wr.IsInWhitelist(c.Request().Context(), c.Param(paramDomainKey))
-	if err != nil {
-		return newError(http.StatusInternalServerError, err, " can't get whitelist")
-	}
-	if ok {
-		return c.JSON(http.StatusOK, QueueResult{Enabled: false, PermittedClient: false})
-	}
+// 他のインスタンスでの変更を判定用と管理API用のキャッシュに反映する
+func (p *queueHandler) WatchInvalidations(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.queueModel.WatchInvalidations(ctx)
+	}()
+	err := p.wr.WatchInvalidations(ctx)
+	return errors.Join(err, <-errc)
+}
 
-	// 許可済みクライアントかどうかを判定する
-	client, err := waitingroom.NewClientByContext(c, p.sc)
-	if err != nil {
-		return newError(http.StatusInternalServerError, err, " can't build info")
-	}
-	ok, err = p.wr.IsPermittedClient(c.Request().Context(), client)
-	if err != nil {
-		return newError(http.StatusInternalServerError, err, " can't get permit status")
-	}
+const paramDomainKey = "domain"
 
-	if ok {
-		return c.JSON(http.StatusOK, QueueResult{ID: client.ID, Enabled: true, PermittedClient: true})
-	}
+type QueueResult = waitingroom.QueueResult
 
-	serialNumber, err := p.wr.AssignSerialNumber(c.Request().Context(), c.Param(paramDomainKey), client)
+func (p *queueHandler) Check(c echo.Context) error {
+	// 歴史的な経緯でGETでwaitingroomを有効にしているが、POSTで有効にするべき
+	status, result, err := p.wr.Check(c.Response(), c.Request(), p.sc, c.Param(paramDomainKey), originalPath(c.Request()), c.Param("enable") != "")
 	if err != nil {
-		return newError(http.StatusInternalServerError, err, " can't get serial no")
+		return newError(http.StatusInternalServerError, err, " can't check queue")
 	}
+	return c.JSON(status, result)
+}
 
-	if err := client.SaveToCookie(c, p.config); err != nil {
-		return newError(http.StatusInternalServerError, err, "can't save client info")
+// クライアントがアクセスしたパスを返す。渡されていなければドメイン全体の待合室で判定する
+// mrubyはuriパラメータ、nginxのauth_requestはX-Original-URI、forward-authはX-Forwarded-Uriで渡す
+func originalPath(r *http.Request) string {
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		uri = r.Header.Get("X-Original-URI")
 	}
-
-	if client.HasSerialNumber() {
-		ok, err := p.wr.CheckAndPermitClient(c.Request().Context(), c.Param(paramDomainKey), client)
-		if err != nil {
-			return newError(http.StatusInternalServerError, err, " can't jude permit access")
-		}
-		if ok {
-			return c.JSON(http.StatusOK, QueueResult{ID: client.ID, Enabled: true, PermittedClient: true})
-		}
+	if uri == "" {
+		uri = r.Header.Get("X-Forwarded-Uri")
 	}
 
-	remaningWaitSecond, pn, err := p.wr.CalcRemainingWaitSecond(c.Request().Context(), c.Param(paramDomainKey), serialNumber)
+	u, err := url.ParseRequestURI(uri)
 	if err != nil {
-		return newError(http.StatusInternalServerError, err, " can't calc remaining wait second")
+		return ""
 	}
-	return c.JSON(http.StatusTooManyRequests, QueueResult{
-		ID:                  client.ID,
-		Enabled:             true,
-		PermittedClient:     false,
-		SerialNo:            client.SerialNumber,
-		PermittedNo:         pn,
-		RemainingWaitSecond: remaningWaitSecond,
-	})
+	return u.Path
 }
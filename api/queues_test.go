@@ -47,8 +47,8 @@ func TestQueues_Check(t *testing.T) {
 			wantErr:    false,
 			wantStatus: http.StatusTooManyRequests,
 			beforeHook: func(key string, redisClient *redis.Client) {
-				redisClient.SetEX(context.Background(), key+"_current_no", 1, 10*time.Second)
-				redisClient.SetEX(context.Background(), key+"_permitted_no", 0, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 0, 10*time.Second)
 			},
 			expect: func(t *testing.T, c *waitingroom.Client, r *redis.Client) {
 				if c.ID == "" {
@@ -84,8 +84,8 @@ func TestQueues_Check(t *testing.T) {
 			wantErr:    false,
 			wantStatus: http.StatusTooManyRequests,
 			beforeHook: func(key string, redisClient *redis.Client) {
-				redisClient.SetEX(context.Background(), key+"_current_no", 31, 10*time.Second)
-				redisClient.SetEX(context.Background(), key+"_permitted_no", 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 31, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 1, 10*time.Second)
 			},
 			expect: func(t *testing.T, c *waitingroom.Client, r *redis.Client) {
 				if c.ID == "" {
@@ -145,8 +145,8 @@ func TestQueues_Check(t *testing.T) {
 			wantErr:    false,
 			wantStatus: http.StatusOK,
 			beforeHook: func(key string, redisClient *redis.Client) {
-				redisClient.SetEX(context.Background(), key+"_current_no", 1, 10*time.Second)
-				redisClient.SetEX(context.Background(), key+"_permitted_no", 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 1, 10*time.Second)
 			},
 			expectQueueResult: QueueResult{
 				Enabled:         true,
@@ -174,10 +174,10 @@ func TestQueues_Check(t *testing.T) {
 			wantErr:    false,
 			wantStatus: http.StatusOK,
 			beforeHook: func(key string, redisClient *redis.Client) {
-				redisClient.SetEX(context.Background(), key+"_current_no", 1, 10*time.Second)
-				redisClient.SetEX(context.Background(), key+"_permitted_no", 1, 10*time.Second)
-				redisClient.ZAdd(context.Background(), "queue-whitelist", &redis.Z{Member: key, Score: 1})
-				redisClient.Expire(context.Background(), "queue-whitelist", 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 1, 10*time.Second)
+				redisClient.ZAdd(context.Background(), repository.Keys().Global("whitelist"), &redis.Z{Member: key, Score: 1})
+				redisClient.Expire(context.Background(), repository.Keys().Global("whitelist"), 10*time.Second)
 			},
 			expectQueueResult: QueueResult{
 				Enabled:         false,
@@ -264,3 +264,325 @@ func TestQueues_Check(t *testing.T) {
 		})
 	}
 }
+
+func TestQueues_CheckMaintenance(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	tests := []struct {
+		name        string
+		config      *waitingroom.Config
+		maintenance string
+		whitelist   bool
+		wantStatus  int
+		wantResult  QueueResult
+	}{
+		{
+			name:        "maintenance",
+			config:      &waitingroom.Config{},
+			maintenance: `{"message":"closed"}`,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantResult:  QueueResult{Enabled: true, Maintenance: true, Message: "closed"},
+		},
+		{
+			name:        "scheduled maintenance",
+			config:      &waitingroom.Config{},
+			maintenance: `{"message":"closed","start_at":"2999-01-01T00:00:00Z"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "whitelist",
+			config:      &waitingroom.Config{},
+			maintenance: `{"message":"closed"}`,
+			whitelist:   true,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "bypass ip",
+			config:      &waitingroom.Config{MaintenanceBypassCIDRs: []string{"192.0.2.0/24"}},
+			maintenance: `{"message":"closed"}`,
+			wantStatus:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			domain := testutils.TestRandomString(20)
+			redisClient.HSet(ctx, repository.Keys().Global("maintenances"), domain, tt.maintenance)
+			defer redisClient.HDel(ctx, repository.Keys().Global("maintenances"), domain)
+			if tt.whitelist {
+				redisClient.ZAdd(ctx, repository.Keys().Global("whitelist"), &redis.Z{Member: domain, Score: 1})
+				defer redisClient.ZRem(ctx, repository.Keys().Global("whitelist"), domain)
+			}
+
+			repo := repository.NewWaitingroomRepository(redisClient)
+			p := &queueHandler{
+				sc: testutils.SecureCookie,
+				wr: waitingroom.NewWaitingroom(tt.config, repo),
+			}
+			c, rec := testutils.TestContext("/", http.MethodGet, map[string]string{})
+			c.SetPath("/queues/:domain")
+			c.SetParamNames("domain")
+			c.SetParamValues(domain)
+
+			if err := p.Check(c); err != nil {
+				t.Fatalf("queueHandler.Check() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("queueHandler.Check() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			result := QueueResult{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("queueHandler.Check() error = %v", err)
+			}
+			if result.Maintenance != tt.wantResult.Maintenance || result.Message != tt.wantResult.Message {
+				t.Errorf("queueHandler.Check() result = %+v, want %+v", result, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestQueues_CheckSoldOut(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	tests := []struct {
+		name        string
+		limit       map[string]interface{}
+		client      waitingroom.Client
+		wantStatus  int
+		wantSoldOut bool
+	}{
+		{
+			name:        "closed",
+			limit:       map[string]interface{}{"max_serial_no": 0, "closed": 1, "issued": 0},
+			wantStatus:  http.StatusGone,
+			wantSoldOut: true,
+		},
+		{
+			name:        "reached max serial number",
+			limit:       map[string]interface{}{"max_serial_no": 10, "closed": 0, "issued": 10},
+			wantStatus:  http.StatusGone,
+			wantSoldOut: true,
+		},
+		{
+			name:       "under max serial number",
+			limit:      map[string]interface{}{"max_serial_no": 10, "closed": 0, "issued": 9},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "client has serial number",
+			limit: map[string]interface{}{"max_serial_no": 0, "closed": 1, "issued": 0},
+			client: waitingroom.Client{
+				ID:           "sold_out_client",
+				SerialNumber: 1,
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			domain := testutils.TestRandomString(20)
+			redisClient.HSet(ctx, repository.Keys().Queue(domain, "limit"), tt.limit)
+			defer redisClient.Del(ctx, repository.Keys().Queue(domain, "limit"))
+
+			repo := repository.NewWaitingroomRepository(redisClient)
+			p := &queueHandler{
+				sc: testutils.SecureCookie,
+				wr: waitingroom.NewWaitingroom(&waitingroom.Config{}, repo),
+			}
+			c, rec := testutils.TestContext("/", http.MethodGet, map[string]string{})
+			c.SetPath("/queues/:domain")
+			c.SetParamNames("domain")
+			c.SetParamValues(domain)
+			encoded, err := testutils.SecureCookie.Encode(waitingroom.ClientCookieKey, tt.client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request().AddCookie(&http.Cookie{Name: waitingroom.ClientCookieKey, Value: encoded})
+
+			if err := p.Check(c); err != nil {
+				t.Fatalf("queueHandler.Check() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("queueHandler.Check() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			result := QueueResult{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("queueHandler.Check() error = %v", err)
+			}
+			if result.SoldOut != tt.wantSoldOut {
+				t.Errorf("queueHandler.Check() SoldOut = %v, want %v", result.SoldOut, tt.wantSoldOut)
+			}
+		})
+	}
+}
+
+func TestQueues_CheckRoute(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	domain := testutils.TestRandomString(20)
+	redisClient.HSet(ctx, repository.Keys().Global("routes"), domain, `{"rules":[{"name":"checkout","prefix":"/checkout"}]}`)
+	defer redisClient.HDel(ctx, repository.Keys().Global("routes"), domain)
+	defer redisClient.ZRem(ctx, repository.Keys().Global("domains"), domain, domain+":checkout")
+
+	repo := repository.NewWaitingroomRepository(redisClient)
+	check := func(target string, header map[string]string, cookie *http.Cookie, enable bool) (*http.Response, QueueResult) {
+		p := &queueHandler{
+			sc: testutils.SecureCookie,
+			wr: waitingroom.NewWaitingroom(&waitingroom.Config{PermitUnitNumber: 1, PermittedAccessSec: 10, QueueEnableSec: 10}, repo),
+		}
+		c, rec := testutils.TestContext(target, http.MethodGet, map[string]string{})
+		for k, v := range header {
+			c.Request().Header.Set(k, v)
+		}
+		c.SetPath("/queues/:domain")
+		c.SetParamNames("domain", "enable")
+		c.SetParamValues(domain, "")
+		if enable {
+			c.SetParamValues(domain, "enable")
+		}
+		if cookie != nil {
+			c.Request().AddCookie(cookie)
+		}
+		if err := p.Check(c); err != nil {
+			t.Fatalf("queueHandler.Check() error = %v", err)
+		}
+		result := QueueResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("queueHandler.Check() error = %v", err)
+		}
+		return rec.Result(), result
+	}
+
+	// ルートに一致したパスだけが待合室になる
+	res, _ := check("/?uri=%2Fcheckout%2Fcart%3Fid%3D1", nil, nil, true)
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("route status = %v, want %v", res.StatusCode, http.StatusTooManyRequests)
+	}
+	var cookie *http.Cookie
+	for _, v := range res.Cookies() {
+		if v.Name == waitingroom.ClientCookieKey+"-checkout" {
+			cookie = v
+		}
+	}
+	if cookie == nil || cookie.Path != "/checkout" {
+		t.Fatalf("route cookie = %+v, want path /checkout", cookie)
+	}
+	if ok, _ := redisClient.ZScore(ctx, repository.Keys().Global("domains"), domain+":checkout").Result(); ok == 0 {
+		t.Errorf("route queue is not enabled")
+	}
+
+	res, result := check("/", map[string]string{"X-Original-URI": "/top"}, nil, false)
+	if res.StatusCode != http.StatusOK || result.Enabled {
+		t.Errorf("domain status = %v enabled = %v, want %v false", res.StatusCode, result.Enabled, http.StatusOK)
+	}
+
+	// ルートの待合室で許可されたクライアントは、ドメイン全体の待合室では許可されない
+	client := waitingroom.Client{ID: testutils.TestRandomString(20), SerialNumber: 1}
+	redisClient.Set(ctx, repository.Keys().Queue(domain+":checkout", "permitted_no"), 1, 10*time.Second)
+	defer redisClient.Del(ctx, repository.Keys().Queue(domain+":checkout", "permitted_no"), repository.Keys().Queue(domain+":checkout", "current_no"), repository.Keys().Queue(domain, "permitted_no"), repository.Keys().Queue(domain, "current_no"))
+
+	encoded, err := testutils.SecureCookie.Encode(waitingroom.ClientCookieKey+"-checkout", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, result = check("/", map[string]string{"X-Forwarded-Uri": "/checkout"}, &http.Cookie{Name: waitingroom.ClientCookieKey + "-checkout", Value: encoded}, false)
+	if res.StatusCode != http.StatusOK || !result.PermittedClient {
+		t.Fatalf("route permitted status = %v permitted = %v", res.StatusCode, result.PermittedClient)
+	}
+	if n, _ := redisClient.Exists(ctx, repository.Keys().Permit(domain+":checkout_"+client.ID)).Result(); n != 1 {
+		t.Errorf("permit is not scoped to the route")
+	}
+
+	redisClient.Set(ctx, repository.Keys().Queue(domain, "permitted_no"), 0, 10*time.Second)
+	encoded, err = testutils.SecureCookie.Encode(waitingroom.ClientCookieKey, waitingroom.Client{ID: client.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, result = check("/", map[string]string{"X-Original-URI": "/top"}, &http.Cookie{Name: waitingroom.ClientCookieKey, Value: encoded}, false)
+	if result.PermittedClient {
+		t.Errorf("client permitted on the route is permitted on the domain")
+	}
+}
+
+func TestQueues_CheckGroup(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	name := testutils.TestRandomString(10)
+	www := "www." + name + ".example"
+	m := "m." + name + ".example"
+	repo := repository.NewWaitingroomRepository(redisClient)
+	wr := waitingroom.NewWaitingroom(&waitingroom.Config{PermitUnitNumber: 1, PermittedAccessSec: 10, QueueEnableSec: 10}, repo)
+	if err := wr.SaveGroup(ctx, &waitingroom.Group{Name: name, Domains: []string{www, m}, CookieDomain: name + ".example"}); err != nil {
+		t.Fatal(err)
+	}
+	defer wr.DeleteGroup(ctx, name)
+
+	key := "@" + name
+	defer redisClient.ZRem(ctx, repository.Keys().Global("domains"), key)
+	defer redisClient.Del(ctx, repository.Keys().Queue(key, "permitted_no"), repository.Keys().Queue(key, "current_no"))
+
+	check := func(domain string, cookie *http.Cookie, enable bool) (*http.Response, QueueResult) {
+		p := &queueHandler{
+			sc: testutils.SecureCookie,
+			wr: waitingroom.NewWaitingroom(&waitingroom.Config{PermitUnitNumber: 1, PermittedAccessSec: 10, QueueEnableSec: 10}, repo),
+		}
+		c, rec := testutils.TestContext("/", http.MethodGet, map[string]string{})
+		c.SetPath("/queues/:domain")
+		c.SetParamNames("domain", "enable")
+		c.SetParamValues(domain, "")
+		if enable {
+			c.SetParamValues(domain, "enable")
+		}
+		if cookie != nil {
+			c.Request().AddCookie(cookie)
+		}
+		if err := p.Check(c); err != nil {
+			t.Fatalf("queueHandler.Check() error = %v", err)
+		}
+		result := QueueResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("queueHandler.Check() error = %v", err)
+		}
+		return rec.Result(), result
+	}
+
+	// メンバーのドメインで有効にすると、グループの待合室が有効になる
+	res, _ := check(www, nil, true)
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("group status = %v, want %v", res.StatusCode, http.StatusTooManyRequests)
+	}
+	var cookie *http.Cookie
+	for _, v := range res.Cookies() {
+		if v.Name == waitingroom.ClientCookieKey+"-group-"+name {
+			cookie = v
+		}
+	}
+	if cookie == nil || cookie.Domain != name+".example" {
+		t.Fatalf("group cookie = %+v, want domain %s.example", cookie, name)
+	}
+	res, result := check(m, nil, false)
+	if res.StatusCode != http.StatusTooManyRequests || !result.Enabled {
+		t.Errorf("other member status = %v enabled = %v, want %v true", res.StatusCode, result.Enabled, http.StatusTooManyRequests)
+	}
+
+	// 一方のドメインで許可されたクライアントは、もう一方のドメインでも許可される
+	client := waitingroom.Client{ID: testutils.TestRandomString(20), SerialNumber: 1}
+	defer redisClient.Del(ctx, key+"_"+client.ID)
+	redisClient.Set(ctx, repository.Keys().Queue(key, "permitted_no"), 1, 10*time.Second)
+	encoded, err := testutils.SecureCookie.Encode(cookie.Name, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupCookie := &http.Cookie{Name: cookie.Name, Value: encoded}
+	if _, result := check(www, groupCookie, false); !result.PermittedClient {
+		t.Fatalf("client is not permitted on %s", www)
+	}
+
+	redisClient.Set(ctx, repository.Keys().Queue(key, "permitted_no"), 0, 10*time.Second)
+	encoded, err = testutils.SecureCookie.Encode(cookie.Name, waitingroom.Client{ID: client.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, result := check(m, &http.Cookie{Name: cookie.Name, Value: encoded}, false); !result.PermittedClient {
+		t.Errorf("client permitted on %s is not permitted on %s", www, m)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// getRoutes is getting routes.
+// @Summary get routes
+// @Description get routes
+// @ID routes#get
+// @Accept  json
+// @Produce  json
+// @Param page query int false "page" minimum(1)
+// @Param per_page query int false "per_page" minimum(1)
+// @Success 200 {array} waitingroom.Route
+// @Failure 500 {object} api.HTTPError
+// @Router /routes [get]
+// @Tags routes
+func (h *routeHandler) getRoutes(c echo.Context) error {
+	page, perPage, err := paginate(c)
+	if err != nil {
+		slog.Error("pagenate error", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, total, err := h.routeModel.GetRoutes(c.Request().Context(), perPage, page)
+	if err != nil {
+		slog.Error("cant get routes", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("X-Pagination-Total-Pages", strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, r)
+}
+
+// updateRouteByName is update route.
+// @Summary update route
+// @Description update route
+// @ID routes#put
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Route Domain"
+// @Param route body waitingroom.Route true "Route Object"
+// @Success 200 "OK"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /routes/{domain} [put]
+// @Tags routes
+func (h *routeHandler) updateRouteByName(c echo.Context) error {
+	m := &waitingroom.Route{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	m.Domain = c.Param("domain")
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.routeModel.SaveRoute(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// deleteRouteByName is delete route.
+// @Summary delete route
+// @Description delete route
+// @ID routes#delete
+// @Accept  json
+// @Produce  json
+// @Param domain path string true "Route Domain"
+// @Success 204 "No Content"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /routes/{domain} [delete]
+// @Tags routes
+func (h *routeHandler) deleteRouteByName(c echo.Context) error {
+	if err := h.routeModel.DeleteRoute(c.Request().Context(), c.Param("domain")); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createRoute is create route.
+// @Summary create route
+// @Description create route
+// @ID routes#post
+// @Accept  json
+// @Produce  json
+// @Param route body waitingroom.Route true "Route Object"
+// @Success 201 "Created"
+// @Failure 400 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /routes [post]
+// @Tags routes
+func (h *routeHandler) createRoute(c echo.Context) error {
+	m := &waitingroom.Route{}
+	if err := c.Bind(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := validator.New().Struct(m); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	if err := h.routeModel.SaveRoute(c.Request().Context(), m); err != nil {
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusCreated, nil)
+}
+
+type routeHandler struct {
+	routeModel *waitingroom.RouteModel
+}
+
+func NewRouteHandler(redisC *redis.Client, config *waitingroom.Config) *routeHandler {
+	return &routeHandler{
+		routeModel: waitingroom.NewRouteModel(redisC, config),
+	}
+}
+
+func (h *routeHandler) SetConfig(config *waitingroom.Config) {
+	h.routeModel.SetConfig(config)
+}
+
+func (h *routeHandler) WatchInvalidations(ctx context.Context) error {
+	return h.routeModel.WatchInvalidations(ctx)
+}
+
+// 設定の再読み込みとキャッシュの破棄を受け取れるよう、ハンドラを返す
+func VironRouteEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config) *routeHandler {
+	h := NewRouteHandler(redisC, config)
+	g.GET("/routes", h.getRoutes)
+	g.PUT("/routes/:domain", h.updateRouteByName)
+	g.DELETE("/routes/:domain", h.deleteRouteByName)
+	g.POST("/routes", h.createRoute)
+	return h
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+)
+
+// getSettings is getting settings.
+// @Summary get settings
+// @Description get settings shared across instances
+// @ID settings#get
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} waitingroom.Settings
+// @Failure 500 {object} api.HTTPError
+// @Router /settings [get]
+// @Tags settings
+func (h *settingHandler) getSettings(c echo.Context) error {
+	r, err := h.settingModel.GetSettings(c.Request().Context())
+	if err != nil {
+		slog.Error("can't get settings", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// updateSettings is update settings.
+// @Summary update settings
+// @Description update settings. version must be the current version
+// @ID settings#put
+// @Accept  json
+// @Produce  json
+// @Param settings body waitingroom.Settings true "Settings Object"
+// @Success 200 {object} waitingroom.Settings
+// @Failure 400 {object} api.HTTPError
+// @Failure 409 {object} api.HTTPError
+// @Failure 500 {object} api.HTTPError
+// @Router /settings [put]
+// @Tags settings
+func (h *settingHandler) updateSettings(c echo.Context) error {
+	s := &waitingroom.Settings{}
+	if err := c.Bind(s); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	r, err := h.settingModel.SaveSettings(c.Request().Context(), s)
+	if err != nil {
+		if errors.Is(err, waitingroom.ErrSettingVersionConflict) {
+			return c.JSON(http.StatusConflict, &HTTPError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, &HTTPError{Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// getInstances is getting instances.
+// @Summary get instances
+// @Description get running instances and the settings version they apply
+// @ID settings_instances#get
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} waitingroom.Instance
+// @Failure 500 {object} api.HTTPError
+// @Router /settings/instances [get]
+// @Tags settings
+func (h *settingHandler) getInstances(c echo.Context) error {
+	r, err := h.settingModel.GetInstances(c.Request().Context(), waitingroom.InstanceExpire)
+	if err != nil {
+		slog.Error("can't get instances", slog.Any("error", err))
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+type settingHandler struct {
+	settingModel *waitingroom.SettingModel
+}
+
+func NewSettingHandler(redisC *redis.Client, config *waitingroom.Config) *settingHandler {
+	return &settingHandler{
+		settingModel: waitingroom.NewSettingModel(redisC, config),
+	}
+}
+
+func (h *settingHandler) SetConfig(config *waitingroom.Config) {
+	h.settingModel.SetConfig(config)
+}
+
+func (h *settingHandler) SetFileConfig(config *waitingroom.Config) {
+	h.settingModel.SetFileConfig(config)
+}
+
+func (h *settingHandler) RegisterEndpoints(g *echo.Group) {
+	g.GET("/settings", h.getSettings)
+	g.PUT("/settings", h.updateSettings)
+	g.GET("/settings/instances", h.getInstances)
+}
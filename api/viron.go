@@ -35,7 +35,12 @@ func vironGlobalMenu(c echo.Context) error {
   "name": "WaitingRoom",
   "tags": [
     "queues",
-    "whitelist"
+    "whitelist",
+    "pages",
+    "maintenances",
+    "routes",
+    "groups",
+    "iprules"
   ],
   "pages": [
     {
@@ -58,7 +63,10 @@ func vironGlobalMenu(c echo.Context) error {
 	  "table_labels": [
 	    "domain",
             "current_no",
-            "permitted_no"
+            "permitted_no",
+            "max_serial_number",
+            "closed",
+            "sold_out"
 	  ]
         }
       ]
@@ -76,12 +84,129 @@ func vironGlobalMenu(c echo.Context) error {
 	  "query": [
 	    { "key": "domain", "type": "string" }
           ],
-	  "primary": "domain",
+	  "primary": "id",
           "name": "WhiteList",
 	  "style": "table",
           "pagination": true,
 	  "table_labels": [
-	    "domain"
+	    "domain",
+            "path",
+            "type",
+            "expire_at",
+            "reason",
+            "created_by",
+            "created_at"
+	  ]
+        }
+      ]
+    },
+    {
+      "section": "manage",
+      "id": "pages",
+      "name": "Pages",
+      "components": [
+        {
+          "api": {
+            "method": "get",
+            "path": "/pages"
+          },
+	  "primary": "domain",
+          "name": "Page",
+	  "style": "table",
+          "pagination": true,
+	  "table_labels": [
+	    "domain",
+            "logo_url"
+	  ]
+        }
+      ]
+    },
+    {
+      "section": "manage",
+      "id": "maintenances",
+      "name": "Maintenances",
+      "components": [
+        {
+          "api": {
+            "method": "get",
+            "path": "/maintenances"
+          },
+	  "primary": "domain",
+          "name": "Maintenance",
+	  "style": "table",
+          "pagination": true,
+	  "table_labels": [
+	    "domain",
+            "message",
+            "start_at",
+            "end_at"
+	  ]
+        }
+      ]
+    },
+    {
+      "section": "manage",
+      "id": "routes",
+      "name": "Routes",
+      "components": [
+        {
+          "api": {
+            "method": "get",
+            "path": "/routes"
+          },
+	  "primary": "domain",
+          "name": "Route",
+	  "style": "table",
+          "pagination": true,
+	  "table_labels": [
+	    "domain",
+            "rules"
+	  ]
+        }
+      ]
+    },
+    {
+      "section": "manage",
+      "id": "groups",
+      "name": "Groups",
+      "components": [
+        {
+          "api": {
+            "method": "get",
+            "path": "/groups"
+          },
+	  "primary": "name",
+          "name": "Group",
+	  "style": "table",
+          "pagination": true,
+	  "table_labels": [
+	    "name",
+            "domains",
+            "cookie_domain"
+	  ]
+        }
+      ]
+    },
+    {
+      "section": "manage",
+      "id": "iprules",
+      "name": "IPRules",
+      "components": [
+        {
+          "api": {
+            "method": "get",
+            "path": "/iprules"
+          },
+	  "primary": "id",
+          "name": "IPRule",
+	  "style": "table",
+          "pagination": true,
+	  "table_labels": [
+	    "cidr",
+            "domain",
+            "action",
+            "reason",
+            "created_at"
 	  ]
         }
       ]
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/go-redis/redis/v8"
@@ -82,15 +84,20 @@ func (h *whiteListHandler) getWhiteList(c echo.Context) error {
 // @ID whitelist#delete
 // @Accept  json
 // @Produce  json
-// @Param domain path string true "WhiteList Domain"
+// @Param id path string true "WhiteList ID(URL encoded)"
 // @Success 204 "No Content"
 // @Failure 403 {object} api.HTTPError
 // @Failure 404 {object} api.HTTPError
 // @Failure 500 {object} api.HTTPError
-// @Router /whitelist/{domain} [delete]
+// @Router /whitelist/{id} [delete]
 // @Tags whitelist
 func (h *whiteListHandler) deleteWhiteListByName(c echo.Context) error {
-	if err := h.whiteListModel.DeleteWhiteList(c.Request().Context(), c.Param("domain")); err != nil {
+	// パスを含むルールは/をエンコードして渡される
+	id, err := url.PathUnescape(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := h.whiteListModel.DeleteWhiteList(c.Request().Context(), id); err != nil {
 		return c.JSON(http.StatusBadRequest, err)
 	}
 
@@ -119,7 +126,7 @@ func (h *whiteListHandler) createWhiteList(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err)
 	}
 
-	if err := h.whiteListModel.CreateWhiteList(c.Request().Context(), q.Domain); err != nil {
+	if err := h.whiteListModel.CreateWhiteList(c.Request().Context(), q); err != nil {
 		return c.JSON(http.StatusBadRequest, err)
 	}
 	return c.JSON(http.StatusCreated, nil)
@@ -129,15 +136,25 @@ type whiteListHandler struct {
 	whiteListModel *waitingroom.WhiteListModel
 }
 
-func NewWhiteListHandler(redisC *redis.Client) *whiteListHandler {
+func NewWhiteListHandler(redisC *redis.Client, config *waitingroom.Config) *whiteListHandler {
 	return &whiteListHandler{
-		whiteListModel: waitingroom.NewWhiteListModel(redisC),
+		whiteListModel: waitingroom.NewWhiteListModel(redisC, config),
 	}
 }
 
-func VironWhiteListEndpoints(g *echo.Group, redisC *redis.Client) {
-	h := NewWhiteListHandler(redisC)
+func (h *whiteListHandler) SetConfig(config *waitingroom.Config) {
+	h.whiteListModel.SetConfig(config)
+}
+
+func (h *whiteListHandler) WatchInvalidations(ctx context.Context) error {
+	return h.whiteListModel.WatchInvalidations(ctx)
+}
+
+// 設定の再読み込みとキャッシュの破棄を受け取れるよう、ハンドラを返す
+func VironWhiteListEndpoints(g *echo.Group, redisC *redis.Client, config *waitingroom.Config) *whiteListHandler {
+	h := NewWhiteListHandler(redisC, config)
 	g.GET("/whitelist", h.getWhiteList)
-	g.DELETE("/whitelist/:domain", h.deleteWhiteListByName)
+	g.DELETE("/whitelist/:id", h.deleteWhiteListByName)
 	g.POST("/whitelist", h.createWhiteList)
+	return h
 }
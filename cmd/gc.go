@@ -0,0 +1,79 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/spf13/cobra"
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "find and fix orphaned redis state",
+	Long: `It scans redis keys and fixes inconsistencies left behind by crashes or expired counters,
+such as locks without a TTL, enabled queues without a permitted number, and a current number behind the last number.
+It is safe to run while the service is running. The server also runs it periodically when gc_interval_sec is set.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		redisc, err := newRedisClient(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		gc := repository.NewGarbageCollector(redisc, repository.Keys())
+		list, err := gc.Scan(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			fixed, err := gc.Fix(cmd.Context(), list, time.Duration(config.QueueEnableSec)*time.Second)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "fixed %d of %d inconsistencies\n", fixed, len(list))
+		}
+
+		rows := make([][]string, 0, len(list))
+		for _, in := range list {
+			rows = append(rows, []string{in.Key, in.Queue, in.Kind, in.Fix, in.Detail})
+		}
+		return printOutput(cmd, list, []string{"KEY", "QUEUE", "KIND", "FIX", "DETAIL"}, rows)
+	},
+}
+
+func init() {
+	gcCmd.Flags().Bool("dry-run", false, "show inconsistencies without fixing them")
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// groupCmd represents the group command
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "manage queue groups",
+	Long:  `It is managing groups which share one queue across multiple domains.`,
+}
+
+func newGroupModel(cmd *cobra.Command) (*waitingroom.GroupModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewGroupModel(redisc, config), nil
+}
+
+var groupSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "create or replace a queue group",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domains, _ := cmd.Flags().GetStringSlice("domain")
+		cookieDomain, _ := cmd.Flags().GetString("cookie-domain")
+		g := &waitingroom.Group{
+			Name:         args[0],
+			Domains:      domains,
+			CookieDomain: cookieDomain,
+		}
+		if err := validator.New().Struct(g); err != nil {
+			return fmt.Errorf("invalid group %s: %w", g.Name, err)
+		}
+
+		m, err := newGroupModel(cmd)
+		if err != nil {
+			return err
+		}
+		if err := m.SaveGroup(cmd.Context(), g); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "set group: %s\n", g.Name)
+		return nil
+	},
+}
+
+var groupRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "remove queue groups",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newGroupModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, n := range args {
+			if err := m.DeleteGroup(cmd.Context(), n); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed group: %s\n", n)
+		}
+		return nil
+	},
+}
+
+var groupLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list queue groups",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newGroupModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		list, _, err := m.GetGroups(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+
+		rows := [][]string{}
+		for _, v := range list {
+			rows = append(rows, []string{
+				v.Name,
+				waitingroom.GroupKeyPrefix + v.Name,
+				strings.Join(v.Domains, ","),
+				v.CookieDomain,
+			})
+		}
+		return printOutput(cmd, list, []string{"NAME", "QUEUE", "DOMAINS", "COOKIE_DOMAIN"}, rows)
+	},
+}
+
+func init() {
+	groupSetCmd.Flags().StringSlice("domain", nil, "member domain, can be repeated or comma separated")
+	groupSetCmd.Flags().String("cookie-domain", "", "parent domain of the client cookie shared by the members")
+	groupLsCmd.Flags().Int64("page", 1, "page")
+	groupLsCmd.Flags().Int64("per-page", 100, "per page")
+
+	groupCmd.AddCommand(groupSetCmd)
+	groupCmd.AddCommand(groupRmCmd)
+	groupCmd.AddCommand(groupLsCmd)
+	rootCmd.AddCommand(groupCmd)
+}
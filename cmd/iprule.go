@@ -0,0 +1,155 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// ipruleCmd represents the iprule command
+var ipruleCmd = &cobra.Command{
+	Use:   "iprule",
+	Short: "manage client ip rules",
+	Long: `It is managing CIDRs of clients which are always permitted(allow) or rejected(deny).
+A rule without --domain applies to all domains.`,
+}
+
+func newIPRuleModel(cmd *cobra.Command) (*waitingroom.IPRuleModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewIPRuleModel(redisc, config), nil
+}
+
+func addIPRule(action string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		domain, _ := cmd.Flags().GetString("domain")
+		reason, _ := cmd.Flags().GetString("reason")
+		rules := []*waitingroom.IPRule{}
+		validate := validator.New()
+		for _, c := range args {
+			r := &waitingroom.IPRule{CIDR: c, Domain: domain, Action: action, Reason: reason}
+			if err := validate.Struct(r); err != nil {
+				return fmt.Errorf("invalid rule %s: %w", c, err)
+			}
+			rules = append(rules, r)
+		}
+
+		m, err := newIPRuleModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			if err := m.SaveIPRule(cmd.Context(), r); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s ip rule: %s\n", action, r.ID)
+		}
+		return nil
+	}
+}
+
+var ipruleAllowCmd = &cobra.Command{
+	Use:   "allow <cidr>...",
+	Short: "let clients bypass the waiting room",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  addIPRule(waitingroom.IPRuleAllow),
+}
+
+var ipruleDenyCmd = &cobra.Command{
+	Use:   "deny <cidr>...",
+	Short: "reject clients with 403",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  addIPRule(waitingroom.IPRuleDeny),
+}
+
+var ipruleRmCmd = &cobra.Command{
+	Use:   "rm <id>...",
+	Short: "remove ip rules(id is <cidr> or <cidr>@<domain>)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newIPRuleModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, id := range args {
+			if err := m.DeleteIPRule(cmd.Context(), id); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed ip rule: %s\n", id)
+		}
+		return nil
+	},
+}
+
+var ipruleLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list ip rules",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newIPRuleModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		list, _, err := m.GetIPRules(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+
+		rows := [][]string{}
+		for _, r := range list {
+			domain := r.Domain
+			if domain == "" {
+				domain = "*"
+			}
+			rows = append(rows, []string{r.ID, r.CIDR, domain, r.Action, r.Reason})
+		}
+		return printOutput(cmd, list, []string{"ID", "CIDR", "DOMAIN", "ACTION", "REASON"}, rows)
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{ipruleAllowCmd, ipruleDenyCmd} {
+		c.Flags().String("domain", "", "apply only to this domain, default is all domains")
+		c.Flags().String("reason", "", "reason for the rule")
+	}
+	ipruleLsCmd.Flags().Int64("page", 1, "page")
+	ipruleLsCmd.Flags().Int64("per-page", 100, "per page")
+
+	ipruleCmd.AddCommand(ipruleAllowCmd)
+	ipruleCmd.AddCommand(ipruleDenyCmd)
+	ipruleCmd.AddCommand(ipruleRmCmd)
+	ipruleCmd.AddCommand(ipruleLsCmd)
+	rootCmd.AddCommand(ipruleCmd)
+}
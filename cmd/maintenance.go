@@ -0,0 +1,170 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// maintenanceCmd represents the maintenance command
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "manage maintenances",
+	Long:  `It is managing domains which are closed for maintenance.`,
+}
+
+func newMaintenanceModel(cmd *cobra.Command) (*waitingroom.MaintenanceModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewMaintenanceModel(redisc, config), nil
+}
+
+// RFC3339形式の日時フラグを読む。未指定ならnilを返す
+func timeFlag(cmd *cobra.Command, name string) (*time.Time, error) {
+	v, err := cmd.Flags().GetString(name)
+	if err != nil || v == "" {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return &t, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+var maintenanceSetCmd = &cobra.Command{
+	Use:   "set <domain>",
+	Short: "start or schedule maintenance",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, _ := cmd.Flags().GetString("message")
+		startAt, err := timeFlag(cmd, "start")
+		if err != nil {
+			return err
+		}
+		endAt, err := timeFlag(cmd, "end")
+		if err != nil {
+			return err
+		}
+		m := &waitingroom.Maintenance{
+			Domain:  args[0],
+			Message: message,
+			StartAt: startAt,
+			EndAt:   endAt,
+		}
+		if err := validator.New().Struct(m); err != nil {
+			return fmt.Errorf("invalid domain %s: %w", m.Domain, err)
+		}
+
+		model, err := newMaintenanceModel(cmd)
+		if err != nil {
+			return err
+		}
+		if err := model.SaveMaintenance(cmd.Context(), m); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "set maintenance: %s\n", m.Domain)
+		return nil
+	},
+}
+
+var maintenanceRmCmd = &cobra.Command{
+	Use:   "rm <domain>...",
+	Short: "end maintenance",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newMaintenanceModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, d := range args {
+			if err := m.DeleteMaintenance(cmd.Context(), d); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed maintenance: %s\n", d)
+		}
+		return nil
+	},
+}
+
+var maintenanceLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list maintenances",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newMaintenanceModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		list, _, err := m.GetMaintenances(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		rows := [][]string{}
+		for _, v := range list {
+			rows = append(rows, []string{
+				v.Domain,
+				fmt.Sprint(v.Active(now)),
+				formatTime(v.StartAt),
+				formatTime(v.EndAt),
+				v.Message,
+			})
+		}
+		return printOutput(cmd, list, []string{"DOMAIN", "ACTIVE", "START_AT", "END_AT", "MESSAGE"}, rows)
+	},
+}
+
+func init() {
+	maintenanceSetCmd.Flags().String("message", "", "message shown on the waiting page")
+	maintenanceSetCmd.Flags().String("start", "", "start time(RFC3339), default is now")
+	maintenanceSetCmd.Flags().String("end", "", "planned end time(RFC3339), maintenance ends automatically")
+	maintenanceLsCmd.Flags().Int64("page", 1, "page")
+	maintenanceLsCmd.Flags().Int64("per-page", 100, "per page")
+
+	maintenanceCmd.AddCommand(maintenanceSetCmd)
+	maintenanceCmd.AddCommand(maintenanceRmCmd)
+	maintenanceCmd.AddCommand(maintenanceLsCmd)
+	rootCmd.AddCommand(maintenanceCmd)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "move redis keys in the legacy layout to the current layout",
+	Long: `It copies redis keys in the legacy layout to the current layout and saves the schema version.
+It is safe to run while the service is running and can be run repeatedly.
+Keep the legacy keys until no instances of the previous version remain, then run it again with --delete-legacy.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		deleteLegacy, err := cmd.Flags().GetBool("delete-legacy")
+		if err != nil {
+			return err
+		}
+
+		redisc, err := newRedisClient(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		m := repository.NewMigrator(redisc, repository.Keys())
+		migrations, err := m.Plan(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if err := m.Apply(cmd.Context(), migrations, deleteLegacy); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "migrated %d keys to schema version %d\n", len(migrations), repository.SchemaVersion)
+		}
+
+		rows := make([][]string, 0, len(migrations))
+		for _, mg := range migrations {
+			rows = append(rows, []string{mg.From, mg.To, mg.Method})
+		}
+		return printOutput(cmd, migrations, []string{"FROM", "TO", "METHOD"}, rows)
+	},
+}
+
+func init() {
+	migrateCmd.Flags().Bool("dry-run", false, "show keys to migrate without changing them")
+	migrateCmd.Flags().Bool("delete-legacy", false, "delete legacy keys after migrating them")
+	rootCmd.AddCommand(migrateCmd)
+}
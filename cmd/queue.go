@@ -0,0 +1,238 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// queueCmd represents the queue command
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "manage queues",
+	Long:  `It is managing waitingroom queues in redis.`,
+}
+
+func newQueueModel(cmd *cobra.Command) (*waitingroom.QueueModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewQueueModel(redisc, config), nil
+}
+
+func queueRows(queues []waitingroom.Queue) [][]string {
+	rows := [][]string{}
+	for _, q := range queues {
+		var max int64
+		var closed bool
+		if q.MaxSerialNumber != nil {
+			max = *q.MaxSerialNumber
+		}
+		if q.Closed != nil {
+			closed = *q.Closed
+		}
+		rows = append(rows, []string{
+			q.Domain,
+			strconv.FormatBool(q.PermitetdNumber >= 0),
+			strconv.FormatInt(q.CurrentNumber, 10),
+			strconv.FormatInt(q.PermitetdNumber, 10),
+			strconv.FormatInt(max, 10),
+			strconv.FormatInt(q.IssuedNumber, 10),
+			strconv.FormatBool(closed),
+			strconv.FormatBool(q.SoldOut),
+		})
+	}
+	return rows
+}
+
+var queueHeader = []string{"DOMAIN", "ENABLED", "CURRENT_NO", "PERMITTED_NO", "MAX_SERIAL_NO", "ISSUED_NO", "CLOSED", "SOLD_OUT"}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list enabled queues",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		queues, _, err := m.GetQueues(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+		return printOutput(cmd, queues, queueHeader, queueRows(queues))
+	},
+}
+
+var queueShowCmd = &cobra.Command{
+	Use:   "show <domain>",
+	Short: "show queue status",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+		q, err := m.GetQueue(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		return printOutput(cmd, q, queueHeader, queueRows([]waitingroom.Queue{*q}))
+	},
+}
+
+var queueEnableCmd = &cobra.Command{
+	Use:   "enable <domain>",
+	Short: "enable queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+		if err := m.EnableQueue(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "enabled queue: %s\n", args[0])
+		return nil
+	},
+}
+
+var queueResetCmd = &cobra.Command{
+	Use:   "reset <domain>",
+	Short: "reset and disable queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+		if err := m.DeleteQueues(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "reset queue: %s\n", args[0])
+		return nil
+	},
+}
+
+var queueSetCmd = &cobra.Command{
+	Use:   "set <domain>",
+	Short: "set current and permitted number",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+
+		q, err := m.GetQueue(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("current") {
+			q.CurrentNumber, _ = cmd.Flags().GetInt64("current")
+		}
+		if cmd.Flags().Changed("permitted") {
+			q.PermitetdNumber, _ = cmd.Flags().GetInt64("permitted")
+		}
+		if q.PermitetdNumber < 0 {
+			return fmt.Errorf("queue is not enabled: %s", args[0])
+		}
+
+		if err := m.UpdateQueues(cmd.Context(), q); err != nil {
+			return err
+		}
+		return printOutput(cmd, q, queueHeader, queueRows([]waitingroom.Queue{*q}))
+	},
+}
+
+var queueLimitCmd = &cobra.Command{
+	Use:   "limit <domain>",
+	Short: "set max serial number and close or open entry",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("close") && cmd.Flags().Changed("open") {
+			return fmt.Errorf("--close and --open can't be used together")
+		}
+
+		m, err := newQueueModel(cmd)
+		if err != nil {
+			return err
+		}
+		q, err := m.GetQueue(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		max, closed := *q.MaxSerialNumber, *q.Closed
+		if cmd.Flags().Changed("max") {
+			max, _ = cmd.Flags().GetInt64("max")
+		}
+		if max < 0 {
+			return fmt.Errorf("invalid max serial number: %d", max)
+		}
+		if cmd.Flags().Changed("close") {
+			closed = true
+		}
+		if cmd.Flags().Changed("open") {
+			closed = false
+		}
+
+		if err := m.SaveQueueLimit(cmd.Context(), q.Domain, max, closed); err != nil {
+			return err
+		}
+		q, err = m.GetQueue(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		return printOutput(cmd, q, queueHeader, queueRows([]waitingroom.Queue{*q}))
+	},
+}
+
+func init() {
+	queueListCmd.Flags().Int64("page", 1, "page")
+	queueListCmd.Flags().Int64("per-page", 100, "per page")
+	queueSetCmd.Flags().Int64("current", 0, "current number")
+	queueSetCmd.Flags().Int64("permitted", 0, "permitted number")
+	queueLimitCmd.Flags().Int64("max", 0, "max serial number(0 is unlimited)")
+	queueLimitCmd.Flags().Bool("close", false, "close entry")
+	queueLimitCmd.Flags().Bool("open", false, "reopen entry")
+
+	queueCmd.AddCommand(queueListCmd)
+	queueCmd.AddCommand(queueShowCmd)
+	queueCmd.AddCommand(queueEnableCmd)
+	queueCmd.AddCommand(queueResetCmd)
+	queueCmd.AddCommand(queueSetCmd)
+	queueCmd.AddCommand(queueLimitCmd)
+	rootCmd.AddCommand(queueCmd)
+}
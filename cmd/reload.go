@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/viper"
+)
+
+// エディタの保存で連続して発生するイベントをまとめる時間
+const configReloadDebounce = 500 * time.Millisecond
+
+type configReceiver interface {
+	SetConfig(*waitingroom.Config)
+}
+
+// 共有設定で上書きする前の、設定ファイルの値も受け取る
+type fileConfigReceiver interface {
+	SetFileConfig(*waitingroom.Config)
+}
+
+// 設定ファイルの変更とSIGHUP、Redisに保存された設定の変更を契機に設定を組み立て直し、各コンポーネントへ反映する
+type configReloader struct {
+	mu         sync.Mutex
+	fileConfig *waitingroom.Config
+	settings   *waitingroom.Settings
+	config     *waitingroom.Config
+	logLevel   *slog.LevelVar
+	receivers  []configReceiver
+}
+
+func newConfigReloader(config *waitingroom.Config, logLevel *slog.LevelVar, receivers ...configReceiver) *configReloader {
+	return &configReloader{
+		fileConfig: config,
+		settings:   &waitingroom.Settings{},
+		config:     config,
+		logLevel:   logLevel,
+		receivers:  receivers,
+	}
+}
+
+func (r *configReloader) SettingVersion() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.settings.Version
+}
+
+func (r *configReloader) reload() error {
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("config file read error: %w", err)
+	}
+	config, err := unmarshalConfig()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apply(config, r.settings, "config reloaded", true)
+}
+
+func (r *configReloader) ApplySettings(settings *waitingroom.Settings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 共有設定の変更は、保存したインスタンスが通知する
+	return r.apply(r.fileConfig, settings, fmt.Sprintf("settings version %d applied", settings.Version), false)
+}
+
+func (r *configReloader) apply(fileConfig *waitingroom.Config, settings *waitingroom.Settings, message string, notify bool) error {
+	config := fileConfig.WithSettings(settings)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	r.fileConfig = fileConfig
+	r.settings = settings
+	for _, receiver := range r.receivers {
+		if fr, ok := receiver.(fileConfigReceiver); ok {
+			fr.SetFileConfig(fileConfig)
+		}
+	}
+	diff := r.config.Diff(config)
+	if len(diff) == 0 {
+		slog.Info("config is not changed")
+		return nil
+	}
+
+	for _, name := range r.config.RestartRequiredChanges(config) {
+		slog.Warn("config change requires restart", slog.String("field", name))
+	}
+
+	r.logLevel.Set(level)
+	for _, receiver := range r.receivers {
+		receiver.SetConfig(config)
+	}
+	r.config = config
+
+	slog.Info(message, slog.Any("changes", diff))
+	if !notify {
+		return nil
+	}
+	if err := waitingroom.NotifySlack(config, "WaitingRoom "+message, strings.Join(diff, "\n")); err != nil {
+		slog.Error("can't notify config change", slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// Redisの設定の変更を監視して反映し、適用中のバージョンをハートビートで報告する
+// 停止後に設定を反映しないよう、監視が終わるまで戻らない
+func (r *configReloader) WatchSettings(ctx context.Context, model *waitingroom.SettingModel, instance *waitingroom.Instance) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := model.Watch(ctx, waitingroom.InstanceHeartbeatInterval, r.SettingVersion(), func(settings *waitingroom.Settings) {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := r.ApplySettings(settings); err != nil {
+				slog.Error("can't apply settings, keep current config", slog.Int64("version", settings.Version), slog.String("error", err.Error()))
+			}
+		})
+		if err != nil {
+			slog.Error("error settings watcher", slog.String("error", err.Error()))
+		}
+	}()
+
+	ticker := time.NewTicker(waitingroom.InstanceHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		instance.SettingVersion = r.SettingVersion()
+		if err := model.Heartbeat(ctx, instance); err != nil {
+			slog.Error("can't send heartbeat", slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// viperはスレッドセーフではないため、ファイル変更とシグナルを1つのゴルーチンで処理する
+func (r *configReloader) Run(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	var errs chan error
+	path := viper.ConfigFileUsed()
+	if path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		// エディタやConfigMapはファイルを置き換えるため、ディレクトリを監視する
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	timer := time.NewTimer(configReloadDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	reload := func(trigger string) {
+		slog.Info("reloading config", slog.String("trigger", trigger))
+		if err := r.reload(); err != nil {
+			slog.Error("can't reload config, keep current config", slog.String("error", err.Error()))
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload("SIGHUP")
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(path) && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+				timer.Reset(configReloadDebounce)
+			}
+		case <-timer.C:
+			reload("file")
+		case err, ok := <-errs:
+			if !ok {
+				return nil
+			}
+			slog.Error("config watcher error", slog.String("error", err.Error()))
+		}
+	}
+}
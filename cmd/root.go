@@ -22,9 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/pyama86/waitingroom/repository"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -52,12 +56,13 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.waitingroom)")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "output format(table,json)")
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" {
-		fmt.Printf("readconfig from: %s\n", cfgFile)
+		fmt.Fprintf(os.Stderr, "readconfig from: %s\n", cfgFile)
 		viper.SetConfigFile(cfgFile)
 	} else {
 		home, err := homedir.Dir()
@@ -70,6 +75,39 @@ func initConfig() {
 	}
 }
 
+func newRedisClient(ctx context.Context) (*redis.Client, error) {
+	redisDB := 0
+	if os.Getenv("REDIS_DB") != "" {
+		ai, err := strconv.Atoi(os.Getenv("REDIS_DB"))
+		if err != nil {
+			return nil, err
+		}
+		redisDB = ai
+	}
+
+	redisHost := getEnv("REDIS_HOST", "127.0.0.1")
+	redisPort := getEnv("REDIS_PORT", "6379")
+	redisOptions := redis.Options{
+		Addr: fmt.Sprintf("%s:%s", redisHost, redisPort),
+		DB:   redisDB,
+	}
+
+	if os.Getenv("REDIS_PASSWORD") != "" {
+		redisOptions.Password = os.Getenv("REDIS_PASSWORD")
+	}
+
+	// 同じRedisを他の用途と共有する場合に、キーの接頭辞を変更する
+	if err := repository.SetKeyPrefix(getEnv("REDIS_KEY_PREFIX", repository.DefaultKeyPrefix)); err != nil {
+		return nil, err
+	}
+
+	redisc := redis.NewClient(&redisOptions)
+	if _, err := redisc.Ping(ctx).Result(); err != nil {
+		return nil, err
+	}
+	return redisc, nil
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
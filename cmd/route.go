@@ -0,0 +1,145 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// routeCmd represents the route command
+var routeCmd = &cobra.Command{
+	Use:   "route",
+	Short: "manage routes",
+	Long:  `It is managing path prefix rules which split a domain into separate queues.`,
+}
+
+func newRouteModel(cmd *cobra.Command) (*waitingroom.RouteModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewRouteModel(redisc, config), nil
+}
+
+var routeSetCmd = &cobra.Command{
+	Use:   "set <domain>",
+	Short: "replace route rules of the domain",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, _ := cmd.Flags().GetStringArray("rule")
+		r := &waitingroom.Route{
+			Domain: args[0],
+			Rules:  []waitingroom.RouteRule{},
+		}
+		for _, v := range rules {
+			name, prefix, ok := strings.Cut(v, "=")
+			if !ok {
+				return fmt.Errorf("invalid --rule %s: must be <name>=<prefix>", v)
+			}
+			r.Rules = append(r.Rules, waitingroom.RouteRule{Name: name, Prefix: prefix})
+		}
+		if err := validator.New().Struct(r); err != nil {
+			return fmt.Errorf("invalid route %s: %w", r.Domain, err)
+		}
+
+		m, err := newRouteModel(cmd)
+		if err != nil {
+			return err
+		}
+		if err := m.SaveRoute(cmd.Context(), r); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "set route: %s\n", r.Domain)
+		return nil
+	},
+}
+
+var routeRmCmd = &cobra.Command{
+	Use:   "rm <domain>...",
+	Short: "remove route rules",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newRouteModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, d := range args {
+			if err := m.DeleteRoute(cmd.Context(), d); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed route: %s\n", d)
+		}
+		return nil
+	},
+}
+
+var routeLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list routes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newRouteModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		list, _, err := m.GetRoutes(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+
+		rows := [][]string{}
+		for _, v := range list {
+			for _, rule := range v.Rules {
+				rows = append(rows, []string{
+					v.Domain,
+					rule.Name,
+					rule.Prefix,
+					waitingroom.QueueKey{Domain: v.Domain, Rule: &rule}.String(),
+				})
+			}
+		}
+		return printOutput(cmd, list, []string{"DOMAIN", "NAME", "PREFIX", "QUEUE"}, rows)
+	},
+}
+
+func init() {
+	routeSetCmd.Flags().StringArray("rule", nil, "route rule as <name>=<prefix>, can be repeated")
+	routeLsCmd.Flags().Int64("page", 1, "page")
+	routeLsCmd.Flags().Int64("per-page", 100, "per page")
+
+	routeCmd.AddCommand(routeSetCmd)
+	routeCmd.AddCommand(routeRmCmd)
+	routeCmd.AddCommand(routeLsCmd)
+	rootCmd.AddCommand(routeCmd)
+}
@@ -23,17 +23,17 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/go-playground/validator/v10"
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/securecookie"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -41,6 +41,7 @@ import (
 	"github.com/pyama86/waitingroom/api"
 	"github.com/pyama86/waitingroom/docs"
 	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/pyama86/waitingroom/repository"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	echoSwagger "github.com/swaggo/echo-swagger"
@@ -80,32 +81,41 @@ var serverCmd = &cobra.Command{
 	Short: "starting waitingroom server",
 	Long:  `It is starting waitingroom servercommand.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		config := waitingroom.Config{}
-
-		viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-		viper.SetEnvPrefix("WAITINGROOM")
-		viper.AutomaticEnv()
-		viper.SetConfigType("toml")
-		if err := viper.ReadInConfig(); err == nil {
-			fmt.Println("Using config file:", viper.ConfigFileUsed())
-		} else {
-			fmt.Printf("config file read error: %s", err)
-		}
-
-		if err := viper.Unmarshal(&config); err != nil {
-			log.Fatal(err)
-		}
-
-		validate := validator.New(validator.WithRequiredStructEnabled())
-		if err := validate.Struct(config); err != nil {
+		config, err := loadConfig()
+		if err != nil {
 			log.Fatal(err)
 		}
-		if err := runServer(cmd, &config); err != nil {
+		if err := runServer(cmd, config); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
+func loadConfig() (*waitingroom.Config, error) {
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.SetEnvPrefix("WAITINGROOM")
+	viper.AutomaticEnv()
+	viper.SetConfigType("toml")
+	if err := viper.ReadInConfig(); err == nil {
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	} else {
+		fmt.Fprintf(os.Stderr, "config file read error: %s\n", err)
+	}
+	return unmarshalConfig()
+}
+
+func unmarshalConfig() (*waitingroom.Config, error) {
+	config := waitingroom.Config{}
+	if err := viper.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
 func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	e := echo.New()
 
@@ -140,19 +150,12 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 		},
 	}))
 
-	logLevel := slog.LevelInfo
-	switch config.LogLevel {
-	case "info":
-		logLevel = slog.LevelInfo
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		return fmt.Errorf("invalid log level: %s", config.LogLevel)
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return err
 	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
 
 	ops := slog.HandlerOptions{
 		Level: logLevel,
@@ -167,6 +170,16 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// バックグラウンドのワーカーはctxのキャンセルで止まる
+	var workers sync.WaitGroup
+	goWorker := func(f func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			f()
+		}()
+	}
+
 	if config.EnableOtel {
 		cleanup, err := setupOtelProvider(ctx, "waitingroom", "0.0.1")
 		if err != nil {
@@ -179,36 +192,24 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	}
 
 	slog.Info(fmt.Sprintf("server config: %#v", config))
-	redisDB := 0
-	if os.Getenv("REDIS_DB") != "" {
-		ai, err := strconv.Atoi(os.Getenv("REDIS_DB"))
-		if err != nil {
-			return err
-		}
-		redisDB = ai
-	}
-
-	redisHost := getEnv("REDIS_HOST", "127.0.0.1")
-	redisPort := getEnv("REDIS_PORT", "6379")
-	redisOptions := redis.Options{
-		Addr: fmt.Sprintf("%s:%s", redisHost, redisPort),
-		DB:   redisDB,
-	}
-
-	if os.Getenv("REDIS_PASSWORD") != "" {
-		redisOptions.Password = os.Getenv("REDIS_PASSWORD")
+	redisc, err := newRedisClient(ctx)
+	if err != nil {
+		return err
 	}
 
-	redisc := redis.NewClient(&redisOptions)
-	_, err := redisc.Ping(ctx).Result()
+	// 以前の配置のデータを読まずに起動すると、待っている利用者の番号や許可が失われるため起動しない
+	required, err := repository.CheckSchema(ctx, redisc, repository.Keys())
 	if err != nil {
 		return err
 	}
+	if required {
+		return fmt.Errorf("redis keys in the legacy layout were found, run `waitingroom migrate` before starting (prefix: %s)", repository.Keys().Prefix)
+	}
 
 	e.Use(middleware.Recover())
 
 	e.GET("/status", func(c echo.Context) error {
-		_, err := redisc.Ping(ctx).Result()
+		_, err := redisc.Ping(c.Request().Context()).Result()
 		if err != nil {
 			return c.String(http.StatusInternalServerError, err.Error())
 		}
@@ -224,6 +225,16 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	e.GET("/queues/:domain", h.Check)
 	e.GET("/queues/:domain/:enable", h.Check)
 
+	pageRenderer := waitingroom.NewPageRenderer(config, repository.NewPageRepository(redisc))
+	ph := api.NewPageHandler(secureCookie, redisc, config, pageRenderer)
+	e.GET("/pages/:domain", ph.Show)
+	e.GET("/pages/:domain/assets/:file", ph.Asset)
+	goWorker(func() {
+		if err := pageRenderer.Watch(ctx); err != nil {
+			slog.Error("error template watcher", slog.String("error", err.Error()))
+		}
+	})
+
 	v1 := e.Group("/v1")
 	api.VironEndpoints(v1)
 	v1.GET("/queues", h.GetQueues)
@@ -231,7 +242,21 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	v1.DELETE("/queues/:domain", h.DeleteQueueByName)
 	v1.POST("/queues", h.CreateQueue)
 
-	api.VironWhiteListEndpoints(v1, redisc)
+	pmh := api.VironPageEndpoints(v1, redisc, config, pageRenderer)
+	// 管理APIも判定と同じキャッシュを持つため、設定の再読み込みとキャッシュの破棄を反映する
+	operators := []interface {
+		configReceiver
+		WatchInvalidations(context.Context) error
+	}{
+		api.VironWhiteListEndpoints(v1, redisc, config),
+		api.VironMaintenanceEndpoints(v1, redisc, config),
+		api.VironRouteEndpoints(v1, redisc, config),
+		api.VironGroupEndpoints(v1, redisc, config),
+		api.VironIPRuleEndpoints(v1, redisc, config),
+	}
+
+	sh := api.NewSettingHandler(redisc, config)
+	sh.RegisterEndpoints(v1)
 
 	docs.SwaggerInfo.Host = config.PublicHost
 	dev, err := cmd.PersistentFlags().GetBool("dev")
@@ -252,37 +277,115 @@ func runServer(cmd *cobra.Command, config *waitingroom.Config) error {
 	}
 	v1.GET("/swagger/*", echoSwagger.WrapHandler)
 	e.Use(middleware.CORS())
+
+	ac := waitingroom.NewAccessController(
+		config,
+		redisc,
+	)
+
+	// 起動時にRedisに保存された設定を適用してから受付を開始する
+	receivers := []configReceiver{h, ph, pageRenderer, pmh, ac, sh}
+	watchers := []interface{ WatchInvalidations(context.Context) error }{h, ph, ac}
+	for _, o := range operators {
+		receivers = append(receivers, o)
+		watchers = append(watchers, o)
+	}
+	reloader := newConfigReloader(config, logLevel, receivers...)
+	settingModel := waitingroom.NewSettingModel(redisc, config)
+	settings, err := settingModel.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if err := reloader.ApplySettings(settings); err != nil {
+		slog.Error("can't apply settings, use config file", slog.Int64("version", settings.Version), slog.String("error", err.Error()))
+	}
+
+	health := api.NewHealthHandler(redisc, ac, reloader.SettingVersion)
+	e.GET("/healthz", health.Healthz)
+	e.GET("/readyz", health.Readyz)
+
+	instance := &waitingroom.Instance{
+		ID:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		Hostname:  hostname,
+		StartedAt: time.Now(),
+	}
+	goWorker(func() { reloader.WatchSettings(ctx, settingModel, instance) })
+	goWorker(func() {
+		if err := reloader.Run(ctx); err != nil {
+			slog.Error("error config watcher", slog.String("error", err.Error()))
+		}
+	})
+
 	go func() {
 		if err := e.Start(config.Listener); err != nil && err != http.ErrServerClosed {
 			log.Fatal("shutting down the server", err)
 		}
 	}()
 
-	go func() {
-		ac := waitingroom.NewAccessController(
-			config,
-			redisc,
-		)
-		for {
-			if err := ac.Do(ctx, e); err != nil && err != redis.Nil {
-				slog.Error(
-					"error permit worker",
-					slog.String("error", err.Error()),
-				)
+	goWorker(func() { ac.Run(ctx, e) })
+	goWorker(func() { ac.RunGC(ctx) })
+	for _, w := range watchers {
+		goWorker(func() {
+			if err := w.WatchInvalidations(ctx); err != nil {
+				slog.Error("error cache invalidation watcher", slog.String("error", err.Error()))
 			}
-			time.Sleep(time.Duration(config.PermitIntervalSec) * time.Second)
-		}
-	}()
+		})
+	}
+	health.SetReady(true)
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	qctx, qcancel := context.WithTimeout(ctx, 10*time.Second)
-	defer qcancel()
-	if err := e.Shutdown(qctx); err != nil {
-		return err
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	signal.Stop(quit)
+	return shutdown(e, health, ac.Config(), sig, func(ctx context.Context) error {
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return fmt.Errorf("workers did not stop: %w", ctx.Err())
+		}
+		// 停止したインスタンスとして表示されないよう、ワーカーが止まってから消す
+		return settingModel.DeleteInstance(ctx, instance.ID)
+	})
+}
+
+// 受付不可を返してからリクエストの振り分けが止まるのを待ち、処理中のリクエストとワーカーを止める
+func shutdown(e *echo.Echo, health *api.HealthHandler, config *waitingroom.Config, sig os.Signal, stopWorkers func(context.Context) error) error {
+	slog.Info("shutting down", slog.String("signal", sig.String()))
+	health.SetReady(false)
+	time.Sleep(time.Duration(config.ShutdownDelaySec) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeoutSec)*time.Second)
+	defer cancel()
+
+	var ret []error
+	if err := e.Shutdown(ctx); err != nil {
+		ret = append(ret, fmt.Errorf("can't shutdown server: %w", err))
+	}
+	if err := stopWorkers(ctx); err != nil {
+		ret = append(ret, err)
+	}
+	slog.Info("shutdown completed")
+	return errors.Join(ret...)
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch level {
+	case "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
 	}
-	return nil
+	return slog.LevelInfo, fmt.Errorf("invalid log level: %s", level)
 }
 
 func init() {
@@ -307,7 +410,17 @@ func init() {
 	viper.SetDefault("queue_enable_sec", 300)
 	viper.SetDefault("permit_interval_sec", 60)
 	viper.SetDefault("permit_unit_number", 1000)
+	viper.SetDefault("permit_worker_concurrency", 8)
+	viper.SetDefault("shutdown_delay_sec", 5)
+	viper.SetDefault("shutdown_timeout_sec", 30)
+	viper.SetDefault("readiness_redis_failure_sec", 10)
+	viper.SetDefault("circuit_breaker_threshold", 5)
+	viper.SetDefault("circuit_breaker_open_sec", 10)
+	viper.SetDefault("throttle_window_sec", 60)
+	viper.SetDefault("challenge_ttl_sec", 300)
 	viper.SetDefault("public_host", "localhost:18080")
+	serverCmd.PersistentFlags().String("template-dir", "", "waiting page template directory")
+	viper.BindPFlag("template_dir", serverCmd.PersistentFlags().Lookup("template-dir"))
 	viper.BindEnv("slack_api_token", "SLACK_API_TOKEN")
 	viper.BindEnv("slack_channel", "SLACK_CHANNEL")
 	rootCmd.AddCommand(serverCmd)
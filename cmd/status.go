@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/spf13/cobra"
+)
+
+type status struct {
+	Redis            string `json:"redis"`
+	RedisLatencyMs   int64  `json:"redis_latency_ms"`
+	EnabledQueues    int64  `json:"enabled_queues"`
+	WhiteListDomains int64  `json:"whitelist_domains"`
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show waitingroom status",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		redisc, err := newRedisClient(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		if err := redisc.Ping(cmd.Context()).Err(); err != nil {
+			return err
+		}
+		latency := time.Since(start)
+
+		repo := repository.NewWaitingroomRepository(redisc)
+		queues, err := repo.GetEnableDomainsCount(cmd.Context())
+		if err != nil {
+			return err
+		}
+		whitelist, err := repo.GetWhiteListDomainsCount(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		s := status{
+			Redis:            redisc.Options().Addr,
+			RedisLatencyMs:   latency.Milliseconds(),
+			EnabledQueues:    queues,
+			WhiteListDomains: whitelist,
+		}
+		return printOutput(cmd, s,
+			[]string{"REDIS", "LATENCY", "ENABLED_QUEUES", "WHITELIST_DOMAINS"},
+			[][]string{{
+				s.Redis,
+				latency.String(),
+				strconv.FormatInt(s.EnabledQueues, 10),
+				strconv.FormatInt(s.WhiteListDomains, 10),
+			}},
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
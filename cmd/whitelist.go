@@ -0,0 +1,211 @@
+/*
+Copyright © 2023 pyama86
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/spf13/cobra"
+)
+
+// whitelistCmd represents the whitelist command
+var whitelistCmd = &cobra.Command{
+	Use:   "whitelist",
+	Short: "manage whitelist",
+	Long: `It is managing rules of domains which are always permitted.
+A rule is an exact domain(example.com), a suffix(*.example.com) or
+a regexp matching the whole domain(~shop[0-9]+\.example\.com),
+optionally followed by a path prefix(example.com/admin).`,
+}
+
+func newWhiteListModel(cmd *cobra.Command) (*waitingroom.WhiteListModel, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	redisc, err := newRedisClient(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	return waitingroom.NewWhiteListModel(redisc, config), nil
+}
+
+func addWhiteList(cmd *cobra.Command, m *waitingroom.WhiteListModel, rules []string) error {
+	parsed := []*waitingroom.WhiteListRule{}
+	for _, d := range rules {
+		r, err := waitingroom.ParseWhiteListRule(d)
+		if err != nil {
+			return err
+		}
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		parsed = append(parsed, r)
+	}
+
+	expireAt, err := timeFlag(cmd, "expire")
+	if err != nil {
+		return err
+	}
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	if expireAt == nil && ttl > 0 {
+		t := time.Now().Add(ttl)
+		expireAt = &t
+	}
+	reason, _ := cmd.Flags().GetString("reason")
+	by, _ := cmd.Flags().GetString("by")
+
+	for _, r := range parsed {
+		w := &waitingroom.WhiteList{
+			Domain:    r.Pattern,
+			Path:      r.Path,
+			ExpireAt:  expireAt,
+			Reason:    reason,
+			CreatedBy: by,
+		}
+		if err := m.CreateWhiteList(cmd.Context(), w); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "added whitelist: %s\n", r)
+	}
+	return nil
+}
+
+// 一時的な許可のための有効期限と、登録の経緯を指定するフラグ
+func addWhiteListFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("ttl", 0, "remove rules after this duration(e.g. 1h)")
+	cmd.Flags().String("expire", "", "remove rules at this time(RFC3339)")
+	cmd.Flags().String("reason", "", "reason for adding rules")
+	cmd.Flags().String("by", os.Getenv("USER"), "creator of rules")
+}
+
+var whitelistAddCmd = &cobra.Command{
+	Use:   "add <rule>...",
+	Short: "add rules to whitelist",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newWhiteListModel(cmd)
+		if err != nil {
+			return err
+		}
+		return addWhiteList(cmd, m, args)
+	},
+}
+
+var whitelistRmCmd = &cobra.Command{
+	Use:   "rm <rule>...",
+	Short: "remove rules from whitelist",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newWhiteListModel(cmd)
+		if err != nil {
+			return err
+		}
+		for _, d := range args {
+			if err := m.DeleteWhiteList(cmd.Context(), d); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed whitelist: %s\n", d)
+		}
+		return nil
+	},
+}
+
+var whitelistLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list whitelist",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newWhiteListModel(cmd)
+		if err != nil {
+			return err
+		}
+		page, _ := cmd.Flags().GetInt64("page")
+		perPage, _ := cmd.Flags().GetInt64("per-page")
+
+		list, _, err := m.GetWhiteList(cmd.Context(), perPage, page)
+		if err != nil {
+			return err
+		}
+
+		rows := [][]string{}
+		for _, w := range list {
+			rows = append(rows, []string{w.Domain, w.Path, w.Type, formatTime(w.ExpireAt), w.Reason, w.CreatedBy})
+		}
+		return printOutput(cmd, list, []string{"DOMAIN", "PATH", "TYPE", "EXPIRE_AT", "REASON", "CREATED_BY"}, rows)
+	},
+}
+
+var whitelistImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "import rules from file(one rule per line, - is stdin)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var r io.Reader = cmd.InOrStdin()
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		domains := []string{}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			l := strings.TrimSpace(scanner.Text())
+			if l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+			domains = append(domains, l)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		m, err := newWhiteListModel(cmd)
+		if err != nil {
+			return err
+		}
+		return addWhiteList(cmd, m, domains)
+	},
+}
+
+func init() {
+	addWhiteListFlags(whitelistAddCmd)
+	addWhiteListFlags(whitelistImportCmd)
+	whitelistLsCmd.Flags().Int64("page", 1, "page")
+	whitelistLsCmd.Flags().Int64("per-page", 100, "per page")
+
+	whitelistCmd.AddCommand(whitelistAddCmd)
+	whitelistCmd.AddCommand(whitelistRmCmd)
+	whitelistCmd.AddCommand(whitelistLsCmd)
+	whitelistCmd.AddCommand(whitelistImportCmd)
+	rootCmd.AddCommand(whitelistCmd)
+}
@@ -19,6 +19,685 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/groups": {
+            "get": {
+                "description": "get groups",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "get groups",
+                "operationId": "groups#get",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "per_page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.Group"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create group",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "create group",
+                "operationId": "groups#post",
+                "parameters": [
+                    {
+                        "description": "Group Object",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Group"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups/{name}": {
+            "put": {
+                "description": "update group",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "update group",
+                "operationId": "groups#put",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Group Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Group Object",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Group"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete group",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "delete group",
+                "operationId": "groups#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Group Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/iprules": {
+            "get": {
+                "description": "get ip rules",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "iprules"
+                ],
+                "summary": "get ip rules",
+                "operationId": "iprules#get",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "per_page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.IPRule"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create ip rule. domain is empty for all domains",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "iprules"
+                ],
+                "summary": "create ip rule",
+                "operationId": "iprules#post",
+                "parameters": [
+                    {
+                        "description": "IPRule Object",
+                        "name": "iprule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.IPRule"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/iprules/{id}": {
+            "delete": {
+                "description": "delete ip rule",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "iprules"
+                ],
+                "summary": "delete ip rule",
+                "operationId": "iprules#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "IPRule ID(URL encoded)",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/maintenances": {
+            "get": {
+                "description": "get maintenances",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "maintenances"
+                ],
+                "summary": "get maintenances",
+                "operationId": "maintenances#get",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "per_page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.Maintenance"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create maintenance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "maintenances"
+                ],
+                "summary": "create maintenance",
+                "operationId": "maintenances#post",
+                "parameters": [
+                    {
+                        "description": "Maintenance Object",
+                        "name": "maintenance",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Maintenance"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/maintenances/{domain}": {
+            "put": {
+                "description": "update maintenance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "maintenances"
+                ],
+                "summary": "update maintenance",
+                "operationId": "maintenances#put",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Maintenance Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Maintenance Object",
+                        "name": "maintenance",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Maintenance"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete maintenance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "maintenances"
+                ],
+                "summary": "delete maintenance",
+                "operationId": "maintenances#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Maintenance Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/pages": {
+            "get": {
+                "description": "get waiting page settings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "get pages",
+                "operationId": "pages#get",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "per_page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.Page"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create waiting page setting",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "create page",
+                "operationId": "pages#post",
+                "parameters": [
+                    {
+                        "description": "Page Object",
+                        "name": "page",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Page"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/pages/{domain}": {
+            "put": {
+                "description": "update waiting page setting",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "update page",
+                "operationId": "pages#put",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Page Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Page Object",
+                        "name": "page",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Page"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete waiting page setting",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "delete page",
+                "operationId": "pages#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Page Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
         "/queues": {
             "get": {
                 "description": "get queues",
@@ -107,20 +786,335 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created"
+                    "201": {
+                        "description": "Created"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/queues/{domain}": {
+            "put": {
+                "description": "update queue",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "queues"
+                ],
+                "summary": "update queue",
+                "operationId": "queues#put",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Queue Name",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Queue Object",
+                        "name": "queue",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Queue"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete queue",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "queues"
+                ],
+                "summary": "delete queue",
+                "operationId": "queues#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Queue Name",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/routes": {
+            "get": {
+                "description": "get routes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "get routes",
+                "operationId": "routes#get",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "per_page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.Route"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "create route",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "create route",
+                "operationId": "routes#post",
+                "parameters": [
+                    {
+                        "description": "Route Object",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Route"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/routes/{domain}": {
+            "put": {
+                "description": "update route",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "update route",
+                "operationId": "routes#put",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Route Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Route Object",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Route"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.HTTPError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "delete route",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "delete route",
+                "operationId": "routes#delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Route Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
                     },
-                    "403": {
-                        "description": "Forbidden",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/api.HTTPError"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/api.HTTPError"
                         }
+                    }
+                }
+            }
+        },
+        "/settings": {
+            "get": {
+                "description": "get settings shared across instances",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "get settings",
+                "operationId": "settings#get",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Settings"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -129,11 +1123,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/queues/{domain}": {
+            },
             "put": {
-                "description": "update queue",
+                "description": "update settings. version must be the current version",
                 "consumes": [
                     "application/json"
                 ],
@@ -141,40 +1133,36 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "queues"
+                    "settings"
                 ],
-                "summary": "update queue",
-                "operationId": "queues#put",
+                "summary": "update settings",
+                "operationId": "settings#put",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Queue Name",
-                        "name": "domain",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Queue Object",
-                        "name": "queue",
+                        "description": "Settings Object",
+                        "name": "settings",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/waitingroom.Queue"
+                            "$ref": "#/definitions/waitingroom.Settings"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/waitingroom.Settings"
+                        }
                     },
-                    "403": {
-                        "description": "Forbidden",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/api.HTTPError"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
                             "$ref": "#/definitions/api.HTTPError"
                         }
@@ -186,9 +1174,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "delete queue",
+            }
+        },
+        "/settings/instances": {
+            "get": {
+                "description": "get running instances and the settings version they apply",
                 "consumes": [
                     "application/json"
                 ],
@@ -196,33 +1186,18 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "queues"
-                ],
-                "summary": "delete queue",
-                "operationId": "queues#delete",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Queue Name",
-                        "name": "domain",
-                        "in": "path",
-                        "required": true
-                    }
+                    "settings"
                 ],
+                "summary": "get instances",
+                "operationId": "settings_instances#get",
                 "responses": {
-                    "204": {
-                        "description": "No Content"
-                    },
-                    "403": {
-                        "description": "Forbidden",
-                        "schema": {
-                            "$ref": "#/definitions/api.HTTPError"
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.HTTPError"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/waitingroom.Instance"
+                            }
                         }
                     },
                     "500": {
@@ -380,7 +1355,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/whitelist/{domain}": {
+        "/whitelist/{id}": {
             "delete": {
                 "description": "delete whiteList",
                 "consumes": [
@@ -397,8 +1372,8 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "WhiteList Domain",
-                        "name": "domain",
+                        "description": "WhiteList ID(URL encoded)",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -436,22 +1411,240 @@ const docTemplate = `{
                 "message": {}
             }
         },
+        "waitingroom.Group": {
+            "type": "object",
+            "required": [
+                "domains",
+                "name"
+            ],
+            "properties": {
+                "cookie_domain": {
+                    "description": "メンバーで共有するクッキーの親ドメイン、未指定ならドメインごと",
+                    "type": "string"
+                },
+                "domains": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 32
+                }
+            }
+        },
+        "waitingroom.IPRule": {
+            "type": "object",
+            "required": [
+                "action",
+                "cidr"
+            ],
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "allow",
+                        "deny"
+                    ]
+                },
+                "cidr": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "10.0.0.0/8@example.com。削除に使う",
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "waitingroom.Instance": {
+            "type": "object",
+            "properties": {
+                "hostname": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "setting_version": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "waitingroom.Maintenance": {
+            "type": "object",
+            "required": [
+                "domain"
+            ],
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "end_at": {
+                    "description": "終了予定日時、未指定なら解除するまで",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "待機ページに表示するメッセージ",
+                    "type": "string"
+                },
+                "start_at": {
+                    "description": "開始日時、未指定なら即時",
+                    "type": "string"
+                }
+            }
+        },
+        "waitingroom.Page": {
+            "type": "object",
+            "required": [
+                "domain"
+            ],
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "logo_url": {
+                    "description": "ロゴ画像のURL",
+                    "type": "string"
+                },
+                "messages": {
+                    "description": "言語ごとのメッセージ、defaultはフォールバック",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "template": {
+                    "description": "html/templateのソース",
+                    "type": "string"
+                }
+            }
+        },
         "waitingroom.Queue": {
             "type": "object",
             "required": [
                 "domain"
             ],
             "properties": {
+                "closed": {
+                    "description": "受付終了。省略すると変更しない",
+                    "type": "boolean"
+                },
                 "current_number": {
                     "type": "integer",
                     "minimum": 0
                 },
                 "domain": {
+                    "description": "ドメイン、またはドメイン:ルート名",
                     "type": "string"
                 },
+                "issued_number": {
+                    "description": "上限を設定してから発行した通し番号の数",
+                    "type": "integer"
+                },
+                "max_serial_number": {
+                    "description": "通し番号の発行上限、0なら上限なし。省略すると変更しない",
+                    "type": "integer",
+                    "minimum": 0
+                },
                 "permitted_number": {
                     "type": "integer",
                     "minimum": 0
+                },
+                "sold_out": {
+                    "description": "新しく通し番号を発行できない",
+                    "type": "boolean"
+                }
+            }
+        },
+        "waitingroom.Route": {
+            "type": "object",
+            "required": [
+                "domain"
+            ],
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/waitingroom.RouteRule"
+                    }
+                }
+            }
+        },
+        "waitingroom.RouteRule": {
+            "type": "object",
+            "required": [
+                "name",
+                "prefix"
+            ],
+            "properties": {
+                "name": {
+                    "description": "待合室のキーとクッキー名に使う",
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "prefix": {
+                    "type": "string"
+                }
+            }
+        },
+        "waitingroom.Settings": {
+            "type": "object",
+            "properties": {
+                "cache_ttl_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "entry_delay_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "global_permit_budget": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "negative_cache_ttl_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "permit_interval_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "permit_unit_number": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "permitted_access_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "queue_enable_sec": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "version": {
+                    "type": "integer",
+                    "minimum": 0
                 }
             }
         },
@@ -461,8 +1654,36 @@ const docTemplate = `{
                 "domain"
             ],
             "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
                 "domain": {
                     "type": "string"
+                },
+                "expire_at": {
+                    "description": "未指定なら削除するまで有効",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "パスを含むルール。削除に使う",
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "ttl_sec": {
+                    "description": "登録時にexpire_atの代わりに指定できる",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "type": {
+                    "type": "string"
                 }
             }
         }
@@ -474,6 +1695,24 @@ const docTemplate = `{
         {
             "name": "whitelist"
         },
+        {
+            "name": "pages"
+        },
+        {
+            "name": "maintenances"
+        },
+        {
+            "name": "routes"
+        },
+        {
+            "name": "groups"
+        },
+        {
+            "name": "iprules"
+        },
+        {
+            "name": "settings"
+        },
         {
             "name": "viron"
         }
@@ -0,0 +1,122 @@
+package waitingroom
+
+import "sort"
+
+const (
+	BudgetStrategyFair     = "fair"     // 重み付きで均等に配分し、待ち人数を超えた分は他の待合室に回す
+	BudgetStrategyBacklog  = "backlog"  // 待ち人数に比例して配分する
+	BudgetStrategyWeighted = "weighted" // 待ち人数に関わらず重みに比例して配分する
+)
+
+// この回数続けて配分が0だった待合室を通知する
+const starvationReportTicks = 3
+
+// 配分を決めるための待合室ごとの状態
+type budgetDemand struct {
+	Key     string
+	Backlog int64 // 通し番号を持ち、まだ許可されていないクライアントの数
+	Weight  int64
+}
+
+// 全体の許可数を待合室に配分する
+// 端数はdemandsの順に配るため、優先したい待合室を先に並べる
+func allocateBudget(strategy string, budget int64, demands []budgetDemand) map[string]int64 {
+	ret := map[string]int64{}
+	if budget <= 0 || len(demands) == 0 {
+		return ret
+	}
+
+	switch strategy {
+	case BudgetStrategyBacklog:
+		var total int64
+		for _, d := range demands {
+			total += d.Backlog
+		}
+		// 誰も待っていなければ均等に配る
+		weight := func(d budgetDemand) int64 { return d.Backlog }
+		if total == 0 {
+			weight = func(budgetDemand) int64 { return 1 }
+		}
+		return splitByWeight(budget, demands, weight)
+	case BudgetStrategyWeighted:
+		return splitByWeight(budget, demands, func(d budgetDemand) int64 { return d.Weight })
+	}
+
+	// 待ち人数を上限に重みで配り、余った分を配り切るまで繰り返す
+	need := map[string]int64{}
+	active := []budgetDemand{}
+	for _, d := range demands {
+		if d.Backlog > 0 {
+			need[d.Key] = d.Backlog
+			active = append(active, d)
+		}
+	}
+	left := budget
+	for left > 0 && len(active) > 0 {
+		shares := splitByWeight(left, active, func(d budgetDemand) int64 { return d.Weight })
+		next := []budgetDemand{}
+		for _, d := range active {
+			g := min(shares[d.Key], need[d.Key])
+			ret[d.Key] += g
+			need[d.Key] -= g
+			left -= g
+			if need[d.Key] > 0 {
+				next = append(next, d)
+			}
+		}
+		active = next
+	}
+
+	// 全員に行き渡った余りは、次の周期までに来るクライアントのために重みで配る
+	if left > 0 {
+		for k, v := range splitByWeight(left, demands, func(d budgetDemand) int64 { return d.Weight }) {
+			ret[k] += v
+		}
+	}
+	return ret
+}
+
+// 重みに比例して配り、端数は余りの大きい順、同じならdemandsの順に1ずつ配る
+func splitByWeight(amount int64, demands []budgetDemand, weight func(budgetDemand) int64) map[string]int64 {
+	ret := map[string]int64{}
+	var total int64
+	for _, d := range demands {
+		total += weight(d)
+	}
+	if total <= 0 {
+		return ret
+	}
+
+	type remainder struct {
+		index int
+		value int64
+	}
+	rs := []remainder{}
+	var given int64
+	for i, d := range demands {
+		v := amount * weight(d) / total
+		ret[d.Key] = v
+		given += v
+		rs = append(rs, remainder{index: i, value: amount * weight(d) % total})
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].value > rs[j].value
+	})
+	for i := 0; given < amount && i < len(rs); i++ {
+		if rs[i].value == 0 {
+			break
+		}
+		ret[demands[rs[i].index].Key]++
+		given++
+	}
+	return ret
+}
+
+func (c *Config) budgetWeight(key string) int64 {
+	for _, w := range c.BudgetWeights {
+		if w.Queue == key {
+			return w.Weight
+		}
+	}
+	return 1
+}
@@ -0,0 +1,164 @@
+package waitingroom
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestAllocateBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		budget   int64
+		demands  []budgetDemand
+		want     map[string]int64
+	}{
+		{
+			name:     "fair share redistributes unused share",
+			strategy: BudgetStrategyFair,
+			budget:   100,
+			demands: []budgetDemand{
+				{Key: "a", Backlog: 10, Weight: 1},
+				{Key: "b", Backlog: 1000, Weight: 1},
+				{Key: "c", Backlog: 1000, Weight: 1},
+			},
+			want: map[string]int64{"a": 10, "b": 45, "c": 45},
+		},
+		{
+			name:     "fair share with weights",
+			strategy: "",
+			budget:   100,
+			demands: []budgetDemand{
+				{Key: "a", Backlog: 1000, Weight: 3},
+				{Key: "b", Backlog: 1000, Weight: 1},
+			},
+			want: map[string]int64{"a": 75, "b": 25},
+		},
+		{
+			name:     "fair share gives surplus after all backlogs",
+			strategy: BudgetStrategyFair,
+			budget:   100,
+			demands: []budgetDemand{
+				{Key: "a", Backlog: 10, Weight: 1},
+				{Key: "b", Backlog: 0, Weight: 1},
+			},
+			want: map[string]int64{"a": 55, "b": 45},
+		},
+		{
+			name:     "proportional to backlog",
+			strategy: BudgetStrategyBacklog,
+			budget:   100,
+			demands: []budgetDemand{
+				{Key: "a", Backlog: 300, Weight: 5},
+				{Key: "b", Backlog: 100, Weight: 1},
+			},
+			want: map[string]int64{"a": 75, "b": 25},
+		},
+		{
+			name:     "fixed weights",
+			strategy: BudgetStrategyWeighted,
+			budget:   10,
+			demands: []budgetDemand{
+				{Key: "a", Backlog: 0, Weight: 2},
+				{Key: "b", Backlog: 100, Weight: 1},
+			},
+			want: map[string]int64{"a": 7, "b": 3},
+		},
+		{
+			name:     "remainder goes to the first demand",
+			strategy: BudgetStrategyFair,
+			budget:   1,
+			demands: []budgetDemand{
+				{Key: "b", Backlog: 10, Weight: 1},
+				{Key: "a", Backlog: 10, Weight: 1},
+			},
+			want: map[string]int64{"a": 0, "b": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocateBudget(tt.strategy, tt.budget, tt.demands)
+			for k := range tt.want {
+				if got[k] != tt.want[k] {
+					t.Errorf("allocateBudget() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			var total int64
+			for _, v := range got {
+				total += v
+			}
+			if total != tt.budget {
+				t.Errorf("allocateBudget() total = %v, want %v", total, tt.budget)
+			}
+		})
+	}
+}
+
+func TestAccessController_reportStarvation(t *testing.T) {
+	a := &AccessController{config: &Config{GlobalPermitBudget: 1}, starving: map[string]int{}}
+	demands := []budgetDemand{{Key: "a", Backlog: 10}, {Key: "b", Backlog: 10}, {Key: "c"}}
+
+	a.reportStarvation(demands, map[string]int64{"a": 1})
+	if !reflect.DeepEqual(a.starving, map[string]int{"b": 1}) {
+		t.Errorf("starving = %v", a.starving)
+	}
+	a.reportStarvation(demands, map[string]int64{"a": 1})
+	if !reflect.DeepEqual(a.starving, map[string]int{"b": 2}) {
+		t.Errorf("starving = %v", a.starving)
+	}
+	a.reportStarvation(demands, map[string]int64{"b": 1})
+	if !reflect.DeepEqual(a.starving, map[string]int{"a": 1}) {
+		t.Errorf("starving = %v", a.starving)
+	}
+}
+
+func TestWaitingroom_CalcRemainingWaitSecond(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	repo := repository.NewWaitingroomRepository(redisClient)
+	newDomain := func(unit int64) string {
+		domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+		redisClient.SetEX(ctx, repository.Keys().Queue(domain, "permitted_no"), 100, time.Minute)
+		if unit > 0 {
+			redisClient.SetEX(ctx, repository.Keys().Queue(domain, "permit_unit"), unit, time.Minute)
+		}
+		return domain
+	}
+
+	tests := []struct {
+		name   string
+		budget int64
+		unit   int64
+		want   int64
+	}{
+		{name: "per queue unit", unit: 10, want: 60},
+		{name: "allocated unit", budget: 50, unit: 10, want: 180},
+		{name: "not allocated yet", budget: 50, want: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				CacheTTLSec:         10,
+				NegativeCacheTTLSec: 10,
+				PermitUnitNumber:    1000,
+				PermitIntervalSec:   60,
+				GlobalPermitBudget:  tt.budget,
+			}
+			wr := NewWaitingroom(config, repo)
+			got, pn, err := wr.CalcRemainingWaitSecond(ctx, newDomain(tt.unit), 125)
+			if err != nil {
+				t.Fatalf("CalcRemainingWaitSecond() error = %v", err)
+			}
+			if got != tt.want || pn != 100 {
+				t.Errorf("CalcRemainingWaitSecond() = %v, %v, want %v, 100", got, pn, tt.want)
+			}
+		})
+	}
+}
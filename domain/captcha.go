@@ -0,0 +1,209 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// siteverify APIの種類。いずれもsecret,response,remoteipをフォームで受け取り、successを返す
+const (
+	CaptchaProviderTurnstile = "turnstile"
+	CaptchaProviderHCaptcha  = "hcaptcha"
+	CaptchaProviderReCaptcha = "recaptcha"
+)
+
+var captchaEndpoints = map[string]string{
+	CaptchaProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	CaptchaProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	CaptchaProviderReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// クライアントがウィジェットで取得したトークンを渡すクッキー
+const CaptchaCookieKey = "waiting-room-captcha"
+
+const captchaTimeout = 5 * time.Second
+
+// ドメインごとのCAPTCHAの設定
+type CaptchaPolicy struct {
+	Domain   string `mapstructure:"domain" validate:"required,fqdn"`
+	Provider string `mapstructure:"provider" validate:"required,oneof=turnstile hcaptcha recaptcha"`
+	SiteKey  string `mapstructure:"site_key" validate:"required"`
+	Secret   string `mapstructure:"secret" validate:"required"`
+	Endpoint string `mapstructure:"endpoint" validate:"omitempty,url"` // 未指定ならプロバイダのsiteverify API
+}
+
+// 設定の差分に秘密鍵を出力しない
+func (p CaptchaPolicy) String() string {
+	return fmt.Sprintf("{%s %s %s *** %s}", p.Domain, p.Provider, p.SiteKey, p.Endpoint)
+}
+
+func (c *Config) captchaPolicy(domain string) *CaptchaPolicy {
+	for i := range c.CaptchaPolicies {
+		if c.CaptchaPolicies[i].Domain == domain {
+			return &c.CaptchaPolicies[i]
+		}
+	}
+	return nil
+}
+
+// ウィジェットで取得したトークンを検証する
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// Turnstile、hCaptcha、reCAPTCHAに共通のsiteverify APIで検証する
+type SiteVerifier struct {
+	Endpoint string
+	Secret   string
+	Client   *http.Client
+}
+
+func NewSiteVerifier(p *CaptchaPolicy) *SiteVerifier {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = captchaEndpoints[p.Provider]
+	}
+	return &SiteVerifier{
+		Endpoint: endpoint,
+		Secret:   p.Secret,
+		Client:   &http.Client{Timeout: captchaTimeout},
+	}
+}
+
+// 検証のたびに作らず接続を使い回すよう、設定のドメインごとに作っておく
+func newSiteVerifiers(config *Config) map[string]*SiteVerifier {
+	ret := map[string]*SiteVerifier{}
+	for i := range config.CaptchaPolicies {
+		p := &config.CaptchaPolicies[i]
+		ret[p.Domain] = NewSiteVerifier(p)
+	}
+	return ret
+}
+
+func (v *SiteVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("siteverify returned %d", res.StatusCode)
+	}
+
+	body := struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	if !body.Success {
+		slog.Debug("captcha rejected", slog.Any("error_codes", body.ErrorCodes))
+	}
+	return body.Success, nil
+}
+
+// クライアントに表示するウィジェットの情報
+type Captcha struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+}
+
+var captchaResults, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.captcha.results",
+	metric.WithDescription("number of captcha verifications"),
+)
+
+// 設定ファイル以外の方法で検証する場合に、ドメインの検証を差し替える
+func (s *Waitingroom) SetCaptchaVerifier(domain string, v CaptchaVerifier) {
+	s.captchaMu.Lock()
+	defer s.captchaMu.Unlock()
+	s.captchaVerifiers[domain] = v
+}
+
+func (s *Waitingroom) captchaVerifier(domain string, p *CaptchaPolicy) CaptchaVerifier {
+	s.captchaMu.RLock()
+	defer s.captchaMu.RUnlock()
+	if v, ok := s.captchaVerifiers[domain]; ok {
+		return v
+	}
+	if v, ok := s.siteVerifiers[domain]; ok {
+		return v
+	}
+	return NewSiteVerifier(p)
+}
+
+// CAPTCHAを求めるドメインで、クライアントがまだ検証されていなければウィジェットの情報を返す
+func (s *Waitingroom) RequiredCaptcha(domain string, c *Client) *Captcha {
+	p := s.Config().captchaPolicy(domain)
+	if p == nil || c.CaptchaVerified || c.HasSerialNumber() {
+		return nil
+	}
+	return &Captcha{Provider: p.Provider, SiteKey: p.SiteKey}
+}
+
+// クッキーのトークンを検証し、成功すればクライアントに記録する
+// 検証できなかった場合は、Redisの障害と区別するためエラーを返さずに失敗として扱う
+func (s *Waitingroom) VerifyCaptcha(ctx context.Context, w http.ResponseWriter, r *http.Request, domain string, ip netip.Addr, c *Client) bool {
+	p := s.Config().captchaPolicy(domain)
+	cookie, err := r.Cookie(CaptchaCookieKey)
+	if p == nil || err != nil || cookie.Value == "" {
+		return false
+	}
+	// トークンは1度しか使えないため、検証の結果にかかわらず削除する
+	http.SetCookie(w, &http.Cookie{Name: CaptchaCookieKey, Path: "/", MaxAge: -1, Secure: true})
+
+	remoteIP := ""
+	if ip.IsValid() {
+		remoteIP = ip.String()
+	}
+	result := "success"
+	// ページのスクリプトはトークンをエスケープして保存する
+	token, err := url.PathUnescape(cookie.Value)
+	if err != nil {
+		token = cookie.Value
+	}
+	ok, err := s.captchaVerifier(domain, p).Verify(ctx, token, remoteIP)
+	if err != nil {
+		slog.Error(
+			"failed to verify captcha",
+			slog.String("domain", domain),
+			slog.String("provider", p.Provider),
+			slog.String("error", err.Error()),
+		)
+		result = "error"
+	} else if !ok {
+		result = "failure"
+	}
+	captchaResults.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("domain", domain),
+		attribute.String("provider", p.Provider),
+		attribute.String("result", result),
+	))
+	if !ok || err != nil {
+		return false
+	}
+	c.CaptchaVerified = true
+	return true
+}
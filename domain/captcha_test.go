@@ -0,0 +1,195 @@
+package waitingroom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"go.uber.org/mock/gomock"
+)
+
+// siteverify APIの代わりに、トークンがokなら成功、errorなら500を返す
+func newSiteVerifyStub(t *testing.T, calls *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("can't parse form: %v", err)
+		}
+		if r.PostForm.Get("secret") != "secret" {
+			t.Errorf("secret = %v, want secret", r.PostForm.Get("secret"))
+		}
+		switch r.PostForm.Get("response") {
+		case "ok":
+			w.Write([]byte(`{"success":true}`))
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+		}
+	}))
+}
+
+func TestSiteVerifier_Verify(t *testing.T) {
+	calls := atomic.Int64{}
+	stub := newSiteVerifyStub(t, &calls)
+	defer stub.Close()
+	v := NewSiteVerifier(&CaptchaPolicy{Provider: CaptchaProviderHCaptcha, Secret: "secret", Endpoint: stub.URL})
+
+	tests := []struct {
+		token   string
+		want    bool
+		wantErr bool
+	}{
+		{token: "ok", want: true},
+		{token: "ng"},
+		{token: "error", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), tt.token, "192.0.2.1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SiteVerifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SiteVerifier.Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := NewSiteVerifier(&CaptchaPolicy{Provider: CaptchaProviderTurnstile}).Endpoint; got != captchaEndpoints[CaptchaProviderTurnstile] {
+		t.Errorf("NewSiteVerifier() endpoint = %v", got)
+	}
+}
+
+type captchaVerifierFunc func(ctx context.Context, token, remoteIP string) (bool, error)
+
+func (f captchaVerifierFunc) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return f(ctx, token, remoteIP)
+}
+
+func TestWaitingroom_captchaVerifier(t *testing.T) {
+	config := &Config{CaptchaPolicies: []CaptchaPolicy{
+		{Domain: "example.com", Provider: CaptchaProviderTurnstile, SiteKey: "site", Secret: "secret"},
+	}}
+	wr := NewWaitingroom(config, repository.NewMockWaitingroomRepositoryer(gomock.NewController(t)))
+
+	// 検証のたびに作らず、同じ検証を使い回す
+	v := wr.captchaVerifier("example.com", config.captchaPolicy("example.com"))
+	if got := wr.captchaVerifier("example.com", config.captchaPolicy("example.com")); got != v {
+		t.Error("captchaVerifier() should reuse the verifier")
+	}
+
+	// 設定を差し替えると作り直す
+	next := &Config{CaptchaPolicies: []CaptchaPolicy{
+		{Domain: "example.com", Provider: CaptchaProviderHCaptcha, SiteKey: "site", Secret: "secret"},
+	}}
+	wr.SetConfig(next)
+	got, ok := wr.captchaVerifier("example.com", next.captchaPolicy("example.com")).(*SiteVerifier)
+	if !ok || got == v || got.Endpoint != captchaEndpoints[CaptchaProviderHCaptcha] {
+		t.Errorf("captchaVerifier() = %+v, want verifier for new policy", got)
+	}
+}
+
+func TestWaitingroom_CheckCaptcha(t *testing.T) {
+	calls := atomic.Int64{}
+	stub := newSiteVerifyStub(t, &calls)
+	defer stub.Close()
+
+	redisClient := testutils.TestRedisClient()
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	custom := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	wr := NewWaitingroom(&Config{
+		CacheTTLSec:        60,
+		EntryDelaySec:      10,
+		PermittedAccessSec: 10,
+		PermitUnitNumber:   10,
+		PermitIntervalSec:  10,
+		QueueEnableSec:     10,
+		CaptchaPolicies: []CaptchaPolicy{
+			{Domain: domain, Provider: CaptchaProviderTurnstile, SiteKey: "site", Secret: "secret", Endpoint: stub.URL},
+			{Domain: custom, Provider: CaptchaProviderReCaptcha, SiteKey: "site", Secret: "secret", Endpoint: stub.URL},
+		},
+	}, repository.NewWaitingroomRepository(redisClient))
+	wr.SetCaptchaVerifier(custom, captchaVerifierFunc(func(ctx context.Context, token, remoteIP string) (bool, error) {
+		return token == "custom", nil
+	}))
+
+	check := func(domain string, c *Client, token string) (*QueueResult, *Client) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c != nil {
+			v, _ := testutils.SecureCookie.Encode(ClientCookieKey, c)
+			r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: v})
+		}
+		if token != "" {
+			r.AddCookie(&http.Cookie{Name: CaptchaCookieKey, Value: token})
+		}
+		w := httptest.NewRecorder()
+		status, result, err := wr.Check(w, r, testutils.SecureCookie, domain, "/", true)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if status != http.StatusTooManyRequests {
+			t.Fatalf("Check() status = %v", status)
+		}
+
+		var saved *Client
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == ClientCookieKey {
+				saved = &Client{}
+				if err := testutils.SecureCookie.Decode(ClientCookieKey, cookie.Value, saved); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return result, saved
+	}
+
+	result, _ := check(domain, nil, "")
+	if result.Captcha == nil || *result.Captcha != (Captcha{Provider: CaptchaProviderTurnstile, SiteKey: "site"}) || result.ID != "" {
+		t.Fatalf("Check() = %+v, want captcha", *result)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("siteverify should not be called without token")
+	}
+
+	for _, token := range []string{"ng", "error"} {
+		result, _ = check(domain, nil, token)
+		if result.Captcha == nil || result.ID != "" {
+			t.Errorf("Check(%s) = %+v, want captcha", token, *result)
+		}
+	}
+
+	// 検証に成功したことをIDと一緒にクッキーへ保存する
+	result, saved := check(domain, nil, "ok")
+	if result.Captcha != nil || result.ID == "" {
+		t.Fatalf("Check() = %+v, want id", *result)
+	}
+	if saved == nil || !saved.CaptchaVerified || saved.ID != result.ID {
+		t.Fatalf("saved client = %+v, want verified", saved)
+	}
+
+	// 記録したクライアントは検証し直さない
+	n := calls.Load()
+	saved.TakeSerialNumberTime = time.Now().Add(-time.Second).Unix()
+	result, _ = check(domain, saved, "")
+	if result.Captcha != nil || result.SerialNo == 0 {
+		t.Errorf("Check() = %+v, want serial number", *result)
+	}
+	if calls.Load() != n {
+		t.Errorf("siteverify should not be called for verified client")
+	}
+
+	result, saved = check(custom, nil, "custom")
+	if result.Captcha != nil || saved == nil || !saved.CaptchaVerified {
+		t.Errorf("Check() = %+v, want verified by custom verifier", *result)
+	}
+	if calls.Load() != n {
+		t.Errorf("siteverify should not be called for custom verifier")
+	}
+}
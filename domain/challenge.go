@@ -0,0 +1,163 @@
+package waitingroom
+
+import (
+	"context"
+	"crypto/sha256"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/securecookie"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// クライアントが課題の答えを渡すクッキー。値は課題のトークンと答えを.でつないだもの
+const ChallengeCookieKey = "waiting-room-pow"
+
+// 課題のトークンを署名する際の名前
+const challengeTokenName = "waiting-room-challenge"
+
+const defaultChallengeTTLSec = 300
+
+// ドメインごとの作業証明の設定
+// ScaleStepとMaxDifficultyを指定すると、待ち人数に応じて難易度を上げる
+type ChallengePolicy struct {
+	Domain        string `mapstructure:"domain" validate:"required,fqdn"`
+	Difficulty    int    `mapstructure:"difficulty" validate:"required,min=1,max=32"`                    // ハッシュの先頭に求める0のビット数
+	MaxDifficulty int    `mapstructure:"max_difficulty" validate:"omitempty,max=32,gtefield=Difficulty"` // 待ち人数に応じて上げる難易度の上限
+	ScaleStep     int64  `mapstructure:"scale_step" validate:"gte=0,required_with=MaxDifficulty"`        // 待ち人数がこの数増えるごとに難易度を1上げる
+}
+
+// 待ち人数に応じた難易度を返す
+func (p *ChallengePolicy) difficulty(backlog int64) int {
+	if p.ScaleStep <= 0 || p.MaxDifficulty <= p.Difficulty {
+		return p.Difficulty
+	}
+	return int(min(int64(p.Difficulty)+backlog/p.ScaleStep, int64(p.MaxDifficulty)))
+}
+
+func (c *Config) challengePolicy(domain string) *ChallengePolicy {
+	for i := range c.ChallengePolicies {
+		if c.ChallengePolicies[i].Domain == domain {
+			return &c.ChallengePolicies[i]
+		}
+	}
+	return nil
+}
+
+func (c *Config) challengeTTL() time.Duration {
+	if c.ChallengeTTLSec > 0 {
+		return time.Duration(c.ChallengeTTLSec) * time.Second
+	}
+	return defaultChallengeTTLSec * time.Second
+}
+
+// クライアントに返す課題
+// sha256(Token + 答え)の先頭Difficultyビットが0になる答えを探し、ChallengeCookieKeyのクッキーで渡す
+type Challenge struct {
+	Token      string `json:"token"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// トークンに署名して埋め込む内容。検証にRedisを使わないよう、必要なものはすべて含める
+type challengeClaims struct {
+	Queue      string
+	ClientID   string // 他のクライアントに答えを使い回されないよう、IDに結び付ける
+	Difficulty int
+	Nonce      string
+	ExpireAt   int64
+}
+
+var challengeResults, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.challenge.results",
+	metric.WithDescription("number of proof-of-work challenges issued and verified"),
+)
+
+func (s *Waitingroom) recordChallenge(ctx context.Context, queue, result string) {
+	challengeResults.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("domain", queue),
+		attribute.String("result", result),
+	))
+}
+
+// 作業証明を求めるドメインで、IDを持つクライアントがまだ課題を解いていなければ新しい課題を返す
+// 課題が不要ならnilを返す
+func (s *Waitingroom) RequiredChallenge(ctx context.Context, r *http.Request, sc *securecookie.SecureCookie, domain, queue string, c *Client) (*Challenge, error) {
+	p := s.Config().challengePolicy(domain)
+	if p == nil || !c.HasID() || c.HasSerialNumber() || s.VerifyChallenge(ctx, r, sc, queue, c) {
+		return nil, nil
+	}
+	return s.newChallenge(ctx, sc, queue, c, p)
+}
+
+// 待ち人数は待合室の状態とまとめて取得したものを使う
+func (s *Waitingroom) newChallenge(ctx context.Context, sc *securecookie.SecureCookie, queue string, c *Client, p *ChallengePolicy) (*Challenge, error) {
+	if err := s.prefetchQueue(ctx, queue); err != nil {
+		return nil, err
+	}
+	var backlog int64
+	if v := s.backlogCache.Get(queue); v != nil {
+		backlog = v.Value()
+	}
+	claims := challengeClaims{
+		Queue:      queue,
+		ClientID:   c.ID,
+		Difficulty: p.difficulty(backlog),
+		Nonce:      uuid.NewString(),
+		ExpireAt:   time.Now().Add(s.Config().challengeTTL()).Unix(),
+	}
+	token, err := sc.Encode(challengeTokenName, claims)
+	if err != nil {
+		return nil, err
+	}
+	s.recordChallenge(ctx, queue, "issued")
+	return &Challenge{Token: token, Difficulty: claims.Difficulty}, nil
+}
+
+// クッキーの答えが、この待合室とクライアントに発行した期限内の課題を解いたものかを返す
+func (s *Waitingroom) VerifyChallenge(ctx context.Context, r *http.Request, sc *securecookie.SecureCookie, queue string, c *Client) bool {
+	cookie, err := r.Cookie(ChallengeCookieKey)
+	if err != nil {
+		return false
+	}
+	ok := verifyChallenge(sc, cookie.Value, queue, c.ID, time.Now())
+	if ok {
+		s.recordChallenge(ctx, queue, "solved")
+	} else {
+		s.recordChallenge(ctx, queue, "invalid")
+	}
+	return ok
+}
+
+func verifyChallenge(sc *securecookie.SecureCookie, value, queue, clientID string, now time.Time) bool {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return false
+	}
+	token, solution := value[:i], value[i+1:]
+
+	claims := challengeClaims{}
+	if err := sc.Decode(challengeTokenName, token, &claims); err != nil {
+		return false
+	}
+	if claims.Queue != queue || claims.ClientID != clientID || now.Unix() > claims.ExpireAt {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token + solution))
+	return leadingZeroBits(sum[:]) >= claims.Difficulty
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,159 @@
+package waitingroom
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func solveChallenge(c *Challenge) string {
+	for i := 0; ; i++ {
+		s := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(c.Token + s))
+		if leadingZeroBits(sum[:]) >= c.Difficulty {
+			return c.Token + "." + s
+		}
+	}
+}
+
+func TestChallengePolicy_difficulty(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ChallengePolicy
+		backlog int64
+		want    int
+	}{
+		{name: "fixed", policy: ChallengePolicy{Difficulty: 8}, backlog: 1000, want: 8},
+		{name: "scale", policy: ChallengePolicy{Difficulty: 8, MaxDifficulty: 16, ScaleStep: 100}, backlog: 250, want: 10},
+		{name: "capped", policy: ChallengePolicy{Difficulty: 8, MaxDifficulty: 16, ScaleStep: 100}, backlog: 100000, want: 16},
+		{name: "no backlog", policy: ChallengePolicy{Difficulty: 8, MaxDifficulty: 16, ScaleStep: 100}, want: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.difficulty(tt.backlog); got != tt.want {
+				t.Errorf("ChallengePolicy.difficulty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	sc := testutils.SecureCookie
+	now := time.Now()
+	token := func(claims challengeClaims) *Challenge {
+		v, err := sc.Encode(challengeTokenName, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Challenge{Token: v, Difficulty: claims.Difficulty}
+	}
+	valid := token(challengeClaims{Queue: "example.com", ClientID: "a", Difficulty: 8, ExpireAt: now.Add(time.Minute).Unix()})
+	solution := solveChallenge(valid)
+	expired := solveChallenge(token(challengeClaims{Queue: "example.com", ClientID: "a", Difficulty: 8, ExpireAt: now.Add(-time.Minute).Unix()}))
+
+	tests := []struct {
+		name     string
+		value    string
+		queue    string
+		clientID string
+		want     bool
+	}{
+		{name: "valid", value: solution, queue: "example.com", clientID: "a", want: true},
+		{name: "other client", value: solution, queue: "example.com", clientID: "b"},
+		{name: "other queue", value: solution, queue: "example.net", clientID: "a"},
+		{name: "expired", value: expired, queue: "example.com", clientID: "a"},
+		{name: "wrong answer", value: valid.Token + ".x", queue: "example.com", clientID: "a"},
+		{name: "tampered token", value: "x" + solution, queue: "example.com", clientID: "a"},
+		{name: "no answer", value: valid.Token, queue: "example.com", clientID: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 誤った答えでも偶然条件を満たすことがあるため、難易度を確かめる
+			if tt.name == "wrong answer" {
+				sum := sha256.Sum256([]byte(valid.Token + "x"))
+				if leadingZeroBits(sum[:]) >= valid.Difficulty {
+					t.Skip("wrong answer happens to be valid")
+				}
+			}
+			if got := verifyChallenge(sc, tt.value, tt.queue, tt.clientID, now); got != tt.want {
+				t.Errorf("verifyChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitingroom_CheckChallenge(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	wr := NewWaitingroom(&Config{
+		CacheTTLSec:        60,
+		EntryDelaySec:      10,
+		PermittedAccessSec: 10,
+		PermitUnitNumber:   10,
+		PermitIntervalSec:  10,
+		QueueEnableSec:     10,
+		ChallengePolicies: []ChallengePolicy{
+			{Domain: domain, Difficulty: 2, MaxDifficulty: 8, ScaleStep: 10},
+		},
+	}, repository.NewWaitingroomRepository(redisClient))
+	ctx := context.Background()
+	// 待ち人数が50人なら難易度は2+5になる
+	redisClient.SetEX(ctx, repository.Keys().Queue(domain, "current_no"), 50, time.Minute)
+	redisClient.SetEX(ctx, repository.Keys().Queue(domain, "permitted_no"), 0, time.Minute)
+
+	check := func(c *Client, solution string) *QueueResult {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c != nil {
+			v, _ := testutils.SecureCookie.Encode(ClientCookieKey, c)
+			r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: v})
+		}
+		if solution != "" {
+			r.AddCookie(&http.Cookie{Name: ChallengeCookieKey, Value: solution})
+		}
+		status, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", true)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if status != http.StatusTooManyRequests {
+			t.Fatalf("Check() status = %v", status)
+		}
+		return result
+	}
+
+	// 新しいクライアントにはIDと課題を返す
+	result := check(nil, "")
+	if result.ID == "" || result.Challenge == nil || result.SerialNo != 0 {
+		t.Fatalf("Check() = %+v, want id and challenge", *result)
+	}
+	if result.Challenge.Difficulty != 7 {
+		t.Errorf("Check() difficulty = %v, want 7", result.Challenge.Difficulty)
+	}
+
+	client := &Client{ID: result.ID, TakeSerialNumberTime: time.Now().Add(-time.Second).Unix()}
+	other := &Client{ID: "other", TakeSerialNumberTime: time.Now().Add(-time.Second).Unix()}
+
+	// 答えがなければ通し番号を発行しない
+	result = check(client, "")
+	if result.Challenge == nil || result.SerialNo != 0 {
+		t.Fatalf("Check() = %+v, want challenge", *result)
+	}
+	solution := solveChallenge(result.Challenge)
+
+	// 他のクライアントの答えは使えない
+	if result := check(other, solution); result.Challenge == nil || result.SerialNo != 0 {
+		t.Errorf("Check() = %+v, want challenge for other client", *result)
+	}
+
+	result = check(client, solution)
+	if result.Challenge != nil || result.SerialNo == 0 {
+		t.Errorf("Check() = %+v, want serial number", *result)
+	}
+}
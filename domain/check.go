@@ -0,0 +1,264 @@
+package waitingroom
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/pkg/errors"
+)
+
+type QueueResult struct {
+	ID                  string
+	Enabled             bool  `json:"enabled"`
+	PermittedClient     bool  `json:"permitted_client"`
+	SerialNo            int64 `json:"serial_no"`
+	PermittedNo         int64 `json:"permitted_no"`
+	RemainingWaitSecond int64 `json:"remaining_wait_second"`
+
+	Maintenance      bool       `json:"maintenance,omitempty"`
+	Message          string     `json:"message,omitempty"`
+	MaintenanceEndAt *time.Time `json:"maintenance_end_at,omitempty"`
+	SoldOut          bool       `json:"sold_out,omitempty"`
+	Denied           bool       `json:"denied,omitempty"`    // クライアントのIPが拒否するルールに一致した
+	Throttled        bool       `json:"throttled,omitempty"` // IDまたは通し番号の発行数が上限に達した。RemainingWaitSecond後に再び発行できる
+	Challenge        *Challenge `json:"challenge,omitempty"` // 通し番号を発行する前に解く作業証明の課題
+	Captcha          *Captcha   `json:"captcha,omitempty"`   // 通し番号を発行する前に表示するCAPTCHAのウィジェット
+	Degraded         bool       `json:"degraded,omitempty"`  // Redisに接続できず、ドメインの方針で判定した
+}
+
+// Retry-Afterに設定する秒数。メンテナンス中は終了予定までの秒数を返す
+func (r *QueueResult) RetryAfter() int64 {
+	if r.SoldOut {
+		return 0
+	}
+	if r.Maintenance {
+		if r.MaintenanceEndAt == nil {
+			return 0
+		}
+		if d := time.Until(*r.MaintenanceEndAt); d > 0 {
+			return int64(d/time.Second) + 1
+		}
+		return 0
+	}
+	return r.RemainingWaitSecond
+}
+
+// 待合室の判定を行い、クライアントへ返すステータスコードと結果を返す
+// APIハンドラとミドルウェアの双方から利用する
+// pathはクライアントがアクセスしたパスで、ルートの設定があればパスごとの待合室で判定する
+// Redisに接続できなければ、ドメインごとの方針に従って判定する
+func (s *Waitingroom) Check(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, domain, path string, enable bool) (int, *QueueResult, error) {
+	config := s.Config()
+	if !s.breaker.Allow(config) {
+		return s.degrade(w, r, sc, domain, path, ErrCircuitOpen)
+	}
+
+	status, result, err := s.check(w, r, sc, domain, path, enable)
+	if err != nil && isUnavailable(err) {
+		if s.breaker.Failure(config) {
+			s.notifyCircuitOpen(err)
+		}
+		return s.degrade(w, r, sc, domain, path, err)
+	}
+	s.breaker.Success()
+	return status, result, err
+}
+
+func (s *Waitingroom) check(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, domain, path string, enable bool) (int, *QueueResult, error) {
+	ctx := r.Context()
+
+	// 以降で参照するドメインの設定を、キャッシュになければまとめて取得する
+	if err := s.prefetchDomain(ctx, domain); err != nil {
+		return 0, nil, errors.Wrap(err, "can't get domain state")
+	}
+
+	// クライアントのIPのルールは、通し番号を払い出す前にメンテナンスや待合室の状態より先に判定する
+	config := s.Config()
+	ip := config.ClientIP(r)
+	rule, err := s.MatchIPRule(ctx, domain, ip)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't get ip rules")
+	}
+	if rule != nil {
+		if rule.Action == IPRuleDeny {
+			return http.StatusForbidden, &QueueResult{Denied: true}, nil
+		}
+		return http.StatusOK, &QueueResult{Enabled: false, PermittedClient: false}, nil
+	}
+
+	// メンテナンス中は、ホワイトリストのドメインと除外IPからのアクセス以外を遮断する
+	m, err := s.GetMaintenance(ctx, domain)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't get maintenance")
+	}
+	if m != nil && m.Active(time.Now()) {
+		ok, err := s.IsInWhitelist(ctx, domain, path)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "can't get whitelist")
+		}
+		if !ok && !containsIP(config.MaintenanceBypassCIDRs, ip) {
+			return http.StatusServiceUnavailable, m.Result(), nil
+		}
+	}
+
+	// メンテナンスはドメイン、ホワイトリストはドメインとパス、それ以外は待合室のキー単位で判定する
+	key, err := s.ResolveQueueKey(ctx, domain, path)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't resolve route")
+	}
+	queue := key.String()
+	if err := s.prefetchQueue(ctx, queue); err != nil {
+		return 0, nil, errors.Wrap(err, "can't get queue state")
+	}
+
+	// 受付終了後は、通し番号を持たないクライアントを受け付けない
+	// 待合室がリセットされた後も有効なため、待合室の状態より先に判定する
+	limit, err := s.GetQueueLimit(ctx, queue)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't get queue limit")
+	}
+	if limit.SoldOut() {
+		ok, err := s.IsInWhitelist(ctx, domain, path)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "can't get whitelist")
+		}
+		if !ok {
+			client, err := NewClientByQueueKey(w, r, sc, key)
+			if err != nil || !client.HasSerialNumber() {
+				return http.StatusGone, &QueueResult{Enabled: true, SoldOut: true}, nil
+			}
+		}
+	}
+
+	if enable {
+		if err := s.EnableQueue(ctx, queue); err != nil {
+			return 0, nil, errors.Wrap(err, "can't enable queue")
+		}
+	} else {
+		ok, err := s.IsEnabledQueue(ctx, queue)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "can't get enable status")
+		}
+
+		if !ok {
+			return http.StatusOK, &QueueResult{Enabled: false, PermittedClient: false}, nil
+		}
+	}
+
+	// ホワイトリストのルールに一致するドメインとパスならば即時許可応答する
+	ok, err := s.IsInWhitelist(ctx, domain, path)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't get whitelist")
+	}
+	if ok {
+		return http.StatusOK, &QueueResult{Enabled: false, PermittedClient: false}, nil
+	}
+
+	// 許可済みクライアントかどうかを判定する
+	client, err := NewClientByQueueKey(w, r, sc, key)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't build info")
+	}
+	client.binding, client.fingerprint = config.permitBinding(domain), permitFingerprint(r, ip)
+	ok, err = s.IsPermittedClient(ctx, client)
+	if err != nil {
+		if !errors.Is(err, ErrPermitMismatch) {
+			return 0, nil, errors.Wrap(err, "can't get permit status")
+		}
+		// 別の待合室や端末で許可されたクッキーは、通し番号ごと捨てて並び直させる
+		client.reset()
+	}
+
+	if ok {
+		return http.StatusOK, &QueueResult{ID: client.ID, Enabled: true, PermittedClient: true}, nil
+	}
+
+	// CAPTCHAを求めるドメインでは、検証に成功したことをクライアントに記録するまで通し番号を発行しない
+	if captcha := s.RequiredCaptcha(domain, client); captcha != nil {
+		if !s.VerifyCaptcha(ctx, w, r, domain, ip, client) {
+			return http.StatusTooManyRequests, &QueueResult{ID: client.ID, Enabled: true, Captcha: captcha}, nil
+		}
+		// IDを持たないクライアントは、IDを発行した後でまとめて保存する
+		if client.HasID() {
+			if err := client.SaveToResponse(w, config); err != nil {
+				return 0, nil, errors.Wrap(err, "can't save client info")
+			}
+		}
+	}
+
+	// 作業証明を求めるドメインでは、IDに結び付けた課題を解くまで通し番号を発行しない
+	challenge, err := s.RequiredChallenge(ctx, r, sc, domain, queue, client)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't issue challenge")
+	}
+	if challenge != nil {
+		return http.StatusTooManyRequests, &QueueResult{ID: client.ID, Enabled: true, Challenge: challenge}, nil
+	}
+
+	// 新しいIDと通し番号は、クッキーを消して取り直せないようクライアントごとに発行数を制限する
+	wait, err := s.Throttle(ctx, queue, config.throttleSubject(r, ip), client)
+	if err != nil {
+		if errors.Is(err, ErrThrottled) {
+			return http.StatusTooManyRequests, &QueueResult{
+				ID:                  client.ID,
+				Enabled:             true,
+				Throttled:           true,
+				RemainingWaitSecond: int64((wait + time.Second - 1) / time.Second),
+			}, nil
+		}
+		return 0, nil, errors.Wrap(err, "can't throttle client")
+	}
+
+	isNew := !client.HasID()
+	serialNumber, err := s.AssignSerialNumber(ctx, queue, client)
+	if err != nil {
+		if errors.Is(err, ErrSoldOut) {
+			return http.StatusGone, &QueueResult{ID: client.ID, Enabled: true, SoldOut: true}, nil
+		}
+		return 0, nil, errors.Wrap(err, "can't get serial no")
+	}
+
+	if err := client.SaveToResponse(w, s.Config()); err != nil {
+		return 0, nil, errors.Wrap(err, "can't save client info")
+	}
+
+	if client.HasSerialNumber() {
+		ok, err := s.CheckAndPermitClient(ctx, queue, client)
+		if err != nil {
+			if !errors.Is(err, ErrPermitMismatch) {
+				return 0, nil, errors.Wrap(err, "can't jude permit access")
+			}
+			// 同じ通し番号が別の端末で先に許可されていれば、クッキーを捨てさせる
+			// 新しいIDは次の要求で発行数の制限やCAPTCHA、作業証明を経て発行する
+			client.reset()
+			if err := client.SaveToResponse(w, s.Config()); err != nil {
+				return 0, nil, errors.Wrap(err, "can't save client info")
+			}
+			return http.StatusTooManyRequests, &QueueResult{Enabled: true}, nil
+		}
+		if ok {
+			return http.StatusOK, &QueueResult{ID: client.ID, Enabled: true, PermittedClient: true}, nil
+		}
+	}
+
+	remaningWaitSecond, pn, err := s.CalcRemainingWaitSecond(ctx, queue, serialNumber)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't calc remaining wait second")
+	}
+	result := &QueueResult{
+		ID:                  client.ID,
+		Enabled:             true,
+		PermittedClient:     false,
+		SerialNo:            client.SerialNumber,
+		PermittedNo:         pn,
+		RemainingWaitSecond: remaningWaitSecond,
+	}
+	// IDを発行したクライアントには、通し番号を取得できるまでの間に解く課題を返す
+	if isNew {
+		if result.Challenge, err = s.RequiredChallenge(ctx, r, sc, domain, queue, client); err != nil {
+			return 0, nil, errors.Wrap(err, "can't issue challenge")
+		}
+	}
+	return http.StatusTooManyRequests, result, nil
+}
@@ -16,14 +16,31 @@ type Client struct {
 	SerialNumber         int64  // 通し番号
 	ID                   string // ユーザー固有ID
 	TakeSerialNumberTime int64  // シリアルナンバーを取得するUNIXTIME
+	CaptchaVerified      bool   // CAPTCHAの検証に成功した
+	Queue                string // IDを発行した待合室
 	secureCookie         *securecookie.SecureCookie
 	domain               string
+	route                *RouteRule // ルートの待合室のクライアントならそのルール
+	group                *Group     // グループの待合室のクライアントならそのグループ
+	binding              string     // 許可済みのクライアントの照合方法
+	fingerprint          string     // 許可を端末に結び付けるためのIPの範囲とUser-Agentのハッシュ
 }
 
 const ClientCookieKey = "waiting-room"
 
 func NewClientByContext(ctx echo.Context, sc *securecookie.SecureCookie) (*Client, error) {
-	cookie, err := ctx.Cookie(ClientCookieKey)
+	return NewClientByRequest(ctx.Response(), ctx.Request(), sc, ctx.Param(paramDomainKey))
+}
+
+// echoに依存せずnet/httpのリクエストからクライアントを復元する
+func NewClientByRequest(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, domain string) (*Client, error) {
+	return NewClientByQueueKey(w, r, sc, QueueKey{Domain: domain})
+}
+
+// ルートの待合室では、ルートごとのクッキーからクライアントを復元する
+func NewClientByQueueKey(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, key QueueKey) (*Client, error) {
+	domain := key.cookieDomain()
+	cookie, err := r.Cookie(key.cookieName())
 	if err != nil {
 		if err != http.ErrNoCookie {
 			return nil, err
@@ -32,14 +49,14 @@ func NewClientByContext(ctx echo.Context, sc *securecookie.SecureCookie) (*Clien
 
 	client := Client{}
 	if cookie != nil {
-		if err = sc.Decode(ClientCookieKey,
+		if err = sc.Decode(key.cookieName(),
 			cookie.Value,
 			&client); err != nil {
-			ctx.SetCookie(&http.Cookie{
-				Name:     ClientCookieKey,
+			http.SetCookie(w, &http.Cookie{
+				Name:     key.cookieName(),
 				MaxAge:   -1,
-				Domain:   ctx.Param(paramDomainKey),
-				Path:     "/",
+				Domain:   domain,
+				Path:     key.cookiePath(),
 				Secure:   true,
 				HttpOnly: true,
 			})
@@ -47,7 +64,9 @@ func NewClientByContext(ctx echo.Context, sc *securecookie.SecureCookie) (*Clien
 		}
 	}
 	client.secureCookie = sc
-	client.domain = ctx.Param(paramDomainKey)
+	client.domain = domain
+	client.route = key.Rule
+	client.group = key.Group
 
 	return &client, nil
 }
@@ -57,28 +76,35 @@ func (c *Client) canTakeSerialNumber() bool {
 }
 
 func (c *Client) SaveToCookie(ctx echo.Context, config *Config) error {
-	encoded, err := c.secureCookie.Encode(ClientCookieKey, c)
+	return c.SaveToResponse(ctx.Response(), config)
+}
+
+func (c *Client) SaveToResponse(w http.ResponseWriter, config *Config) error {
+	key := c.queueKey()
+	encoded, err := c.secureCookie.Encode(key.cookieName(), c)
 	if err != nil {
 		return err
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     ClientCookieKey,
+	http.SetCookie(w, &http.Cookie{
+		Name:     key.cookieName(),
 		Value:    encoded,
 		MaxAge:   config.PermittedAccessSec,
 		Domain:   c.domain,
-		Path:     "/",
+		Path:     key.cookiePath(),
 		Secure:   true,
 		HttpOnly: true,
 	})
 	return nil
 }
+
 func (c *Client) AssignID(delaySec int64) error {
 	u, err := uuid.NewRandom()
 	if err != nil {
 		return err
 	}
 	c.ID = u.String()
+	c.Queue = c.queueKey().String()
 	c.TakeSerialNumberTime = time.Now().Unix() + delaySec
 	c.SerialNumber = 0
 	return nil
@@ -87,6 +113,15 @@ func (c *Client) AssignSerialNumber(sn int64) {
 	c.SerialNumber = sn
 }
 
+// 許可を使い回したクライアントに、新しいIDから取り直させる
+func (c *Client) reset() {
+	c.ID = ""
+	c.SerialNumber = 0
+	c.TakeSerialNumberTime = 0
+	c.CaptchaVerified = false
+	c.Queue = ""
+}
+
 func (c *Client) HasID() bool {
 	return c.ID != ""
 }
@@ -98,3 +133,17 @@ func (c *Client) IsPermitClient(an int64) bool {
 func (c *Client) HasSerialNumber() bool {
 	return c.SerialNumber != 0 && c.ID != ""
 }
+
+// 許可済みであることを保存するキー。ルートやグループの待合室では許可をその待合室に限定する
+// グループのメンバーのドメインでは、どのドメインでも許可済みとして扱う
+func (c *Client) permitKey() string {
+	if c.route == nil && c.group == nil {
+		return c.ID
+	}
+	return c.queueKey().String() + "_" + c.ID
+}
+
+// グループでは親ドメインをdomainに持つが、キーにはグループ名を使う
+func (c *Client) queueKey() QueueKey {
+	return QueueKey{Domain: c.domain, Group: c.group, Rule: c.route}
+}
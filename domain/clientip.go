@@ -0,0 +1,76 @@
+package waitingroom
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const defaultClientIPHeader = "X-Forwarded-For"
+
+// 設定したヘッダと信頼するプロキシからクライアントのIPを決める
+func (c *Config) ClientIP(r *http.Request) netip.Addr {
+	header := c.ClientIPHeader
+	if header == "" {
+		header = defaultClientIPHeader
+	}
+	return ClientIPByHeader(r, c.TrustedProxies, header)
+}
+
+// 信頼するプロキシから届いたリクエストは、X-Forwarded-Forを右から辿り
+// 信頼するプロキシ以外で最初に現れたアドレスをクライアントのIPとする
+func ClientIP(r *http.Request, trustedProxies []string) netip.Addr {
+	return ClientIPByHeader(r, trustedProxies, defaultClientIPHeader)
+}
+
+// X-Real-IPのように1つのアドレスだけを渡すヘッダも、同じく右から辿る
+func ClientIPByHeader(r *http.Request, trustedProxies []string, header string) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip = ip.Unmap()
+
+	if !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(header), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !containsIP(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// CIDRまたは単一のIPアドレスのリストにipが含まれるかを返す
+func containsIP(list []string, ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	for _, v := range list {
+		if strings.Contains(v, "/") {
+			prefix, err := netip.ParsePrefix(v)
+			if err == nil && prefix.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err == nil && addr.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
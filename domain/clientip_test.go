@@ -0,0 +1,55 @@
+package waitingroom
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		xff            []string
+		trustedProxies []string
+		want           string
+	}{
+		{
+			name:       "direct access ignores x-forwarded-for",
+			remoteAddr: "203.0.113.10:1234",
+			xff:        []string{"192.0.2.1"},
+			want:       "203.0.113.10",
+		},
+		{
+			name:           "via trusted proxy",
+			remoteAddr:     "10.0.0.1:1234",
+			xff:            []string{"192.0.2.1"},
+			trustedProxies: []string{"10.0.0.0/8"},
+			want:           "192.0.2.1",
+		},
+		{
+			name:           "spoofed header is skipped",
+			remoteAddr:     "10.0.0.1:1234",
+			xff:            []string{"198.51.100.1, 192.0.2.1", "10.0.0.2"},
+			trustedProxies: []string{"10.0.0.0/8"},
+			want:           "192.0.2.1",
+		},
+		{
+			name:           "single ip proxy",
+			remoteAddr:     "[::ffff:10.0.0.1]:1234",
+			xff:            []string{"192.0.2.1"},
+			trustedProxies: []string{"10.0.0.1"},
+			want:           "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r, tt.trustedProxies); got.String() != tt.want {
+				t.Errorf("ClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
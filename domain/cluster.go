@@ -20,3 +20,7 @@ func NewCluster(r repository.ClusterRepositoryer) *Cluster {
 func (c *Cluster) TryUpdatePermittedNumberLock(ctx context.Context, domain string, ttl time.Duration) (bool, error) {
 	return c.repository.GetLockforPermittedNumber(ctx, domain, ttl)
 }
+
+func (c *Cluster) ReleasePermittedNumberLock(ctx context.Context, domain string) error {
+	return c.repository.ReleaseLockforPermittedNumber(ctx, domain)
+}
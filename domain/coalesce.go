@@ -0,0 +1,77 @@
+package waitingroom
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 同じキーで実行中の問い合わせがあれば、その結果を共有する
+// 共有した問い合わせが他の呼び出し元のキャンセルで失敗した場合は、自身で問い合わせ直す
+func coalesce[T any](ctx context.Context, s *Waitingroom, key string, fn func(context.Context) (T, error)) (T, error) {
+	if s.noCoalesce {
+		return fn(ctx)
+	}
+	v, err, shared := s.flight.Do(key, func() (interface{}, error) {
+		return fn(ctx)
+	})
+	if err != nil {
+		if shared && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			return fn(ctx)
+		}
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// キャッシュにないドメインの設定を、まとめて1往復で取得してキャッシュする
+func (s *Waitingroom) prefetchDomain(ctx context.Context, domain string) error {
+	if s.maintenanceCache.Has(domain) && s.routeCache.Has(domain) && s.groupCache.Has(domain) {
+		return nil
+	}
+
+	_, err := coalesce(ctx, s, "domain:"+domain, func(ctx context.Context) (struct{}, error) {
+		st, err := s.repository.GetDomainState(ctx, domain)
+		if err != nil {
+			return struct{}{}, err
+		}
+		if _, err := s.cacheMaintenance(domain, st.Maintenance); err != nil {
+			return struct{}{}, err
+		}
+		if _, err := s.cacheRoute(domain, st.Route); err != nil {
+			return struct{}{}, err
+		}
+		_, err = s.cacheGroup(ctx, domain, st.GroupName)
+		return struct{}{}, err
+	})
+	return err
+}
+
+// キャッシュにない待合室の許可番号と発行上限を、まとめて1往復で取得してキャッシュする
+func (s *Waitingroom) prefetchQueue(ctx context.Context, queue string) error {
+	if s.currentPermitNumberCache.Has(queue) && s.limitCache.Has(queue) && s.backlogCache.Has(queue) && s.permitUnitCache.Has(queue) {
+		return nil
+	}
+
+	_, err := coalesce(ctx, s, "queue:"+queue, func(ctx context.Context) (struct{}, error) {
+		st, err := s.repository.GetQueueState(ctx, queue)
+		if err != nil {
+			return struct{}{}, err
+		}
+		s.cachePermitNumber(queue, st.PermittedNumber)
+		var backlog int64
+		if st.PermittedNumber >= 0 {
+			backlog = max(st.CurrentNumber-st.PermittedNumber, 0)
+		}
+		s.backlogCache.Set(queue, backlog, time.Duration(s.Config().CacheTTLSec)*time.Second)
+		s.permitUnitCache.Set(queue, st.PermitUnit, time.Duration(s.Config().CacheTTLSec)*time.Second)
+		s.cacheQueueLimit(queue, &QueueLimit{
+			MaxSerialNumber: st.MaxSerialNumber,
+			Closed:          st.Closed,
+			IssuedNumber:    st.IssuedNumber,
+		})
+		return struct{}{}, nil
+	})
+	return err
+}
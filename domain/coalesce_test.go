@@ -0,0 +1,126 @@
+package waitingroom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+// Redisとの通信で待たされる時間。同時に届いた判定の問い合わせを重ならせる
+const simulatedRedisLatency = 2 * time.Millisecond
+
+// Redisへのコマンド数と往復回数を数える
+type redisCounter struct {
+	commands   atomic.Int64
+	roundTrips atomic.Int64
+}
+
+func (c *redisCounter) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	c.commands.Add(1)
+	c.roundTrips.Add(1)
+	time.Sleep(simulatedRedisLatency)
+	return ctx, nil
+}
+
+func (c *redisCounter) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (c *redisCounter) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	c.commands.Add(int64(len(cmds)))
+	c.roundTrips.Add(1)
+	time.Sleep(simulatedRedisLatency)
+	return ctx, nil
+}
+
+func (c *redisCounter) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// 同時に届いた判定をconcurrency件処理し、Redisへのコマンド数と往復回数を返す
+func loadCheck(t testing.TB, noCoalesce bool, concurrency int) (int64, int64) {
+	counter := &redisCounter{}
+	redisClient := testutils.TestRedisClient()
+	redisClient.AddHook(counter)
+
+	domain := testutils.TestRandomString(10) + ".example.com"
+	redisClient.SetEX(context.Background(), repository.Keys().Queue(domain, "permitted_no"), 0, time.Minute)
+	defer redisClient.Del(context.Background(), repository.Keys().Queue(domain, "permitted_no"))
+	counter.commands.Store(0)
+	counter.roundTrips.Store(0)
+
+	config := &Config{
+		EntryDelaySec:       10,
+		PermittedAccessSec:  10,
+		PermitUnitNumber:    10,
+		PermitIntervalSec:   10,
+		CacheTTLSec:         10,
+		NegativeCacheTTLSec: 10,
+	}
+	wr := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	wr.noCoalesce = noCoalesce
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			status, _, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", false)
+			if err != nil || status != http.StatusTooManyRequests {
+				t.Errorf("Check() = %v, %v", status, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return counter.commands.Load(), counter.roundTrips.Load()
+}
+
+func TestWaitingroom_CheckCoalescing(t *testing.T) {
+	const concurrency = 200
+	baseCommands, baseRoundTrips := loadCheck(t, true, concurrency)
+	commands, roundTrips := loadCheck(t, false, concurrency)
+
+	t.Logf("%d concurrent checks: commands %d -> %d, round trips %d -> %d",
+		concurrency, baseCommands, commands, baseRoundTrips, roundTrips)
+	if commands >= baseCommands || roundTrips >= baseRoundTrips {
+		t.Errorf("coalescing should reduce redis operations: commands %d -> %d, round trips %d -> %d",
+			baseCommands, commands, baseRoundTrips, roundTrips)
+	}
+	// ドメインと待合室の状態をそれぞれ1往復で取得する
+	if roundTrips > 2*concurrency {
+		t.Errorf("round trips = %d, want at most %d", roundTrips, 2*concurrency)
+	}
+}
+
+func BenchmarkWaitingroom_Check(b *testing.B) {
+	for _, tt := range []struct {
+		name       string
+		noCoalesce bool
+	}{
+		{"coalesced", false},
+		{"uncoalesced", true},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			var commands, roundTrips int64
+			for i := 0; i < b.N; i++ {
+				c, r := loadCheck(b, tt.noCoalesce, 100)
+				commands += c
+				roundTrips += r
+			}
+			b.ReportMetric(float64(commands)/float64(b.N), "redis-cmds/op")
+			b.ReportMetric(float64(roundTrips)/float64(b.N), "redis-roundtrips/op")
+		})
+	}
+}
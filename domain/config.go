@@ -1,5 +1,12 @@
 package waitingroom
 
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
 type Config struct {
 	LogLevel string
 	Listener string
@@ -15,4 +22,87 @@ type Config struct {
 	SlackApiToken       string `mapstructure:"slack_api_token,omitempty"`                                                                           // Slack Api Token
 	SlackChannel        string `mapstructure:"slack_channel,omitempty"`                                                                             // Slack Channel
 	EnableOtel          bool   `mapstructure:"enable_otel,omitempty"`                                                                               // OpenTelemetryによるトレースを有効にする
+
+	ClientPollingIntervalSec int    `mapstructure:"client_polling_interval_sec,omitempty"` // 待機ページの再読み込み周期
+	TemplateDir              string `mapstructure:"template_dir,omitempty"`                // 待機ページのテンプレートディレクトリ
+
+	TrustedProxies         []string `mapstructure:"trusted_proxies,omitempty" validate:"dive,cidr|ip"`          // X-Forwarded-Forを信頼するプロキシ
+	ClientIPHeader         string   `mapstructure:"client_ip_header,omitempty"`                                 // 信頼するプロキシがクライアントのIPを渡すヘッダ、未指定ならX-Forwarded-For
+	MaintenanceBypassCIDRs []string `mapstructure:"maintenance_bypass_cidrs,omitempty" validate:"dive,cidr|ip"` // メンテナンス中でも通常どおり判定するクライアント
+
+	ThrottleWindowSec  int    `mapstructure:"throttle_window_sec,omitempty" validate:"gte=0"`                  // 新しいIDと通し番号の発行数を数える秒数
+	ThrottleMaxIDs     int64  `mapstructure:"throttle_max_ids,omitempty" validate:"gte=0"`                     // ThrottleWindowSecあたりにクライアントへ発行するIDの数、0なら制限しない
+	ThrottleMaxSerials int64  `mapstructure:"throttle_max_serials,omitempty" validate:"gte=0"`                 // ThrottleWindowSecあたりにクライアントへ発行する通し番号の数、0なら制限しない
+	ThrottleBy         string `mapstructure:"throttle_by,omitempty" validate:"omitempty,oneof=ip fingerprint"` // クライアントの識別方法、未指定ならip
+
+	ChallengePolicies []ChallengePolicy `mapstructure:"challenge_policies,omitempty" validate:"dive"` // 通し番号を発行する前に作業証明を求めるドメイン
+	ChallengeTTLSec   int               `mapstructure:"challenge_ttl_sec,omitempty" validate:"gte=0"` // 作業証明の課題の有効期限
+
+	CaptchaPolicies []CaptchaPolicy `mapstructure:"captcha_policies,omitempty" validate:"dive"` // 通し番号を発行する前にCAPTCHAを求めるドメイン
+
+	PermitBinding         string                `mapstructure:"permit_binding,omitempty" validate:"omitempty,oneof=off domain fingerprint"` // 許可済みのクライアントの照合方法、未指定ならoff
+	PermitBindingPolicies []PermitBindingPolicy `mapstructure:"permit_binding_policies,omitempty" validate:"dive"`                          // ドメインごとの許可済みのクライアントの照合方法
+
+	GlobalPermitBudget int64          `mapstructure:"global_permit_budget,omitempty" validate:"gte=0"`                            // PermitIntervalSecあたりに全待合室で許可する数、0ならPermitUnitNumberを待合室ごとに許可
+	BudgetStrategy     string         `mapstructure:"budget_strategy,omitempty" validate:"omitempty,oneof=fair backlog weighted"` // GlobalPermitBudgetの配分方法
+	BudgetWeights      []BudgetWeight `mapstructure:"budget_weights,omitempty" validate:"dive"`                                   // 待合室ごとの重み、未指定の待合室は1
+
+	PermitWorkerConcurrency int `mapstructure:"permit_worker_concurrency,omitempty" validate:"gte=0"` // 許可番号を並列に進める待合室の数
+	GCIntervalSec           int `mapstructure:"gc_interval_sec,omitempty" validate:"gte=0"`           // 取り残されたRedisのキーを片付ける周期、0なら片付けない
+
+	ShutdownDelaySec   int `mapstructure:"shutdown_delay_sec,omitempty" validate:"gte=0"`   // 停止時に受付不可を返してから処理を止めるまでの秒数
+	ShutdownTimeoutSec int `mapstructure:"shutdown_timeout_sec,omitempty" validate:"gte=0"` // 処理中のリクエストとワーカーの終了を待つ秒数
+
+	ReadinessRedisFailureSec int `mapstructure:"readiness_redis_failure_sec,omitempty" validate:"gte=0"` // Redisに接続できない状態がこの秒数続いたら受付不可にする
+
+	CircuitBreakerThreshold int                 `mapstructure:"circuit_breaker_threshold,omitempty" validate:"gte=0"`                      // Redisへの接続がこの回数続けて失敗したら遮断する
+	CircuitBreakerOpenSec   int                 `mapstructure:"circuit_breaker_open_sec,omitempty" validate:"gte=0"`                       // 遮断してから再び問い合わせるまでの秒数
+	DegradationPolicy       string              `mapstructure:"degradation_policy,omitempty" validate:"omitempty,oneof=open closed cache"` // Redisに接続できない間の判定方法、未指定ならclosed
+	DegradationPolicies     []DegradationPolicy `mapstructure:"degradation_policies,omitempty" validate:"dive"`                            // ドメインごとのRedisに接続できない間の判定方法
+}
+
+// 待合室のキーごとの配分の重み
+// ドメインにはドットが含まれるため、マップではなく配列で指定する
+type BudgetWeight struct {
+	Queue  string `mapstructure:"queue" validate:"required"`
+	Weight int64  `mapstructure:"weight" validate:"gt=0"`
+}
+
+func (c *Config) Validate() error {
+	return validator.New(validator.WithRequiredStructEnabled()).Struct(c)
+}
+
+// 再起動しないと反映されない設定
+var restartRequiredFields = []string{"Listener", "PublicHost", "EnableOtel"}
+
+// 変更された設定を"名前: 旧 -> 新"の形式で返す。トークンは値を伏せる
+func (c *Config) Diff(n *Config) []string {
+	ret := []string{}
+	ov := reflect.ValueOf(*c)
+	nv := reflect.ValueOf(*n)
+	for i := 0; i < ov.NumField(); i++ {
+		name := ov.Type().Field(i).Name
+		o := ov.Field(i).Interface()
+		v := nv.Field(i).Interface()
+		if reflect.DeepEqual(o, v) {
+			continue
+		}
+		if name == "SlackApiToken" {
+			o, v = "***", "***"
+		}
+		ret = append(ret, fmt.Sprintf("%s: %v -> %v", name, o, v))
+	}
+	return ret
+}
+
+func (c *Config) RestartRequiredChanges(n *Config) []string {
+	ret := []string{}
+	ov := reflect.ValueOf(*c)
+	nv := reflect.ValueOf(*n)
+	for _, name := range restartRequiredFields {
+		if !reflect.DeepEqual(ov.FieldByName(name).Interface(), nv.FieldByName(name).Interface()) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
 }
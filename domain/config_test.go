@@ -1,6 +1,7 @@
 package waitingroom
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/go-playground/validator/v10"
@@ -85,3 +86,63 @@ func TestConfigValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigDiff(t *testing.T) {
+	base := Config{
+		Listener:          "localhost:8080",
+		PermitIntervalSec: 60,
+		PermitUnitNumber:  5,
+		SlackApiToken:     "old-token",
+	}
+	tests := []struct {
+		name        string
+		config      Config
+		want        []string
+		wantRestart []string
+	}{
+		{
+			name:        "no change",
+			config:      base,
+			want:        []string{},
+			wantRestart: []string{},
+		},
+		{
+			name: "changed",
+			config: func() Config {
+				c := base
+				c.PermitUnitNumber = 10
+				c.Listener = "localhost:8081"
+				c.SlackApiToken = "new-token"
+				return c
+			}(),
+			want: []string{
+				"Listener: localhost:8080 -> localhost:8081",
+				"PermitUnitNumber: 5 -> 10",
+				"SlackApiToken: *** -> ***",
+			},
+			wantRestart: []string{"Listener"},
+		},
+		{
+			name: "captcha secret",
+			config: func() Config {
+				c := base
+				c.CaptchaPolicies = []CaptchaPolicy{{Domain: "example.com", Provider: "turnstile", SiteKey: "site", Secret: "secret"}}
+				return c
+			}(),
+			want:        []string{"CaptchaPolicies: [] -> [{example.com turnstile site *** }]"},
+			wantRestart: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base.Diff(&tt.config)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Config.Diff() = %v, want %v", got, tt.want)
+			}
+			gotRestart := base.RestartRequiredChanges(&tt.config)
+			if !reflect.DeepEqual(gotRestart, tt.wantRestart) {
+				t.Errorf("Config.RestartRequiredChanges() = %v, want %v", gotRestart, tt.wantRestart)
+			}
+		})
+	}
+}
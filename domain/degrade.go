@@ -0,0 +1,225 @@
+package waitingroom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/securecookie"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	DegradationPolicyOpen   = "open"   // 待合室を通さずにアクセスさせる
+	DegradationPolicyClosed = "closed" // 503を返す
+	DegradationPolicyCache  = "cache"  // 最後に取得できた許可番号で判定する
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ドメインごとのRedisに接続できない間の判定方法
+// Redisに保存すると参照できないため、設定ファイルで指定する
+type DegradationPolicy struct {
+	Domain string `mapstructure:"domain" validate:"required,fqdn"`
+	Policy string `mapstructure:"policy" validate:"required,oneof=open closed cache"`
+}
+
+var degradedDecisions, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.degraded.decisions",
+	metric.WithDescription("number of decisions made without redis"),
+)
+
+func (c *Config) degradationPolicy(domain string) string {
+	for _, p := range c.DegradationPolicies {
+		if p.Domain == domain {
+			return p.Policy
+		}
+	}
+	if c.DegradationPolicy != "" {
+		return c.DegradationPolicy
+	}
+	return DegradationPolicyClosed
+}
+
+// Redisへの接続失敗が続いたら、一定時間Redisに問い合わせずに判定する
+// 時間が経過したら1件だけ問い合わせ、成功すれば元に戻す
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (b *circuitBreaker) Allow(config *Config) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < time.Duration(config.CircuitBreakerOpenSec)*time.Second {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openedAt.IsZero() {
+		slog.Info("circuit breaker closed")
+	}
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.probing = false
+}
+
+// 失敗を記録し、遮断を始めたときにtrueを返す
+func (b *circuitBreaker) Failure(config *Config) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.probing {
+		// 再開を試した問い合わせが失敗したら、通知せずに遮断を続ける
+		b.probing = false
+		b.openedAt = time.Now()
+		return false
+	}
+	if b.openedAt.IsZero() && b.failures >= max(config.CircuitBreakerThreshold, 1) {
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero()
+}
+
+// Redisに接続できないことを示すエラーか。それ以外のエラーでは遮断しない
+func isUnavailable(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, redis.ErrClosed) {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection pool timeout", "LOADING", "READONLY", "CLUSTERDOWN", "MASTERDOWN"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Waitingroom) setLastPermitNumber(queue string, n int64) {
+	s.lastKnownMu.Lock()
+	defer s.lastKnownMu.Unlock()
+	s.lastKnown[queue] = n
+}
+
+func (s *Waitingroom) lastPermitNumber(queue string) (int64, bool) {
+	s.lastKnownMu.RLock()
+	defer s.lastKnownMu.RUnlock()
+	n, ok := s.lastKnown[queue]
+	return n, ok
+}
+
+// Redisに問い合わせず、キャッシュにあるグループとルートから待合室のキーを決める
+func (s *Waitingroom) cachedQueueKey(domain, path string) QueueKey {
+	key := QueueKey{Domain: domain}
+	if v := s.groupCache.Get(domain); v != nil {
+		key.Group = v.Value()
+	}
+	if v := s.routeCache.Get(domain); v != nil && v.Value() != nil {
+		key.Rule = v.Value().Match(path)
+	}
+	return key
+}
+
+// Redisに接続できない間の判定。ドメインの方針に従い、判定した件数を記録する
+func (s *Waitingroom) degrade(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, domain, path string, cause error) (int, *QueueResult, error) {
+	config := s.Config()
+	policy := config.degradationPolicy(domain)
+	status, result := s.degradedDecision(w, r, sc, domain, path, policy)
+
+	degradedDecisions.Add(r.Context(), 1, metric.WithAttributes(
+		attribute.String("domain", domain),
+		attribute.String("policy", policy),
+		attribute.Int("status", status),
+	))
+	slog.Warn(
+		"degraded decision",
+		slog.String("domain", domain),
+		slog.String("policy", policy),
+		slog.Int("status", status),
+		slog.String("cause", cause.Error()),
+	)
+	return status, result, nil
+}
+
+func (s *Waitingroom) degradedDecision(w http.ResponseWriter, r *http.Request, sc *securecookie.SecureCookie, domain, path, policy string) (int, *QueueResult) {
+	switch policy {
+	case DegradationPolicyOpen:
+		return http.StatusOK, &QueueResult{Enabled: false, Degraded: true}
+	case DegradationPolicyCache:
+		key := s.cachedQueueKey(domain, path)
+		pn, ok := s.lastPermitNumber(key.String())
+		if !ok {
+			// 一度も状態を取得していなければ判定できないため遮断する
+			break
+		}
+		if pn < 0 {
+			return http.StatusOK, &QueueResult{Enabled: false, Degraded: true}
+		}
+		client, err := NewClientByQueueKey(w, r, sc, key)
+		if err != nil {
+			break
+		}
+		if v := s.permittedClientCache.Get(client.permitKey()); (v != nil && v.Value() != nil) || client.IsPermitClient(pn) {
+			return http.StatusOK, &QueueResult{ID: client.ID, Enabled: true, PermittedClient: true, Degraded: true}
+		}
+		// 通し番号を払い出せないため、持っていないクライアントは待たせ続ける
+		return http.StatusTooManyRequests, &QueueResult{
+			ID:          client.ID,
+			Enabled:     true,
+			SerialNo:    client.SerialNumber,
+			PermittedNo: pn,
+			Degraded:    true,
+		}
+	}
+	return http.StatusServiceUnavailable, &QueueResult{Enabled: true, Degraded: true}
+}
+
+func (s *Waitingroom) notifyCircuitOpen(cause error) {
+	config := s.Config()
+	slog.Error(
+		"circuit breaker opened",
+		slog.Int("threshold", config.CircuitBreakerThreshold),
+		slog.Int("open_sec", config.CircuitBreakerOpenSec),
+		slog.String("error", cause.Error()),
+	)
+	go func() {
+		if err := NotifySlack(config, "WaitingRoom Circuit breaker opened",
+			fmt.Sprintf("Error: %s", cause),
+			fmt.Sprintf("Retry after: %ds", config.CircuitBreakerOpenSec),
+		); err != nil {
+			slog.Error("failed to notify slack", slog.String("error", err.Error()))
+		}
+	}()
+}
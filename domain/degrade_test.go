@@ -0,0 +1,164 @@
+package waitingroom
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	config := &Config{CircuitBreakerThreshold: 2}
+	b := &circuitBreaker{}
+
+	if b.Failure(config) {
+		t.Errorf("Failure() should not open before threshold")
+	}
+	if !b.Failure(config) || !b.Open() {
+		t.Errorf("Failure() should open at threshold")
+	}
+	if b.Failure(config) {
+		t.Errorf("Failure() should not report open twice")
+	}
+
+	config.CircuitBreakerOpenSec = 60
+	if b.Allow(config) {
+		t.Errorf("Allow() should reject while open")
+	}
+
+	// 待ち時間が過ぎたら1件だけ問い合わせる
+	config.CircuitBreakerOpenSec = 0
+	if !b.Allow(config) {
+		t.Errorf("Allow() should allow a probe")
+	}
+	if b.Allow(config) {
+		t.Errorf("Allow() should reject while probing")
+	}
+	if b.Failure(config) || !b.Open() {
+		t.Errorf("Failure() of probe should keep open without report")
+	}
+
+	if !b.Allow(config) {
+		t.Errorf("Allow() should allow a probe")
+	}
+	b.Success()
+	if b.Open() || !b.Allow(config) || !b.Allow(config) {
+		t.Errorf("Success() should close breaker")
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"net error", pkgerrors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "can't get maintenance"), true},
+		{"closed", redis.ErrClosed, true},
+		{"readonly", errors.New("READONLY You can't write against a read only replica."), true},
+		{"cookie", pkgerrors.Wrap(errors.New("can't decode cookie"), "can't build info"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnavailable(tt.err); got != tt.want {
+				t.Errorf("isUnavailable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitingroom_CheckDegraded(t *testing.T) {
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	permitted, _ := testutils.SecureCookie.Encode(ClientCookieKey, Client{ID: "permitted", SerialNumber: 5})
+	waiting, _ := testutils.SecureCookie.Encode(ClientCookieKey, Client{ID: "waiting", SerialNumber: 20})
+
+	tests := []struct {
+		name       string
+		policy     string
+		lastKnown  *int64
+		cookie     string
+		wantStatus int
+		wantResult QueueResult
+	}{
+		{
+			name:       "closed by default",
+			wantStatus: http.StatusServiceUnavailable,
+			wantResult: QueueResult{Enabled: true, Degraded: true},
+		},
+		{
+			name:       "open",
+			policy:     DegradationPolicyOpen,
+			wantStatus: http.StatusOK,
+			wantResult: QueueResult{Degraded: true},
+		},
+		{
+			name:       "cache without last known state",
+			policy:     DegradationPolicyCache,
+			wantStatus: http.StatusServiceUnavailable,
+			wantResult: QueueResult{Enabled: true, Degraded: true},
+		},
+		{
+			name:       "cache with disabled queue",
+			policy:     DegradationPolicyCache,
+			lastKnown:  func() *int64 { v := int64(-1); return &v }(),
+			wantStatus: http.StatusOK,
+			wantResult: QueueResult{Degraded: true},
+		},
+		{
+			name:       "cache with permitted client",
+			policy:     DegradationPolicyCache,
+			lastKnown:  func() *int64 { v := int64(10); return &v }(),
+			cookie:     permitted,
+			wantStatus: http.StatusOK,
+			wantResult: QueueResult{ID: "permitted", Enabled: true, PermittedClient: true, Degraded: true},
+		},
+		{
+			name:       "cache with waiting client",
+			policy:     DegradationPolicyCache,
+			lastKnown:  func() *int64 { v := int64(10); return &v }(),
+			cookie:     waiting,
+			wantStatus: http.StatusTooManyRequests,
+			wantResult: QueueResult{ID: "waiting", Enabled: true, SerialNo: 20, PermittedNo: 10, Degraded: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := testutils.TestRandomString(10) + ".example.com"
+			config := &Config{
+				CircuitBreakerThreshold: 5,
+				DegradationPolicies:     []DegradationPolicy{{Domain: domain, Policy: tt.policy}},
+			}
+			if tt.policy == "" {
+				config.DegradationPolicies = nil
+			}
+			wr := NewWaitingroom(config, repository.NewWaitingroomRepository(unreachable))
+			if tt.lastKnown != nil {
+				wr.setLastPermitNumber(domain, *tt.lastKnown)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: tt.cookie})
+			}
+			status, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", false)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Check() status = %v, want %v", status, tt.wantStatus)
+			}
+			if *result != tt.wantResult {
+				t.Errorf("Check() result = %+v, want %+v", *result, tt.wantResult)
+			}
+			if wr.breaker.Open() {
+				t.Errorf("breaker should not open before threshold")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package waitingroom
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var gcInconsistencies, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.gc.inconsistencies",
+	metric.WithDescription("number of inconsistencies found in redis"),
+)
+
+// GCIntervalSecごとに取り残されたキーを片付ける
+// 無効な間も、設定の変更で有効になるよう判定周期ごとに確認する
+func (a *AccessController) RunGC(ctx context.Context) {
+	for {
+		config := a.Config()
+		interval := time.Duration(config.GCIntervalSec) * time.Second
+		if interval > 0 {
+			if err := a.CollectGarbage(ctx, interval, config); err != nil && ctx.Err() == nil {
+				slog.Error(
+					"error garbage collection",
+					slog.String("error", err.Error()),
+				)
+			}
+		} else {
+			interval = max(time.Duration(config.PermitIntervalSec)*time.Second, time.Second)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ロックを取れたインスタンスだけが、周期ごとに1度片付ける
+func (a *AccessController) CollectGarbage(ctx context.Context, interval time.Duration, config *Config) error {
+	ok, err := a.gc.TryLock(ctx, interval)
+	if err != nil || !ok {
+		return err
+	}
+
+	list, err := a.gc.Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, in := range list {
+		gcInconsistencies.Add(ctx, 1, metric.WithAttributes(attribute.String("kind", in.Kind)))
+		slog.Info(
+			"fix inconsistency",
+			slog.String("key", in.Key),
+			slog.String("queue", in.Queue),
+			slog.String("kind", in.Kind),
+			slog.String("fix", in.Fix),
+		)
+	}
+	_, err = a.gc.Fix(ctx, list, time.Duration(config.QueueEnableSec)*time.Second)
+	return err
+}
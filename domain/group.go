@@ -0,0 +1,127 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// グループの待合室のキーの接頭辞。グループの待合室は @shop のようなキーになる
+const GroupKeyPrefix = "@"
+
+// 複数のドメインで1つの待合室と許可数を共有するグループ
+type Group struct {
+	Name         string   `json:"name" validate:"required,alphanum,max=32"`
+	Domains      []string `json:"domains" validate:"required,min=1,dive,fqdn"`
+	CookieDomain string   `json:"cookie_domain" validate:"omitempty,fqdn"` // メンバーで共有するクッキーの親ドメイン、未指定ならドメインごと
+}
+
+func (g *Group) validate() error {
+	domains := map[string]bool{}
+	for _, d := range g.Domains {
+		if domains[d] {
+			return fmt.Errorf("duplicate group domain: %s", d)
+		}
+		domains[d] = true
+		if g.CookieDomain != "" && d != g.CookieDomain && !strings.HasSuffix(d, "."+g.CookieDomain) {
+			return fmt.Errorf("domain %s is not under cookie domain %s", d, g.CookieDomain)
+		}
+	}
+	return nil
+}
+
+// ドメインが属するグループを返す。属していなければnilを返す
+func (s *Waitingroom) GetGroupByDomain(ctx context.Context, domain string) (*Group, error) {
+	v := s.groupCache.Get(domain)
+	if v != nil {
+		return v.Value(), nil
+	}
+
+	name, err := s.repository.GetGroupName(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return s.cacheGroup(ctx, domain, name)
+}
+
+func (s *Waitingroom) cacheGroup(ctx context.Context, domain, name string) (*Group, error) {
+	g, err := s.fetchGroup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		s.groupCache.Set(domain, nil, time.Duration(s.Config().NegativeCacheTTLSec)*time.Second)
+		return nil, nil
+	}
+	s.groupCache.Set(domain, g, time.Duration(s.Config().CacheTTLSec)*time.Second)
+	return g, nil
+}
+
+func (s *Waitingroom) fetchGroup(ctx context.Context, name string) (*Group, error) {
+	if name == "" {
+		return nil, nil
+	}
+	r, err := s.repository.GetGroup(ctx, name)
+	if err != nil || r == "" {
+		return nil, err
+	}
+
+	g := &Group{}
+	if err := json.Unmarshal([]byte(r), g); err != nil {
+		return nil, err
+	}
+	g.Name = name
+	return g, nil
+}
+
+func (s *Waitingroom) GetGroups(ctx context.Context) ([]Group, error) {
+	v, err := s.repository.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Group{}
+	for name, r := range v {
+		g := Group{}
+		if err := json.Unmarshal([]byte(r), &g); err != nil {
+			return nil, err
+		}
+		g.Name = name
+		ret = append(ret, g)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// ドメインは1つのグループにしか属せない
+func (s *Waitingroom) SaveGroup(ctx context.Context, g *Group) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	for _, d := range g.Domains {
+		name, err := s.repository.GetGroupName(ctx, d)
+		if err != nil {
+			return err
+		}
+		if name != "" && name != g.Name {
+			return fmt.Errorf("domain %s already belongs to group %s", d, name)
+		}
+	}
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	defer s.invalidate(ctx, InvalidateGroup, g.Name)
+	return s.repository.SaveGroup(ctx, g.Name, string(b), g.Domains)
+}
+
+func (s *Waitingroom) DeleteGroup(ctx context.Context, name string) error {
+	defer s.invalidate(ctx, InvalidateGroup, name)
+	return s.repository.DeleteGroup(ctx, name)
+}
@@ -0,0 +1,94 @@
+package waitingroom
+
+import "testing"
+
+func TestGroup_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   Group
+		wantErr bool
+	}{
+		{
+			name:  "ok",
+			group: Group{Name: "shop", Domains: []string{"www.example.com", "m.example.com", "example.com"}, CookieDomain: "example.com"},
+		},
+		{
+			name:  "without cookie domain",
+			group: Group{Name: "shop", Domains: []string{"example.com", "example.net"}},
+		},
+		{
+			name:    "outside cookie domain",
+			group:   Group{Name: "shop", Domains: []string{"www.example.com", "www.badexample.com"}, CookieDomain: "example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate domain",
+			group:   Group{Name: "shop", Domains: []string{"www.example.com", "www.example.com"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.group.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Group.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueueKey(t *testing.T) {
+	group := &Group{Name: "shop", CookieDomain: "example.com"}
+	rule := &RouteRule{Name: "checkout", Prefix: "/checkout"}
+	tests := []struct {
+		name             string
+		key              QueueKey
+		want             string
+		wantCookieName   string
+		wantCookieDomain string
+	}{
+		{
+			name:             "domain",
+			key:              QueueKey{Domain: "www.example.com"},
+			want:             "www.example.com",
+			wantCookieName:   "waiting-room",
+			wantCookieDomain: "www.example.com",
+		},
+		{
+			name:             "route",
+			key:              QueueKey{Domain: "www.example.com", Rule: rule},
+			want:             "www.example.com:checkout",
+			wantCookieName:   "waiting-room-checkout",
+			wantCookieDomain: "www.example.com",
+		},
+		{
+			name:             "group",
+			key:              QueueKey{Domain: "www.example.com", Group: group},
+			want:             "@shop",
+			wantCookieName:   "waiting-room-group-shop",
+			wantCookieDomain: "example.com",
+		},
+		{
+			name:             "group route",
+			key:              QueueKey{Domain: "www.example.com", Group: group, Rule: rule},
+			want:             "@shop:checkout",
+			wantCookieName:   "waiting-room-group-shop-checkout",
+			wantCookieDomain: "example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.String(); got != tt.want {
+				t.Errorf("QueueKey.String() = %v, want %v", got, tt.want)
+			}
+			if got := tt.key.cookieName(); got != tt.wantCookieName {
+				t.Errorf("QueueKey.cookieName() = %v, want %v", got, tt.wantCookieName)
+			}
+			if got := tt.key.cookieDomain(); got != tt.wantCookieDomain {
+				t.Errorf("QueueKey.cookieDomain() = %v, want %v", got, tt.wantCookieDomain)
+			}
+			if err := ValidateQueueKey(tt.key.String()); err != nil {
+				t.Errorf("ValidateQueueKey() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 破棄するキャッシュの種類
+const (
+	InvalidateQueue       = "queue"       // 待合室の有効状態と許可番号。キーは待合室のキー
+	InvalidateWhitelist   = "whitelist"   // キーは変更したルール。ルールはまとめてキャッシュしているため、すべて破棄する
+	InvalidateMaintenance = "maintenance" // キーはドメイン
+	InvalidateLimit       = "limit"       // キーは待合室のキー
+	InvalidateRoute       = "route"       // キーはドメイン
+	InvalidateGroup       = "group"       // ドメインとグループの対応をすべて破棄する
+	InvalidateIPRule      = "iprule"      // キーは変更したルールのID。ルールはまとめてキャッシュしているため、すべて破棄する
+	InvalidatePage        = "page"        // キーはドメイン。defaultなら他のドメインも破棄する
+)
+
+// 他のインスタンスにキャッシュの破棄を伝えるメッセージ
+type Invalidation struct {
+	Origin string `json:"origin"` // 送信したWaitingroom。自身の変更は受信時に無視する
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+}
+
+// ローカルのキャッシュを破棄し、他のインスタンスにも破棄を伝える
+// 通知に失敗しても変更自体は成功しているため、エラーは記録するだけにする
+func (s *Waitingroom) invalidate(ctx context.Context, kind, key string) {
+	s.evict(kind, key)
+
+	b, err := json.Marshal(Invalidation{Origin: s.id, Kind: kind, Key: key})
+	if err != nil {
+		slog.Error("can't marshal invalidation", slog.String("error", err.Error()))
+		return
+	}
+	if err := s.repository.PublishInvalidation(context.WithoutCancel(ctx), string(b)); err != nil {
+		slog.Error(
+			"can't publish invalidation",
+			slog.String("kind", kind),
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (s *Waitingroom) evict(kind, key string) {
+	switch kind {
+	case InvalidateQueue:
+		s.flushCache(key)
+	case InvalidateWhitelist:
+		s.whiteListCache.DeleteAll()
+	case InvalidateMaintenance:
+		s.maintenanceCache.Delete(key)
+	case InvalidateLimit:
+		s.limitCache.Delete(key)
+	case InvalidateRoute:
+		s.routeCache.Delete(key)
+	case InvalidateGroup:
+		s.groupCache.DeleteAll()
+	case InvalidateIPRule:
+		s.ipRuleCache.DeleteAll()
+	case InvalidatePage:
+		if s.pageRenderer != nil {
+			s.pageRenderer.Evict(key)
+		}
+	}
+}
+
+// 待機ページの変更の通知を、描画に使うキャッシュへ伝える。通知を受け取る前に設定する
+func (s *Waitingroom) SetPageRenderer(p *PageRenderer) {
+	s.pageRenderer = p
+}
+
+// 設定に依存しないものも含めて、すべてのキャッシュを破棄する
+func (s *Waitingroom) flushAll() {
+	s.enableCache.DeleteAll()
+	s.permittedClientCache.DeleteAll()
+	s.currentPermitNumberCache.DeleteAll()
+	s.whiteListCache.DeleteAll()
+	s.maintenanceCache.DeleteAll()
+	s.limitCache.DeleteAll()
+	s.routeCache.DeleteAll()
+	s.groupCache.DeleteAll()
+	s.ipRuleCache.DeleteAll()
+	s.backlogCache.DeleteAll()
+	s.permitUnitCache.DeleteAll()
+	if s.pageRenderer != nil {
+		s.pageRenderer.Flush()
+	}
+}
+
+// 他のインスタンスの変更を受け取り、該当するキャッシュを破棄する
+// 接続し直した際は、切断中の通知を取りこぼしているためすべて破棄する
+func (s *Waitingroom) WatchInvalidations(ctx context.Context) error {
+	pubsub := s.repository.SubscribeInvalidation(ctx)
+	defer pubsub.Close()
+
+	subscribed := false
+	ch := pubsub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind != "subscribe" {
+					continue
+				}
+				if subscribed {
+					slog.Info("resync caches after reconnect")
+					s.flushAll()
+				}
+				subscribed = true
+			case *redis.Message:
+				inv := Invalidation{}
+				if err := json.Unmarshal([]byte(m.Payload), &inv); err != nil {
+					slog.Error("can't unmarshal invalidation", slog.String("payload", m.Payload), slog.String("error", err.Error()))
+					continue
+				}
+				if inv.Origin == s.id {
+					continue
+				}
+				slog.Debug("invalidate cache", slog.String("kind", inv.Kind), slog.String("key", inv.Key))
+				s.evict(inv.Kind, inv.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestWaitingroom_WatchInvalidations(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	config := &Config{CacheTTLSec: 60, NegativeCacheTTLSec: 60}
+	local := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	remote := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	domain := testutils.TestRandomString(10) + ".example.com"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer remote.RemoveWhiteListDomain(context.Background(), domain)
+
+	// ホワイトリストに含まれないことをキャッシュさせる
+	ok, err := local.IsInWhitelist(ctx, domain, "/")
+	if err != nil || ok {
+		t.Fatalf("IsInWhitelist() = %v, %v", ok, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := local.WatchInvalidations(ctx); err != nil {
+			t.Errorf("WatchInvalidations() error = %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		// 購読を始める前の通知は届かないため、届くまで変更し直す
+		if err := remote.AddWhiteListDomain(ctx, domain, nil); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if local.whiteListCache.Get(whiteListCacheKey) == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not invalidated by other instance")
+		}
+	}
+
+	ok, err = local.IsInWhitelist(ctx, domain, "/")
+	if err != nil || !ok {
+		t.Errorf("IsInWhitelist() = %v, %v, want true", ok, err)
+	}
+
+	// 自身の変更の通知では、キャッシュを消さない
+	b, _ := json.Marshal(Invalidation{Origin: local.id, Kind: InvalidateWhitelist, Key: domain})
+	if err := local.repository.PublishInvalidation(ctx, string(b)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if local.whiteListCache.Get(whiteListCacheKey) == nil {
+		t.Errorf("own invalidation should be ignored")
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,214 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	IPRuleAllow = "allow" // 待合室を通さずにアクセスさせる
+	IPRuleDeny  = "deny"  // 403を返す
+)
+
+// IDでドメインとCIDRを区切る文字。全ドメインに適用するルールはCIDRだけになる
+const ipRuleDomainSeparator = "@"
+
+// ルールはまとめて取得して解釈し、このキーでキャッシュする
+const ipRuleCacheKey = "rules"
+
+var ipRuleDecisions, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.iprule.decisions",
+	metric.WithDescription("number of decisions made by client ip rules"),
+)
+
+// クライアントのIPアドレスで判定するルール。Domainが空ならすべてのドメインに適用する
+type IPRule struct {
+	ID        string     `json:"id"` // 10.0.0.0/8@example.com。削除に使う
+	CIDR      string     `json:"cidr" validate:"required,cidr|ip"`
+	Domain    string     `json:"domain" validate:"omitempty,fqdn"`
+	Action    string     `json:"action" validate:"required,oneof=allow deny"`
+	Reason    string     `json:"reason"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	prefix netip.Prefix
+}
+
+// 単一のアドレスは/32または/128とし、ホスト部を落としたCIDRにそろえる
+func (r *IPRule) normalize() error {
+	var prefix netip.Prefix
+	if strings.Contains(r.CIDR, "/") {
+		p, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %s: %w", r.CIDR, err)
+		}
+		prefix = p
+	} else {
+		addr, err := netip.ParseAddr(r.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid ip %s: %w", r.CIDR, err)
+		}
+		addr = addr.Unmap()
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	r.prefix = prefix.Masked()
+	r.CIDR = r.prefix.String()
+	r.Domain = strings.ToLower(r.Domain)
+	r.ID = r.CIDR
+	if r.Domain != "" {
+		r.ID += ipRuleDomainSeparator + r.Domain
+	}
+	return nil
+}
+
+// ドメインごとと全体に分け、それぞれプレフィックスの長い順に並べたルール
+type ipRules struct {
+	global  []*IPRule
+	domains map[string][]*IPRule
+}
+
+// 解釈できないルールは記録して読み飛ばす
+func compileIPRules(v map[string]string) *ipRules {
+	ret := &ipRules{domains: map[string][]*IPRule{}}
+	for id, raw := range v {
+		r := &IPRule{}
+		if err := json.Unmarshal([]byte(raw), r); err != nil {
+			slog.Warn("skip ip rule", slog.String("id", id), slog.String("error", err.Error()))
+			continue
+		}
+		if err := r.normalize(); err != nil {
+			slog.Warn("skip ip rule", slog.String("id", id), slog.String("error", err.Error()))
+			continue
+		}
+		if r.Domain == "" {
+			ret.global = append(ret.global, r)
+		} else {
+			ret.domains[r.Domain] = append(ret.domains[r.Domain], r)
+		}
+	}
+
+	bySpecificity := func(rules []*IPRule) {
+		sort.Slice(rules, func(i, j int) bool {
+			if rules[i].prefix.Bits() != rules[j].prefix.Bits() {
+				return rules[i].prefix.Bits() > rules[j].prefix.Bits()
+			}
+			return rules[i].ID < rules[j].ID
+		})
+	}
+	bySpecificity(ret.global)
+	for _, rules := range ret.domains {
+		bySpecificity(rules)
+	}
+	return ret
+}
+
+// ドメインのルール、全体のルールの順に、最も狭い範囲で一致したルールを返す
+// 全体で拒否している範囲でも、ドメインごとに許可できる
+func (rs *ipRules) Match(domain string, ip netip.Addr) *IPRule {
+	if !ip.IsValid() {
+		return nil
+	}
+	for _, rules := range [][]*IPRule{rs.domains[strings.ToLower(domain)], rs.global} {
+		for _, r := range rules {
+			if r.prefix.Contains(ip) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Waitingroom) ipRules(ctx context.Context) (*ipRules, error) {
+	if v := s.ipRuleCache.Get(ipRuleCacheKey); v != nil {
+		return v.Value(), nil
+	}
+
+	return coalesce(ctx, s, "iprules", func(ctx context.Context) (*ipRules, error) {
+		v, err := s.repository.GetIPRules(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rules := compileIPRules(v)
+		s.ipRuleCache.Set(ipRuleCacheKey, rules, time.Duration(s.Config().CacheTTLSec)*time.Second)
+		return rules, nil
+	})
+}
+
+// ドメインとクライアントのIPに一致するルールを返す。一致しなければnilを返す
+func (s *Waitingroom) MatchIPRule(ctx context.Context, domain string, ip netip.Addr) (*IPRule, error) {
+	rules, err := s.ipRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := rules.Match(domain, ip)
+	if r != nil {
+		ipRuleDecisions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("domain", domain),
+			attribute.String("action", r.Action),
+		))
+	}
+	return r, nil
+}
+
+func (s *Waitingroom) GetIPRules(ctx context.Context) ([]IPRule, error) {
+	v, err := s.repository.GetIPRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []IPRule{}
+	for id, raw := range v {
+		r := IPRule{}
+		if err := json.Unmarshal([]byte(raw), &r); err != nil {
+			return nil, err
+		}
+		// 解釈できないルールも削除できるよう、保存したIDで返す
+		r.ID = id
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Domain != ret[j].Domain {
+			return ret[i].Domain < ret[j].Domain
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+// 同じドメインとCIDRのルールは上書きする
+func (s *Waitingroom) SaveIPRule(ctx context.Context, r *IPRule) error {
+	if r.Action != IPRuleAllow && r.Action != IPRuleDeny {
+		return fmt.Errorf("invalid action: %s", r.Action)
+	}
+	if err := r.normalize(); err != nil {
+		return err
+	}
+	if r.CreatedAt == nil {
+		now := time.Now()
+		r.CreatedAt = &now
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	defer s.invalidate(ctx, InvalidateIPRule, r.ID)
+	return s.repository.SaveIPRule(ctx, r.ID, string(b))
+}
+
+func (s *Waitingroom) DeleteIPRule(ctx context.Context, id string) error {
+	defer s.invalidate(ctx, InvalidateIPRule, id)
+	return s.repository.DeleteIPRule(ctx, id)
+}
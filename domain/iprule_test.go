@@ -0,0 +1,175 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestIPRule_normalize(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		domain  string
+		wantID  string
+		wantErr bool
+	}{
+		{cidr: "192.0.2.1", wantID: "192.0.2.1/32"},
+		{cidr: "192.0.2.1/24", domain: "Example.com", wantID: "192.0.2.0/24@example.com"},
+		{cidr: "2001:db8::1/32", wantID: "2001:db8::/32"},
+		{cidr: "::ffff:192.0.2.1", wantID: "192.0.2.1/32"},
+		{cidr: "::ffff:192.0.2.0/120", wantID: "192.0.2.0/24"},
+		{cidr: "192.0.2.0/33", wantErr: true},
+		{cidr: "example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			r := &IPRule{CIDR: tt.cidr, Domain: tt.domain}
+			err := r.normalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && r.ID != tt.wantID {
+				t.Errorf("normalize() ID = %v, want %v", r.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestIPRules_Match(t *testing.T) {
+	raw := map[string]string{}
+	for _, r := range []IPRule{
+		{CIDR: "10.0.0.0/8", Action: IPRuleDeny},
+		{CIDR: "10.1.0.0/16", Action: IPRuleAllow},
+		{CIDR: "10.2.0.0/16", Domain: "example.com", Action: IPRuleAllow},
+		{CIDR: "192.0.2.1", Domain: "example.com", Action: IPRuleDeny},
+		{CIDR: "2001:db8::/32", Action: IPRuleDeny},
+	} {
+		b, _ := json.Marshal(r)
+		raw[r.CIDR+"@"+r.Domain] = string(b)
+	}
+	raw["broken"] = "{"
+	rules := compileIPRules(raw)
+
+	tests := []struct {
+		domain string
+		ip     string
+		want   string
+	}{
+		{domain: "example.net", ip: "10.0.0.1", want: "10.0.0.0/8"},
+		// 狭い範囲のルールを優先する
+		{domain: "example.net", ip: "10.1.0.1", want: "10.1.0.0/16"},
+		// ドメインのルールは全体のルールより優先する
+		{domain: "Example.com", ip: "10.2.0.1", want: "10.2.0.0/16@example.com"},
+		{domain: "example.net", ip: "10.2.0.1", want: "10.0.0.0/8"},
+		{domain: "example.com", ip: "192.0.2.1", want: "192.0.2.1/32@example.com"},
+		{domain: "example.net", ip: "192.0.2.1", want: ""},
+		{domain: "example.net", ip: "2001:db8::1", want: "2001:db8::/32"},
+		{domain: "example.net", ip: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain+"/"+tt.ip, func(t *testing.T) {
+			ip, _ := netip.ParseAddr(tt.ip)
+			got := ""
+			if r := rules.Match(tt.domain, ip); r != nil {
+				got = r.ID
+			}
+			if got != tt.want {
+				t.Errorf("ipRules.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitingroom_CheckIPRule(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	config := &Config{
+		CacheTTLSec:        60,
+		EntryDelaySec:      10,
+		PermittedAccessSec: 10,
+		PermitUnitNumber:   10,
+		PermitIntervalSec:  10,
+		QueueEnableSec:     10,
+		ClientIPHeader:     "X-Real-IP",
+		TrustedProxies:     []string{"127.0.0.0/8"},
+	}
+	wr := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	ctx := context.Background()
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+
+	deny := &IPRule{CIDR: "198.51.100.0/24", Domain: domain, Action: IPRuleDeny, Reason: "abuse"}
+	allow := &IPRule{CIDR: "198.51.100.7", Domain: domain, Action: IPRuleAllow}
+	for _, r := range []*IPRule{deny, allow} {
+		if err := wr.SaveIPRule(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		defer wr.DeleteIPRule(ctx, r.ID)
+	}
+	if err := wr.SaveIPRule(ctx, &IPRule{CIDR: "198.51.100.0/24", Action: "block"}); err == nil {
+		t.Error("SaveIPRule() should reject invalid action")
+	}
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantStatus int
+		wantResult QueueResult
+	}{
+		{
+			name:       "deny",
+			ip:         "198.51.100.1",
+			wantStatus: http.StatusForbidden,
+			wantResult: QueueResult{Denied: true},
+		},
+		{
+			name:       "allow",
+			ip:         "198.51.100.7",
+			wantStatus: http.StatusOK,
+			wantResult: QueueResult{},
+		},
+		{
+			name:       "enabled queue",
+			ip:         "192.0.2.1",
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "127.0.0.1:1234"
+			r.Header.Set("X-Real-IP", tt.ip)
+			// 設定したヘッダー以外は参照しない
+			r.Header.Set("X-Forwarded-For", "192.0.2.1")
+			status, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", true)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Check() status = %v, want %v", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusTooManyRequests && *result != tt.wantResult {
+				t.Errorf("Check() result = %+v, want %+v", *result, tt.wantResult)
+			}
+		})
+	}
+
+	rules, err := wr.GetIPRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, r := range rules {
+		if r.Domain == domain {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("GetIPRules() = %+v, want 2 rules for %s", rules, domain)
+	}
+}
@@ -0,0 +1,61 @@
+package waitingroom
+
+import (
+	"context"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+)
+
+var ErrSoldOut = repository.ErrSoldOut
+
+// 通し番号の発行上限と受付終了の設定
+type QueueLimit struct {
+	MaxSerialNumber int64 // 0なら上限なし
+	Closed          bool
+	IssuedNumber    int64 // 上限を設定してから発行した通し番号の数
+}
+
+// 新しく通し番号を発行できない状態かを返す
+func (l *QueueLimit) SoldOut() bool {
+	return l.Closed || (l.MaxSerialNumber > 0 && l.IssuedNumber >= l.MaxSerialNumber)
+}
+
+func (s *Waitingroom) fetchQueueLimit(ctx context.Context, domain string) (*QueueLimit, error) {
+	max, closed, issued, err := s.repository.GetQueueLimit(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return &QueueLimit{
+		MaxSerialNumber: max,
+		Closed:          closed,
+		IssuedNumber:    issued,
+	}, nil
+}
+
+func (s *Waitingroom) GetQueueLimit(ctx context.Context, domain string) (*QueueLimit, error) {
+	v := s.limitCache.Get(domain)
+	if v != nil {
+		return v.Value(), nil
+	}
+
+	l, err := s.fetchQueueLimit(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheQueueLimit(domain, l)
+	return l, nil
+}
+
+func (s *Waitingroom) cacheQueueLimit(domain string, l *QueueLimit) {
+	if l.SoldOut() {
+		s.limitCache.Set(domain, l, time.Duration(s.Config().CacheTTLSec)*time.Second)
+	} else {
+		s.limitCache.Set(domain, l, time.Duration(s.Config().NegativeCacheTTLSec)*time.Second)
+	}
+}
+
+func (s *Waitingroom) SaveQueueLimit(ctx context.Context, domain string, max int64, closed bool) error {
+	defer s.invalidate(ctx, InvalidateLimit, domain)
+	return s.repository.SaveQueueLimit(ctx, domain, max, closed)
+}
@@ -0,0 +1,143 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ドメインごとのメンテナンス設定
+// StartAtを指定すると予約になり、EndAtを過ぎると自動で解除される
+type Maintenance struct {
+	Domain  string     `json:"domain" validate:"required,fqdn"`
+	Message string     `json:"message"`            // 待機ページに表示するメッセージ
+	StartAt *time.Time `json:"start_at,omitempty"` // 開始日時、未指定なら即時
+	EndAt   *time.Time `json:"end_at,omitempty"`   // 終了予定日時、未指定なら解除するまで
+}
+
+func (m *Maintenance) Active(now time.Time) bool {
+	if m.StartAt != nil && now.Before(*m.StartAt) {
+		return false
+	}
+	return !m.Ended(now)
+}
+
+func (m *Maintenance) Ended(now time.Time) bool {
+	return m.EndAt != nil && !now.Before(*m.EndAt)
+}
+
+func (m *Maintenance) Result() *QueueResult {
+	return &QueueResult{
+		Enabled:          true,
+		Maintenance:      true,
+		Message:          m.Message,
+		MaintenanceEndAt: m.EndAt,
+	}
+}
+
+func (s *Waitingroom) GetMaintenance(ctx context.Context, domain string) (*Maintenance, error) {
+	v := s.maintenanceCache.Get(domain)
+	if v != nil {
+		return v.Value(), nil
+	}
+
+	r, err := s.repository.GetMaintenance(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return s.cacheMaintenance(domain, r)
+}
+
+func (s *Waitingroom) cacheMaintenance(domain, r string) (*Maintenance, error) {
+	if r == "" {
+		s.maintenanceCache.Set(domain, nil, time.Duration(s.Config().NegativeCacheTTLSec)*time.Second)
+		return nil, nil
+	}
+
+	m := &Maintenance{}
+	if err := json.Unmarshal([]byte(r), m); err != nil {
+		return nil, err
+	}
+	m.Domain = domain
+	s.maintenanceCache.Set(domain, m, time.Duration(s.Config().CacheTTLSec)*time.Second)
+	return m, nil
+}
+
+func (s *Waitingroom) GetMaintenances(ctx context.Context) ([]Maintenance, error) {
+	v, err := s.repository.GetMaintenances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Maintenance{}
+	for domain, r := range v {
+		m := Maintenance{}
+		if err := json.Unmarshal([]byte(r), &m); err != nil {
+			return nil, err
+		}
+		m.Domain = domain
+		ret = append(ret, m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Domain < ret[j].Domain
+	})
+	return ret, nil
+}
+
+func (s *Waitingroom) SaveMaintenance(ctx context.Context, m *Maintenance) error {
+	if m.StartAt != nil && m.EndAt != nil && !m.EndAt.After(*m.StartAt) {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	defer s.invalidate(ctx, InvalidateMaintenance, m.Domain)
+	return s.repository.SaveMaintenance(ctx, m.Domain, string(b))
+}
+
+func (s *Waitingroom) DeleteMaintenance(ctx context.Context, domain string) error {
+	defer s.invalidate(ctx, InvalidateMaintenance, domain)
+	_, err := s.repository.DeleteMaintenance(ctx, domain)
+	return err
+}
+
+// 終了予定日時を過ぎたメンテナンスを解除する
+// 複数のインスタンスで実行しても、削除できたインスタンスだけが通知する
+func (s *Waitingroom) RemoveEndedMaintenances(ctx context.Context) error {
+	ms, err := s.GetMaintenances(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get maintenances")
+	}
+
+	now := time.Now()
+	for _, m := range ms {
+		if !m.Ended(now) {
+			continue
+		}
+		deleted, err := s.repository.DeleteMaintenance(ctx, m.Domain)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			s.maintenanceCache.Delete(m.Domain)
+			continue
+		}
+		s.invalidate(ctx, InvalidateMaintenance, m.Domain)
+		slog.Info("maintenance ended", slog.String("domain", m.Domain))
+		if err := NotifySlack(s.Config(), "WaitingRoom maintenance ended", fmt.Sprintf("Domain: %s", m.Domain)); err != nil {
+			slog.Error(
+				"failed to notify slack",
+				slog.String("domain", m.Domain),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return nil
+}
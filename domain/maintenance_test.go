@@ -0,0 +1,50 @@
+package waitingroom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenance_Active(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	tests := []struct {
+		name        string
+		maintenance Maintenance
+		want        bool
+		wantEnded   bool
+	}{
+		{
+			name:        "without schedule",
+			maintenance: Maintenance{},
+			want:        true,
+		},
+		{
+			name:        "scheduled",
+			maintenance: Maintenance{StartAt: &future},
+			want:        false,
+		},
+		{
+			name:        "in progress",
+			maintenance: Maintenance{StartAt: &past, EndAt: &future},
+			want:        true,
+		},
+		{
+			name:        "ended",
+			maintenance: Maintenance{EndAt: &past},
+			want:        false,
+			wantEnded:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.maintenance.Active(now); got != tt.want {
+				t.Errorf("Maintenance.Active() = %v, want %v", got, tt.want)
+			}
+			if got := tt.maintenance.Ended(now); got != tt.wantEnded {
+				t.Errorf("Maintenance.Ended() = %v, want %v", got, tt.wantEnded)
+			}
+		})
+	}
+}
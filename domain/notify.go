@@ -0,0 +1,31 @@
+package waitingroom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// Slackが設定されていれば、タイトルと各項目を通知する
+func NotifySlack(config *Config, title string, texts ...string) error {
+	if config.SlackApiToken == "" || config.SlackChannel == "" {
+		return nil
+	}
+
+	fields := []*slack.TextBlockObject{}
+	for _, t := range texts {
+		fields = append(fields, &slack.TextBlockObject{Type: "plain_text", Text: t})
+	}
+	fields = append(fields, &slack.TextBlockObject{Type: "plain_text", Text: fmt.Sprintf("Time: %s", time.Now().Format("2006-01-02 15:04:05"))})
+
+	c := slack.New(config.SlackApiToken)
+	_, _, err := c.PostMessage(config.SlackChannel, slack.MsgOptionBlocks(
+		slack.NewSectionBlock(
+			&slack.TextBlockObject{Type: "mrkdwn", Text: fmt.Sprintf("*%s*", title)},
+			fields,
+			nil,
+		),
+	))
+	return err
+}
@@ -0,0 +1,374 @@
+package waitingroom
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/pkg/errors"
+	"github.com/pyama86/waitingroom/repository"
+	"golang.org/x/text/language"
+)
+
+//go:embed templates/waiting.html
+var defaultPageTemplateText string
+
+var defaultPageTemplate = template.Must(template.New(pageTemplateName).Parse(defaultPageTemplateText))
+
+const (
+	pageTemplateName  = "waiting"
+	pageConfigName    = "page.json"
+	defaultPageDir    = "default"
+	defaultMessageKey = "default"
+	defaultLang       = "en"
+)
+
+// 待機ページのブランディング設定
+// 管理APIで登録したものが、テンプレートディレクトリのpage.jsonより優先される
+type Page struct {
+	Domain   string            `json:"domain" validate:"required"`
+	Template string            `json:"template"` // html/templateのソース
+	LogoURL  string            `json:"logo_url"` // ロゴ画像のURL
+	Messages map[string]string `json:"messages"` // 言語ごとのメッセージ、defaultはフォールバック
+}
+
+// テンプレートに渡す値
+type PageData struct {
+	Domain              string
+	Lang                string
+	Message             string
+	LogoURL             string
+	SerialNo            int64
+	PermittedNo         int64
+	PeopleAhead         int64
+	RemainingWaitSecond int64
+	RemainingWaitMinute int64
+	Progress            int64
+	PollingIntervalSec  int
+	Maintenance         bool
+	MaintenanceMessage  string
+	MaintenanceEndAt    time.Time
+	SoldOut             bool
+	Throttled           bool
+	Challenge           *Challenge // 作業証明の課題。ページで解いてChallengeCookieに保存する
+	ChallengeCookie     string
+	Captcha             *Captcha // CAPTCHAのウィジェット。取得したトークンをCaptchaCookieに保存する
+	CaptchaCookie       string
+}
+
+func NewPageData(domain string, result *QueueResult, config *Config) *PageData {
+	d := &PageData{
+		Domain:              domain,
+		SerialNo:            result.SerialNo,
+		PermittedNo:         result.PermittedNo,
+		RemainingWaitSecond: result.RemainingWaitSecond,
+		RemainingWaitMinute: (result.RemainingWaitSecond + 59) / 60,
+		PollingIntervalSec:  config.ClientPollingIntervalSec,
+		Maintenance:         result.Maintenance,
+		MaintenanceMessage:  result.Message,
+		SoldOut:             result.SoldOut,
+		Throttled:           result.Throttled,
+		Challenge:           result.Challenge,
+	}
+	if result.Challenge != nil {
+		d.ChallengeCookie = ChallengeCookieKey
+	}
+	if result.Captcha != nil {
+		d.Captcha = result.Captcha
+		d.CaptchaCookie = CaptchaCookieKey
+	}
+	if result.MaintenanceEndAt != nil {
+		d.MaintenanceEndAt = *result.MaintenanceEndAt
+	}
+
+	if result.SerialNo > 0 {
+		if ahead := result.SerialNo - result.PermittedNo - 1; ahead > 0 {
+			d.PeopleAhead = ahead
+		}
+		if result.PermittedNo > 0 {
+			d.Progress = result.PermittedNo * 100 / result.SerialNo
+		}
+		if d.Progress > 100 {
+			d.Progress = 100
+		}
+	}
+	return d
+}
+
+type PageRenderer struct {
+	config        *Config
+	configMu      sync.RWMutex
+	repository    repository.PageRepositoryer
+	pageCache     *ttlcache.Cache[string, *Page]
+	templateCache *ttlcache.Cache[string, *template.Template]
+}
+
+func NewPageRenderer(config *Config, r repository.PageRepositoryer) *PageRenderer {
+	pageCache := ttlcache.New[string, *Page](
+		ttlcache.WithTTL[string, *Page](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *Page](),
+	)
+	templateCache := ttlcache.New[string, *template.Template](
+		ttlcache.WithTTL[string, *template.Template](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *template.Template](),
+	)
+	return &PageRenderer{
+		config:        config,
+		repository:    r,
+		pageCache:     pageCache,
+		templateCache: templateCache,
+	}
+}
+
+func (p *PageRenderer) Config() *Config {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return p.config
+}
+
+func (p *PageRenderer) SetConfig(config *Config) {
+	p.configMu.Lock()
+	p.config = config
+	p.configMu.Unlock()
+	p.Flush()
+}
+
+// Accept-Languageに従ってドメインごとのテンプレートとメッセージを選択し、待機ページを描画する
+func (p *PageRenderer) Render(ctx context.Context, w io.Writer, acceptLanguage string, data *PageData) error {
+	page, err := p.getPage(ctx, data.Domain)
+	if err != nil {
+		return err
+	}
+
+	langs := acceptLanguages(acceptLanguage)
+	data.Lang = langs[0]
+	data.LogoURL = page.LogoURL
+	data.Message = page.Messages[defaultMessageKey]
+	for _, l := range langs {
+		if m, ok := page.Messages[l]; ok {
+			data.Message = m
+			break
+		}
+	}
+
+	t, err := p.getTemplate(data.Domain, page, langs)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return errors.Wrap(err, "failed to execute page template")
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// ドメイン、defaultの順に、管理APIで登録された設定、テンプレートディレクトリのpage.jsonを探す
+func (p *PageRenderer) getPage(ctx context.Context, domain string) (*Page, error) {
+	if v := p.pageCache.Get(domain); v != nil {
+		return v.Value(), nil
+	}
+
+	config := p.Config()
+	page := &Page{}
+	for _, name := range []string{domain, defaultPageDir} {
+		raw, err := p.repository.GetPage(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if raw == "" && config.TemplateDir != "" {
+			b, err := os.ReadFile(filepath.Join(config.TemplateDir, filepath.Base(name), pageConfigName))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			raw = string(b)
+		}
+
+		if raw != "" {
+			if err := json.Unmarshal([]byte(raw), page); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode page: %s", name)
+			}
+			break
+		}
+	}
+
+	page.Domain = domain
+	p.pageCache.Set(domain, page, time.Duration(config.CacheTTLSec)*time.Second)
+	return page, nil
+}
+
+// 管理APIで登録されたテンプレート、ドメインのディレクトリ、defaultディレクトリ、組み込みテンプレートの順に探す
+// Accept-Languageはクライアントが自由に指定できるため、見つけたテンプレートでキャッシュする
+func (p *PageRenderer) getTemplate(domain string, page *Page, langs []string) (*template.Template, error) {
+	config := p.Config()
+	key, path := pageTemplateKey(domain), ""
+	if page.Template == "" {
+		if config.TemplateDir == "" {
+			return defaultPageTemplate, nil
+		}
+		if path = p.findTemplateFile(config.TemplateDir, domain, langs); path == "" {
+			return defaultPageTemplate, nil
+		}
+		key = path
+	}
+	if v := p.templateCache.Get(key); v != nil {
+		return v.Value(), nil
+	}
+
+	var t *template.Template
+	if path == "" {
+		pt, err := template.New(pageTemplateName).Parse(page.Template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse page template: %s", domain)
+		}
+		t = pt
+	} else {
+		ft, err := template.ParseFiles(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse page template: %s", path)
+		}
+		t = ft
+	}
+
+	p.templateCache.Set(key, t, time.Duration(config.CacheTTLSec)*time.Second)
+	return t, nil
+}
+
+// 管理APIで登録されたテンプレートのキー。ファイルのパスと重ならないよう区切る
+func pageTemplateKey(domain string) string {
+	return "page|" + domain
+}
+
+func (p *PageRenderer) findTemplateFile(templateDir, domain string, langs []string) string {
+	for _, dir := range []string{domain, defaultPageDir} {
+		names := []string{}
+		for _, l := range langs {
+			names = append(names, pageTemplateName+"."+l+".html")
+		}
+		names = append(names, pageTemplateName+".html")
+
+		for _, n := range names {
+			path := filepath.Join(templateDir, filepath.Base(dir), n)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// ドメインのディレクトリに置かれたロゴなどのファイルのパスを返す
+func (p *PageRenderer) AssetPath(domain, name string) (string, bool) {
+	templateDir := p.Config().TemplateDir
+	if templateDir == "" {
+		return "", false
+	}
+	for _, dir := range []string{domain, defaultPageDir} {
+		path := filepath.Join(templateDir, filepath.Base(dir), filepath.Base(name))
+		if st, err := os.Stat(path); err == nil && !st.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// 管理APIで変更されたドメインの待機ページをキャッシュから破棄する
+// defaultは他のドメインのフォールバックに使うため、すべて破棄する
+func (p *PageRenderer) Evict(domain string) {
+	if domain == defaultPageDir {
+		p.Flush()
+		return
+	}
+	p.pageCache.Delete(domain)
+	p.templateCache.Delete(pageTemplateKey(domain))
+}
+
+func (p *PageRenderer) Flush() {
+	p.pageCache.DeleteAll()
+	p.templateCache.DeleteAll()
+}
+
+// テンプレートディレクトリを監視し、変更があればキャッシュを破棄する
+func (p *PageRenderer) Watch(ctx context.Context) error {
+	templateDir := p.Config().TemplateDir
+	if templateDir == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	err = filepath.WalkDir(templateDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) {
+				if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+					if err := watcher.Add(ev.Name); err != nil {
+						slog.Error("failed to watch template dir", slog.String("dir", ev.Name), slog.String("error", err.Error()))
+					}
+				}
+			}
+			slog.Info("template changed", slog.String("file", ev.Name), slog.String("op", ev.Op.String()))
+			p.Flush()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("template watcher error", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func acceptLanguages(acceptLanguage string) []string {
+	ret := []string{}
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err == nil {
+		for _, t := range tags {
+			b, _ := t.Base()
+			l := b.String()
+			if l == "und" || slices.Contains(ret, l) {
+				continue
+			}
+			ret = append(ret, l)
+		}
+	}
+
+	if len(ret) == 0 {
+		ret = append(ret, defaultLang)
+	}
+	return ret
+}
@@ -0,0 +1,192 @@
+package waitingroom
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPageRenderer_Render(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(path, body string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			panic(err)
+		}
+	}
+	writeFile(filepath.Join(dir, "default", "waiting.html"), "default:{{.SerialNo}}:{{.Message}}")
+	writeFile(filepath.Join(dir, "example.com", "waiting.html"), "example:{{.PeopleAhead}}")
+	writeFile(filepath.Join(dir, "example.com", "waiting.ja.html"), "example-ja:{{.Lang}}")
+	writeFile(filepath.Join(dir, "example.com", "page.json"), `{"messages":{"default":"wait","ja":"お待ちください"}}`)
+
+	tests := []struct {
+		name           string
+		domain         string
+		templateDir    string
+		acceptLanguage string
+		pageRepoMock   func(*gomock.Controller, string) *repository.MockPageRepositoryer
+		want           string
+	}{
+		{
+			name:           "builtin template",
+			domain:         testutils.TestRandomString(10),
+			acceptLanguage: "ja,en;q=0.8",
+			pageRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockPageRepositoryer {
+				mock := repository.NewMockPageRepositoryer(ctrl)
+				mock.EXPECT().GetPage(context.Background(), gomock.Any()).Return("", nil).Times(2)
+				return mock
+			},
+			want: "あなたの番号",
+		},
+		{
+			name:           "template and message from api",
+			domain:         testutils.TestRandomString(10),
+			acceptLanguage: "fr,en;q=0.8",
+			pageRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockPageRepositoryer {
+				mock := repository.NewMockPageRepositoryer(ctrl)
+				mock.EXPECT().GetPage(context.Background(), domain).Return(`{"template":"{{.Lang}}:{{.Message}}:{{.LogoURL}}","logo_url":"/logo.png","messages":{"en":"hello"}}`, nil).Times(1)
+				return mock
+			},
+			want: "fr:hello:/logo.png",
+		},
+		{
+			name:           "localized template in domain dir",
+			domain:         "example.com",
+			templateDir:    dir,
+			acceptLanguage: "ja",
+			pageRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockPageRepositoryer {
+				mock := repository.NewMockPageRepositoryer(ctrl)
+				mock.EXPECT().GetPage(context.Background(), domain).Return("", nil).Times(1)
+				return mock
+			},
+			want: "example-ja:ja",
+		},
+		{
+			name:           "template in domain dir",
+			domain:         "example.com",
+			templateDir:    dir,
+			acceptLanguage: "en",
+			pageRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockPageRepositoryer {
+				mock := repository.NewMockPageRepositoryer(ctrl)
+				mock.EXPECT().GetPage(context.Background(), domain).Return("", nil).Times(1)
+				return mock
+			},
+			want: "example:30",
+		},
+		{
+			name:           "fallback to default dir",
+			domain:         testutils.TestRandomString(10),
+			templateDir:    dir,
+			acceptLanguage: "en",
+			pageRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockPageRepositoryer {
+				mock := repository.NewMockPageRepositoryer(ctrl)
+				mock.EXPECT().GetPage(context.Background(), domain).Return("", nil).Times(1)
+				mock.EXPECT().GetPage(context.Background(), "default").Return(`{"messages":{"default":"from api"}}`, nil).Times(1)
+				return mock
+			},
+			want: "default:32:from api",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			config := &Config{
+				CacheTTLSec: 10,
+				TemplateDir: tt.templateDir,
+			}
+			p := NewPageRenderer(config, tt.pageRepoMock(ctrl, tt.domain))
+
+			var buf bytes.Buffer
+			data := NewPageData(tt.domain, &QueueResult{SerialNo: 32, PermittedNo: 1, RemainingWaitSecond: 40}, config)
+			if err := p.Render(context.Background(), &buf, tt.acceptLanguage, data); err != nil {
+				t.Errorf("PageRenderer.Render() error = %v", err)
+				return
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("PageRenderer.Render() = %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPageRenderer_TemplateCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "default"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "default", "waiting.html"), []byte("default"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := repository.NewMockPageRepositoryer(ctrl)
+	mock.EXPECT().GetPage(context.Background(), gomock.Any()).Return("", nil).AnyTimes()
+	config := &Config{CacheTTLSec: 10, TemplateDir: dir}
+	p := NewPageRenderer(config, mock)
+
+	// クライアントごとに異なるAccept-Languageでも、同じテンプレートならキャッシュは増えない
+	for _, lang := range []string{"ja", "fr,de", "en;q=0.8,ja", "zh,ko,es"} {
+		var buf bytes.Buffer
+		if err := p.Render(context.Background(), &buf, lang, NewPageData("example.org", &QueueResult{}, config)); err != nil {
+			t.Fatalf("PageRenderer.Render() error = %v", err)
+		}
+	}
+	if n := p.templateCache.Len(); n != 1 {
+		t.Errorf("templateCache.Len() = %d, want 1", n)
+	}
+}
+
+func TestNewPageData(t *testing.T) {
+	challenge := &Challenge{Token: "token", Difficulty: 8}
+	captcha := &Captcha{Provider: CaptchaProviderTurnstile, SiteKey: "site"}
+	tests := []struct {
+		name   string
+		result *QueueResult
+		want   PageData
+	}{
+		{
+			name:   "waiting",
+			result: &QueueResult{SerialNo: 200, PermittedNo: 50, RemainingWaitSecond: 61},
+			want:   PageData{SerialNo: 200, PermittedNo: 50, PeopleAhead: 149, RemainingWaitSecond: 61, RemainingWaitMinute: 2, Progress: 25},
+		},
+		{
+			name:   "throttled",
+			result: &QueueResult{Throttled: true, RemainingWaitSecond: 30},
+			want:   PageData{Throttled: true, RemainingWaitSecond: 30, RemainingWaitMinute: 1},
+		},
+		{
+			name:   "challenge",
+			result: &QueueResult{Challenge: challenge},
+			want:   PageData{Challenge: challenge, ChallengeCookie: ChallengeCookieKey},
+		},
+		{
+			name:   "captcha",
+			result: &QueueResult{Captcha: captcha},
+			want:   PageData{Captcha: captcha, CaptchaCookie: CaptchaCookieKey},
+		},
+		{
+			name:   "not yet numbered",
+			result: &QueueResult{},
+			want:   PageData{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPageData("", tt.result, &Config{})
+			if *got != tt.want {
+				t.Errorf("NewPageData() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
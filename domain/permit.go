@@ -0,0 +1,121 @@
+package waitingroom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// 許可済みのクライアントを照合する厳しさ
+const (
+	PermitBindingOff         = "off"         // IDだけで判定する
+	PermitBindingDomain      = "domain"      // 許可した待合室でのみ有効にする
+	PermitBindingFingerprint = "fingerprint" // 待合室に加えて、IPの範囲とUser-Agentが一致する場合のみ有効にする
+)
+
+// ドメインごとの許可済みのクライアントの照合方法
+type PermitBindingPolicy struct {
+	Domain  string `mapstructure:"domain" validate:"required,fqdn"`
+	Binding string `mapstructure:"binding" validate:"required,oneof=off domain fingerprint"`
+}
+
+func (c *Config) permitBinding(domain string) string {
+	for _, p := range c.PermitBindingPolicies {
+		if p.Domain == domain {
+			return p.Binding
+		}
+	}
+	if c.PermitBinding != "" {
+		return c.PermitBinding
+	}
+	return PermitBindingOff
+}
+
+// 許可したときに保存する記録
+type permitRecord struct {
+	Queue       string `json:"queue"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// 以前の形式で保存された記録は、待合室を持たない記録として扱う
+func parsePermitRecord(v string) *permitRecord {
+	if v == "" {
+		return nil
+	}
+	rec := &permitRecord{}
+	if err := json.Unmarshal([]byte(v), rec); err != nil {
+		return &permitRecord{}
+	}
+	return rec
+}
+
+var permitMismatches, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.permit.mismatches",
+	metric.WithDescription("number of permitted clients rejected by binding"),
+)
+
+// クッキーを共有した別の端末を見分けるためのハッシュ
+// 回線の切り替えで弾かないよう、IPv4は/24、IPv6は/64を同じクライアントとみなす
+func permitFingerprint(r *http.Request, ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	ip = ip.Unmap()
+	bits := 24
+	if ip.Is6() {
+		bits = 64
+	}
+	h := sha256.New()
+	h.Write([]byte(netip.PrefixFrom(ip, bits).Masked().String()))
+	h.Write([]byte{0})
+	h.Write([]byte(r.UserAgent()))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// 許可の記録を照合するか
+func (c *Client) bound() bool {
+	return c.binding == PermitBindingDomain || c.binding == PermitBindingFingerprint
+}
+
+// クッキーや許可の記録が、照合方法でこのクライアントのものといえなければ理由を返す
+// 待合室を持たない以前の形式の記録は、期限まで照合せずに許可する
+func (c *Client) permitMismatch(rec *permitRecord) string {
+	if !c.bound() {
+		return ""
+	}
+	queue := c.queueKey().String()
+	if c.Queue != "" && c.Queue != queue {
+		return "cookie"
+	}
+	if rec == nil || rec.Queue == "" {
+		return ""
+	}
+	if rec.Queue != queue {
+		return "queue"
+	}
+	if c.binding == PermitBindingFingerprint && rec.Fingerprint != c.fingerprint {
+		return "fingerprint"
+	}
+	return ""
+}
+
+func (s *Waitingroom) rejectPermit(ctx context.Context, c *Client, reason string) error {
+	permitMismatches.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("domain", c.queueKey().String()),
+		attribute.String("reason", reason),
+	))
+	slog.Info(
+		"permit mismatch",
+		slog.String("permit client", c.permitKey()),
+		slog.String("reason", reason),
+	)
+	return ErrPermitMismatch
+}
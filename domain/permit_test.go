@@ -0,0 +1,162 @@
+package waitingroom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestPermitFingerprint(t *testing.T) {
+	fingerprint := func(ip, ua string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", ua)
+		return permitFingerprint(r, netip.MustParseAddr(ip))
+	}
+
+	if fingerprint("192.0.2.1", "a") != fingerprint("192.0.2.200", "a") {
+		t.Error("fingerprint should be same in /24")
+	}
+	if fingerprint("192.0.2.1", "a") == fingerprint("198.51.100.1", "a") {
+		t.Error("fingerprint should differ by ip prefix")
+	}
+	if fingerprint("2001:db8::1", "a") != fingerprint("2001:db8::ffff:1", "a") {
+		t.Error("ipv6 fingerprint should be same in /64")
+	}
+	if fingerprint("192.0.2.1", "a") == fingerprint("192.0.2.1", "b") {
+		t.Error("fingerprint should differ by user agent")
+	}
+}
+
+func TestWaitingroom_CheckPermitBinding(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	ctx := context.Background()
+	newDomain := func() string {
+		domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+		redisClient.SetEX(ctx, repository.Keys().Queue(domain, "permitted_no"), 100, time.Minute)
+		return domain
+	}
+	check := func(wr *Waitingroom, domain, ip, ua string, c *Client) *QueueResult {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("User-Agent", ua)
+		v, _ := testutils.SecureCookie.Encode(ClientCookieKey, c)
+		r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: v})
+		_, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", true)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name        string
+		binding     string
+		otherDomain bool
+		otherServer bool
+		ip          string
+		ua          string
+		want        bool
+	}{
+		{name: "same client", ip: "192.0.2.1", ua: "a", want: true},
+		{name: "other domain", binding: PermitBindingDomain, otherDomain: true, ip: "192.0.2.1", ua: "a"},
+		{name: "other domain by default", otherDomain: true, ip: "192.0.2.1", ua: "a", want: true},
+		{name: "other domain without binding", binding: PermitBindingOff, otherDomain: true, ip: "192.0.2.1", ua: "a", want: true},
+		{name: "other user agent", binding: PermitBindingFingerprint, ip: "192.0.2.1", ua: "b"},
+		{name: "other ip", binding: PermitBindingFingerprint, ip: "198.51.100.1", ua: "a"},
+		{name: "same ip prefix", binding: PermitBindingFingerprint, ip: "192.0.2.100", ua: "a", want: true},
+		{name: "other user agent with domain binding", binding: PermitBindingDomain, ip: "192.0.2.1", ua: "b", want: true},
+		{name: "other user agent on other server", binding: PermitBindingFingerprint, otherServer: true, ip: "192.0.2.1", ua: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := newDomain()
+			config := &Config{
+				CacheTTLSec:        60,
+				EntryDelaySec:      10,
+				PermittedAccessSec: 10,
+				PermitUnitNumber:   10,
+				PermitIntervalSec:  10,
+				QueueEnableSec:     10,
+			}
+			target := domain
+			if tt.otherDomain {
+				target = newDomain()
+			}
+			if tt.binding != "" {
+				config.PermitBindingPolicies = []PermitBindingPolicy{{Domain: target, Binding: tt.binding}}
+			}
+			wr := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+
+			client := &Client{ID: testutils.TestRandomString(10), SerialNumber: 1}
+			if result := check(wr, domain, "192.0.2.1", "a", client); !result.PermittedClient {
+				t.Fatalf("Check() = %+v, want permitted", *result)
+			}
+
+			// 他のサーバーはキャッシュを持たず、Redisの記録で照合する
+			if tt.otherServer {
+				wr = NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+			}
+			result := check(wr, target, tt.ip, tt.ua, client)
+			if result.PermittedClient != tt.want {
+				t.Errorf("Check() permitted = %v, want %v", result.PermittedClient, tt.want)
+			}
+			// 使い回したクライアントには新しいIDを発行する
+			if !tt.want && (result.ID == client.ID || result.SerialNo != 0) {
+				t.Errorf("Check() = %+v, want new id", *result)
+			}
+		})
+	}
+}
+
+func TestWaitingroom_CheckPermitMismatchOnPermit(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	ctx := context.Background()
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	redisClient.SetEX(ctx, repository.Keys().Queue(domain, "permitted_no"), 100, time.Minute)
+	config := &Config{
+		CacheTTLSec:           60,
+		EntryDelaySec:         10,
+		PermittedAccessSec:    10,
+		PermitUnitNumber:      10,
+		PermitIntervalSec:     10,
+		QueueEnableSec:        10,
+		PermitBindingPolicies: []PermitBindingPolicy{{Domain: domain, Binding: PermitBindingFingerprint}},
+	}
+	check := func(wr *Waitingroom, ua string, c *Client) (int, *QueueResult) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", ua)
+		v, _ := testutils.SecureCookie.Encode(ClientCookieKey, c)
+		r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: v})
+		status, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", true)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		return status, result
+	}
+
+	client := &Client{ID: testutils.TestRandomString(10), SerialNumber: 1}
+	if _, result := check(NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient)), "a", client); !result.PermittedClient {
+		t.Fatalf("Check() = %+v, want permitted", *result)
+	}
+
+	// 許可される前に未許可をキャッシュしたサーバーで、別の端末が使い回す
+	wr := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	wr.permittedClientCache.Set(client.ID, nil, time.Minute)
+	current := redisClient.Get(ctx, repository.Keys().Queue(domain, "current_no")).Val()
+	status, result := check(wr, "b", client)
+	if status != http.StatusTooManyRequests || result.PermittedClient || result.ID != "" || result.SerialNo != 0 {
+		t.Errorf("Check() = %d %+v, want waiting without id", status, *result)
+	}
+	// 新しい通し番号は、次の要求で発行数の制限などを経て発行する
+	if v := redisClient.Get(ctx, repository.Keys().Queue(domain, "current_no")).Val(); v != current {
+		t.Errorf("current_no = %s, want %s", v, current)
+	}
+}
@@ -2,69 +2,403 @@ package waitingroom
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
+	pkgerrors "github.com/pkg/errors"
 	"github.com/pyama86/waitingroom/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// 失敗が続いた待合室の処理を見送る時間の上限
+const maxPermitBackoff = 10 * time.Minute
+
+// 停止時にロックを手放すまで待つ時間
+const lockReleaseTimeout = 3 * time.Second
+
+// 判定周期に加える揺らぎの割合。インスタンス間で処理が重ならないようにする
+const permitIntervalJitter = 0.1
+
 type AccessController struct {
 	config      *Config
+	configMu    sync.RWMutex
 	cluster     *Cluster
 	waitingroom *Waitingroom
+	gc          *repository.GarbageCollector
+	starving    map[string]int // 待合室ごとの、配分が0だった連続回数
+
+	backoffMu sync.Mutex
+	backoff   map[string]*permitBackoff
+
+	statusMu sync.RWMutex
+	status   WorkerStatus
+}
+
+// 許可判定ワーカーの直近の状態
+type WorkerStatus struct {
+	LastTick     time.Time `json:"last_tick"`
+	LeaderQueues []string  `json:"leader_queues"` // 直近の判定で許可番号のロックを取り、許可番号を進めた待合室
+}
+
+// 処理に失敗した待合室の、連続失敗回数と次に処理する時刻
+type permitBackoff struct {
+	failures int
+	until    time.Time
 }
 
+var tickDuration, _ = otel.Meter("github.com/pyama86/waitingroom").Float64Histogram(
+	"waitingroom.permit.tick.duration",
+	metric.WithDescription("duration of the permit worker per queue"),
+	metric.WithUnit("s"),
+)
+
 func NewAccessController(config *Config, redisClient *redis.Client) *AccessController {
 	repo := repository.NewWaitingroomRepository(redisClient)
 	wr := NewWaitingroom(config, repo)
 
-	clusterRepo := repository.NewClusterRepository(redisClient)
+	// ロックや片付けの対象を、待合室と同じ配置のキーにする
+	clusterRepo := repository.NewClusterRepository(redisClient, repo.Keyspace())
 	cluster := NewCluster(clusterRepo)
 	return &AccessController{
 		config:      config,
 		waitingroom: wr,
 		cluster:     cluster,
+		gc:          repository.NewGarbageCollector(redisClient, repo.Keyspace()),
+		starving:    map[string]int{},
 	}
 }
+func (a *AccessController) Config() *Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
+}
+
+func (a *AccessController) SetConfig(config *Config) {
+	a.configMu.Lock()
+	a.config = config
+	a.configMu.Unlock()
+	a.waitingroom.SetConfig(config)
+}
+
+// 有効な待合室の許可番号を並列に進める
+// 待合室ごとのエラーは他の待合室の処理を止めず、まとめて返す
 func (a *AccessController) Do(ctx context.Context, e *echo.Echo) error {
 	members, err := a.waitingroom.GetEnableDomains(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, m := range members {
+	config := a.Config()
+	elapsed := map[string]time.Duration{}
+	errs := map[string]error{}
+	var mu sync.Mutex
+	record := func(m string, d time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		elapsed[m] += d
+		if err != nil {
+			errs[m] = err
+		}
+	}
+
+	// 有効でなくなった待合室を片付け、配分に必要な待ち人数を集める
+	demands := []budgetDemand{}
+	a.parallel(ctx, a.ready(members), func(ctx context.Context, m string) error {
 		slog.Info("try permit access", "domain", m)
+		start := time.Now()
+		d, ok, err := a.demand(ctx, m, config)
+		record(m, time.Since(start), err)
+		if err == nil && ok {
+			mu.Lock()
+			demands = append(demands, d)
+			mu.Unlock()
+		}
+		return err
+	})
 
-		ok, err := a.waitingroom.IsEnabledQueue(ctx, m)
-		if err != nil {
-			return err
+	units := a.permitUnits(config, demands)
+	keys := []string{}
+	for _, d := range demands {
+		keys = append(keys, d.Key)
+	}
+	leaders := []string{}
+	a.parallel(ctx, keys, func(ctx context.Context, m string) error {
+		start := time.Now()
+		held, err := a.permit(ctx, m, units[m], config)
+		record(m, time.Since(start), err)
+		if held {
+			mu.Lock()
+			leaders = append(leaders, m)
+			mu.Unlock()
 		}
-		if !ok {
-			slog.Info(
-				"domain is not enabled",
-				"domain", m,
-			)
-			if err := a.waitingroom.Reset(ctx, m); err != nil {
-				return err
+		return err
+	})
+	sort.Strings(leaders)
+	a.setStatus(WorkerStatus{LastTick: time.Now(), LeaderQueues: leaders})
+
+	ret := []error{}
+	for m, d := range elapsed {
+		a.updateBackoff(m, errs[m], config)
+		tickDuration.Record(ctx, d.Seconds(), metric.WithAttributes(attribute.String("domain", m)))
+		slog.Debug("permit tick", slog.String("domain", m), slog.Duration("elapsed", d))
+		if errs[m] != nil {
+			ret = append(ret, pkgerrors.Wrapf(errs[m], "domain %s", m))
+		}
+	}
+
+	if len(members) > 0 {
+		if err := a.waitingroom.ExtendDomainsTTL(ctx); err != nil {
+			ret = append(ret, err)
+		}
+	}
+	return errors.Join(ret...)
+}
+
+// 待合室が有効なら配分のための状態を返し、有効でなければ片付けてfalseを返す
+func (a *AccessController) demand(ctx context.Context, m string, config *Config) (budgetDemand, bool, error) {
+	d := budgetDemand{Key: m, Weight: config.budgetWeight(m)}
+	ok, err := a.waitingroom.IsEnabledQueue(ctx, m)
+	if err != nil {
+		return d, false, err
+	}
+	if !ok {
+		slog.Info(
+			"domain is not enabled",
+			"domain", m,
+		)
+		return d, false, a.waitingroom.Reset(ctx, m)
+	}
+
+	if config.GlobalPermitBudget == 0 {
+		return d, true, nil
+	}
+	cn, err := a.waitingroom.GetCurrentNumber(ctx, m)
+	if err != nil && err != redis.Nil {
+		return d, false, err
+	}
+	an, err := a.waitingroom.GetCurrentPermitNumber(ctx, m)
+	if err != nil {
+		return d, false, err
+	}
+	d.Backlog = max(cn-an, 0)
+	return d, true, nil
+}
+
+// ロックを取れたインスタンスだけが許可番号を進める。ロックを取れたかを返す
+func (a *AccessController) permit(ctx context.Context, m string, unit int64, config *Config) (bool, error) {
+	ok, err := a.cluster.TryUpdatePermittedNumberLock(ctx, m, time.Duration(config.PermitIntervalSec)*time.Second)
+	if err != nil || !ok {
+		return false, err
+	}
+	err = a.waitingroom.AppendPermitNumberBy(ctx, m, unit)
+	if ctx.Err() != nil {
+		// 停止で中断した場合は、他のインスタンスが次の周期を待たずに引き継げるようロックを手放す
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+		defer cancel()
+		if rerr := a.cluster.ReleasePermittedNumberLock(rctx, m); rerr != nil {
+			slog.Error("can't release lock", slog.String("domain", m), slog.String("error", rerr.Error()))
+		}
+	}
+	if errors.Is(err, ErrClientNotIncrese) {
+		return true, nil
+	}
+	return err == nil, err
+}
+
+func (a *AccessController) WatchInvalidations(ctx context.Context) error {
+	return a.waitingroom.WatchInvalidations(ctx)
+}
+
+func (a *AccessController) setStatus(status WorkerStatus) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	a.status = status
+}
+
+func (a *AccessController) Status() WorkerStatus {
+	a.statusMu.RLock()
+	defer a.statusMu.RUnlock()
+	return a.status
+}
+
+// keysをPermitWorkerConcurrencyまで並列に処理する
+func (a *AccessController) parallel(ctx context.Context, keys []string, fn func(context.Context, string) error) {
+	concurrency := max(a.Config().PermitWorkerConcurrency, 1)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, k := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(k string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, k); err != nil {
+				slog.Error(
+					"error permit worker",
+					slog.String("domain", k),
+					slog.String("error", err.Error()),
+				)
 			}
+		}(k)
+	}
+	wg.Wait()
+}
+
+// バックオフ中の待合室を除いて返す
+func (a *AccessController) ready(members []string) []string {
+	a.backoffMu.Lock()
+	defer a.backoffMu.Unlock()
+	now := time.Now()
+	ret := []string{}
+	for _, m := range members {
+		if b, ok := a.backoff[m]; ok && now.Before(b.until) {
+			slog.Debug("skip permit access in backoff", slog.String("domain", m), slog.Time("until", b.until))
 			continue
 		}
+		ret = append(ret, m)
+	}
+	return ret
+}
 
-		if ok, err := a.cluster.TryUpdatePermittedNumberLock(ctx, m, time.Duration(a.config.PermitIntervalSec)*time.Second); err != nil {
-			return err
-		} else if ok {
-			if err := a.waitingroom.AppendPermitNumber(ctx, m); err != nil {
-				return err
-			}
+// 失敗するたびに判定周期の2倍ずつ間隔を空け、成功したら元に戻す
+func (a *AccessController) updateBackoff(m string, err error, config *Config) {
+	a.backoffMu.Lock()
+	defer a.backoffMu.Unlock()
+	if err == nil {
+		delete(a.backoff, m)
+		return
+	}
+	if a.backoff == nil {
+		a.backoff = map[string]*permitBackoff{}
+	}
+	b, ok := a.backoff[m]
+	if !ok {
+		b = &permitBackoff{}
+		a.backoff[m] = b
+	}
+	b.failures++
+	d := time.Duration(config.PermitIntervalSec) * time.Second << min(b.failures-1, 10)
+	b.until = time.Now().Add(min(d, maxPermitBackoff))
+}
+
+// 判定周期ごとにDoを実行する。周期にはインスタンス間で重ならないよう揺らぎを加える
+// ctxがキャンセルされると、実行中の判定を打ち切って戻る
+func (a *AccessController) Run(ctx context.Context, e *echo.Echo) {
+	ticker := time.NewTicker(a.nextInterval())
+	defer ticker.Stop()
+	for {
+		if err := a.Do(ctx, e); err != nil && err != redis.Nil && ctx.Err() == nil {
+			slog.Error(
+				"error permit worker",
+				slog.String("error", err.Error()),
+			)
+		}
+		if err := a.RemoveEndedMaintenances(ctx); err != nil && ctx.Err() == nil {
+			slog.Error(
+				"error remove ended maintenances",
+				slog.String("error", err.Error()),
+			)
+		}
+		if err := a.RemoveExpiredWhiteList(ctx); err != nil && ctx.Err() == nil {
+			slog.Error(
+				"error remove expired whitelist",
+				slog.String("error", err.Error()),
+			)
 		}
 
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ticker.Reset(a.nextInterval())
+		}
 	}
+}
 
-	if len(members) > 0 {
-		return a.waitingroom.ExtendDomainsTTL(ctx)
+func (a *AccessController) nextInterval() time.Duration {
+	interval := time.Duration(a.Config().PermitIntervalSec) * time.Second
+	jitter := time.Duration(float64(interval) * permitIntervalJitter * (rand.Float64()*2 - 1))
+	return max(interval+jitter, time.Second)
+}
+
+// 待合室ごとに今回許可する数を返す
+// GlobalPermitBudgetが0なら、どの待合室にもPermitUnitNumberを許可する
+func (a *AccessController) permitUnits(config *Config, demands []budgetDemand) map[string]int64 {
+	ret := map[string]int64{}
+	if config.GlobalPermitBudget == 0 {
+		for _, d := range demands {
+			ret[d.Key] = config.PermitUnitNumber
+		}
+		return ret
+	}
+
+	// 配分が0だった期間の長い待合室に端数を優先して配る
+	sort.SliceStable(demands, func(i, j int) bool {
+		if a.starving[demands[i].Key] != a.starving[demands[j].Key] {
+			return a.starving[demands[i].Key] > a.starving[demands[j].Key]
+		}
+		return demands[i].Key < demands[j].Key
+	})
+
+	ret = allocateBudget(config.BudgetStrategy, config.GlobalPermitBudget, demands)
+	a.reportStarvation(demands, ret)
+	for _, d := range demands {
+		slog.Info(
+			"allocate permit budget",
+			slog.String("domain", d.Key),
+			slog.Int64("backlog", d.Backlog),
+			slog.Int64("weight", d.Weight),
+			slog.Int64("unit", ret[d.Key]),
+		)
 	}
+	return ret
+}
+
+// 待っているクライアントがいるのに配分が続けて0だった待合室を通知する
+func (a *AccessController) reportStarvation(demands []budgetDemand, units map[string]int64) {
+	starving := map[string]int{}
+	for _, d := range demands {
+		if d.Backlog == 0 || units[d.Key] > 0 {
+			continue
+		}
+		starving[d.Key] = a.starving[d.Key] + 1
+		if starving[d.Key] != starvationReportTicks {
+			continue
+		}
+		slog.Warn(
+			"domain is starving",
+			slog.String("domain", d.Key),
+			slog.Int64("backlog", d.Backlog),
+			slog.Int("ticks", starving[d.Key]),
+		)
+		if err := NotifySlack(a.Config(), "WaitingRoom domain is starving",
+			fmt.Sprintf("Domain: %s", d.Key),
+			fmt.Sprintf("Backlog: %d", d.Backlog),
+			fmt.Sprintf("GlobalPermitBudget: %d", a.Config().GlobalPermitBudget),
+		); err != nil {
+			slog.Error(
+				"failed to notify slack",
+				slog.String("domain", d.Key),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	a.starving = starving
+}
+
+func (a *AccessController) RemoveEndedMaintenances(ctx context.Context) error {
+	return a.waitingroom.RemoveEndedMaintenances(ctx)
+}
 
-	return nil
+func (a *AccessController) RemoveExpiredWhiteList(ctx context.Context) error {
+	return a.waitingroom.RemoveExpiredWhiteList(ctx)
 }
@@ -2,6 +2,8 @@ package waitingroom
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,6 +35,7 @@ func TestAccessController_Do(t *testing.T) {
 				mock.EXPECT().GetCurrentNumber(context.Background(), domain).Return(int64(2000), nil).Times(1)
 				mock.EXPECT().GetLastNumber(context.Background(), domain).Return(int64(1), nil).Times(1)
 				mock.EXPECT().AppendPermitNumber(context.Background(), domain, int64(1000), 600*time.Second).Return(nil)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				mock.EXPECT().ExtendCurrentNumberTTL(context.Background(), domain, 600*time.Second).Return(nil)
 				mock.EXPECT().SaveLastNumber(context.Background(), domain, int64(2000), 600*time.Second).Return(nil)
@@ -54,6 +57,7 @@ func TestAccessController_Do(t *testing.T) {
 				mock.EXPECT().GetEnableDomains(context.Background(), int64(0), int64(-1)).Return([]string{"unmatch"}, nil)
 				mock.EXPECT().GetCurrentPermitNumber(context.Background(), "unmatch").Return(int64(-1), nil).Times(1)
 				mock.EXPECT().DisableDomain(context.Background(), "unmatch").Return(nil).Times(1)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 				mock.EXPECT().ExtendDomainsTTL(context.Background(), 600*time.Second*2).Return(nil)
 				return mock
 			},
@@ -104,3 +108,119 @@ func TestAccessController_Do(t *testing.T) {
 		})
 	}
 }
+
+func TestAccessController_DoIsolateErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ok := testutils.TestRandomString(20)
+	ng := testutils.TestRandomString(20)
+
+	waitingroomRepoMock := repository.NewMockWaitingroomRepositoryer(ctrl)
+	waitingroomRepoMock.EXPECT().GetEnableDomains(context.Background(), int64(0), int64(-1)).Return([]string{ng, ok}, nil).Times(2)
+	// 失敗した待合室はバックオフの間、読み出しもされない
+	waitingroomRepoMock.EXPECT().GetCurrentPermitNumber(context.Background(), ng).Return(int64(0), errors.New("unexpected")).Times(1)
+	waitingroomRepoMock.EXPECT().GetCurrentPermitNumber(context.Background(), ok).Return(int64(1), nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().GetCurrentPermitNumberTTL(context.Background(), ok).Return(time.Second, nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().GetCurrentNumber(context.Background(), ok).Return(int64(2000), nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().GetLastNumber(context.Background(), ok).Return(int64(1), nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().AppendPermitNumber(context.Background(), ok, int64(1000), 600*time.Second).Return(nil).Times(2)
+	waitingroomRepoMock.EXPECT().ExtendCurrentNumberTTL(context.Background(), ok, 600*time.Second).Return(nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().SaveLastNumber(context.Background(), ok, int64(2000), 600*time.Second).Return(nil).AnyTimes()
+	waitingroomRepoMock.EXPECT().ExtendDomainsTTL(context.Background(), 600*time.Second*2).Return(nil).Times(2)
+	waitingroomRepoMock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	clusterRepoMock := repository.NewMockClusterRepositoryer(ctrl)
+	clusterRepoMock.EXPECT().GetLockforPermittedNumber(context.Background(), gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+
+	config := &Config{
+		PermitUnitNumber:        1000,
+		PermitIntervalSec:       60,
+		QueueEnableSec:          600,
+		PermitWorkerConcurrency: 2,
+	}
+	a := &AccessController{
+		config:      config,
+		waitingroom: NewWaitingroom(config, waitingroomRepoMock),
+		cluster:     NewCluster(clusterRepoMock),
+	}
+
+	e := echo.New()
+	err := a.Do(context.Background(), e)
+	if err == nil || !strings.Contains(err.Error(), ng) {
+		t.Errorf("AccessController.Do() error = %v, want error of %s", err, ng)
+	}
+	if a.backoff[ng] == nil || a.backoff[ng].failures != 1 {
+		t.Errorf("AccessController.Do() backoff = %v, want 1 failure of %s", a.backoff, ng)
+	}
+	if s := a.Status(); s.LastTick.IsZero() || len(s.LeaderQueues) != 1 || s.LeaderQueues[0] != ok {
+		t.Errorf("AccessController.Status() = %+v, want leader of %s", s, ok)
+	}
+
+	if err := a.Do(context.Background(), e); err != nil {
+		t.Errorf("AccessController.Do() error = %v, want nil while %s is in backoff", err, ng)
+	}
+}
+
+func TestAccessController_updateBackoff(t *testing.T) {
+	config := &Config{PermitIntervalSec: 60}
+	a := &AccessController{config: config}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, maxPermitBackoff, maxPermitBackoff} {
+		a.updateBackoff("example.com", errors.New("unexpected"), config)
+		got := time.Until(a.backoff["example.com"].until)
+		if got > want || got < want-time.Second {
+			t.Errorf("updateBackoff() %d: backoff = %v, want %v", i, got, want)
+		}
+	}
+	if len(a.ready([]string{"example.com", "example.net"})) != 1 {
+		t.Errorf("ready() should skip domain in backoff")
+	}
+
+	a.updateBackoff("example.com", nil, config)
+	if len(a.ready([]string{"example.com", "example.net"})) != 2 {
+		t.Errorf("ready() should not skip domain after success")
+	}
+}
+
+func TestAccessController_DoReleaseLockOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	domain := testutils.TestRandomString(20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	waitingroomRepoMock := repository.NewMockWaitingroomRepositoryer(ctrl)
+	waitingroomRepoMock.EXPECT().GetEnableDomains(gomock.Any(), int64(0), int64(-1)).Return([]string{domain}, nil)
+	waitingroomRepoMock.EXPECT().GetCurrentPermitNumber(gomock.Any(), domain).Return(int64(1), nil).Times(2)
+	waitingroomRepoMock.EXPECT().GetCurrentPermitNumberTTL(gomock.Any(), domain).Return(time.Duration(0), context.Canceled)
+	waitingroomRepoMock.EXPECT().ExtendDomainsTTL(gomock.Any(), 600*time.Second*2).Return(context.Canceled)
+
+	clusterRepoMock := repository.NewMockClusterRepositoryer(ctrl)
+	// ロックを取った直後に停止が始まった
+	clusterRepoMock.EXPECT().GetLockforPermittedNumber(gomock.Any(), domain, gomock.Any()).DoAndReturn(
+		func(context.Context, string, time.Duration) (bool, error) {
+			cancel()
+			return true, nil
+		})
+	clusterRepoMock.EXPECT().ReleaseLockforPermittedNumber(gomock.Any(), domain).DoAndReturn(
+		func(ctx context.Context, _ string) error {
+			if ctx.Err() != nil {
+				t.Errorf("lock should be released with a live context: %v", ctx.Err())
+			}
+			return nil
+		})
+
+	config := &Config{
+		PermitUnitNumber: 1000,
+		QueueEnableSec:   600,
+	}
+	a := &AccessController{
+		config:      config,
+		waitingroom: NewWaitingroom(config, waitingroomRepoMock),
+		cluster:     NewCluster(clusterRepoMock),
+	}
+
+	if err := a.Do(ctx, echo.New()); err == nil {
+		t.Errorf("AccessController.Do() error = nil, want canceled")
+	}
+}
@@ -0,0 +1,227 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ドメインとルート名を区切る文字。ルートの待合室は example.com:checkout のようなキーになる
+const RouteSeparator = ":"
+
+// パスのプレフィックスごとに待合室を分けるルール
+type RouteRule struct {
+	Name   string `json:"name" validate:"required,alphanum,max=32"` // 待合室のキーとクッキー名に使う
+	Prefix string `json:"prefix" validate:"required,startswith=/"`
+}
+
+func (r *RouteRule) Match(path string) bool {
+	return matchPathPrefix(r.Prefix, path)
+}
+
+// プレフィックスが/で終わらなければ、パスの区切りで一致したものだけを対象にする
+// クッキーのPath属性と同じ判定になる
+func matchPathPrefix(prefix, path string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// ドメインごとのルート設定
+type Route struct {
+	Domain string      `json:"domain" validate:"required,fqdn"`
+	Rules  []RouteRule `json:"rules" validate:"dive"`
+}
+
+// 最も長いプレフィックスで一致したルールを返す。一致しなければnilを返す
+func (r *Route) Match(path string) *RouteRule {
+	var ret *RouteRule
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if rule.Match(path) && (ret == nil || len(rule.Prefix) > len(ret.Prefix)) {
+			ret = rule
+		}
+	}
+	return ret
+}
+
+func (r *Route) validate() error {
+	names := map[string]bool{}
+	prefixes := map[string]bool{}
+	for _, rule := range r.Rules {
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate route name: %s", rule.Name)
+		}
+		if prefixes[rule.Prefix] {
+			return fmt.Errorf("duplicate route prefix: %s", rule.Prefix)
+		}
+		names[rule.Name] = true
+		prefixes[rule.Prefix] = true
+	}
+	return nil
+}
+
+// 待合室の単位。ルールに一致しなければドメイン全体、グループに属していればグループで1つの待合室になる
+type QueueKey struct {
+	Domain string
+	Group  *Group
+	Rule   *RouteRule
+}
+
+func (k QueueKey) base() string {
+	if k.Group != nil {
+		return GroupKeyPrefix + k.Group.Name
+	}
+	return k.Domain
+}
+
+// 通し番号や許可番号を保存するキー
+func (k QueueKey) String() string {
+	if k.Rule == nil {
+		return k.base()
+	}
+	return k.base() + RouteSeparator + k.Rule.Name
+}
+
+// グループではドメインごとのクッキーと混ざらないよう、グループ名を含める
+func (k QueueKey) cookieName() string {
+	name := ClientCookieKey
+	if k.Group != nil {
+		name += "-group-" + k.Group.Name
+	}
+	if k.Rule != nil {
+		name += "-" + k.Rule.Name
+	}
+	return name
+}
+
+func (k QueueKey) cookiePath() string {
+	if k.Rule == nil {
+		return "/"
+	}
+	return k.Rule.Prefix
+}
+
+func (k QueueKey) cookieDomain() string {
+	if k.Group != nil && k.Group.CookieDomain != "" {
+		return k.Group.CookieDomain
+	}
+	return k.Domain
+}
+
+// 待合室のキーをドメインまたはグループと、ルート名に分ける
+func SplitQueueKey(key string) (string, string) {
+	domain, name, _ := strings.Cut(key, RouteSeparator)
+	return domain, name
+}
+
+// ドメインまたはグループと、ルート名からなる待合室のキーかを検証する
+func ValidateQueueKey(key string) error {
+	domain, name := SplitQueueKey(key)
+	validate := validator.New()
+	if group, ok := strings.CutPrefix(domain, GroupKeyPrefix); ok {
+		if err := validate.Var(group, "required,alphanum,max=32"); err != nil {
+			return fmt.Errorf("invalid group %s: %w", group, err)
+		}
+	} else if err := validate.Var(domain, "required,fqdn"); err != nil {
+		return fmt.Errorf("invalid domain %s: %w", domain, err)
+	}
+	if strings.Contains(key, RouteSeparator) {
+		if err := validate.Var(name, "required,alphanum,max=32"); err != nil {
+			return fmt.Errorf("invalid route name %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Waitingroom) GetRoute(ctx context.Context, domain string) (*Route, error) {
+	v := s.routeCache.Get(domain)
+	if v != nil {
+		return v.Value(), nil
+	}
+
+	r, err := s.repository.GetRoute(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return s.cacheRoute(domain, r)
+}
+
+func (s *Waitingroom) cacheRoute(domain, r string) (*Route, error) {
+	if r == "" {
+		s.routeCache.Set(domain, nil, time.Duration(s.Config().NegativeCacheTTLSec)*time.Second)
+		return nil, nil
+	}
+
+	route := &Route{}
+	if err := json.Unmarshal([]byte(r), route); err != nil {
+		return nil, err
+	}
+	route.Domain = domain
+	s.routeCache.Set(domain, route, time.Duration(s.Config().CacheTTLSec)*time.Second)
+	return route, nil
+}
+
+// ドメインが属するグループと、リクエストのパスから待合室のキーを決める
+func (s *Waitingroom) ResolveQueueKey(ctx context.Context, domain, path string) (QueueKey, error) {
+	key := QueueKey{Domain: domain}
+	group, err := s.GetGroupByDomain(ctx, domain)
+	if err != nil {
+		return key, err
+	}
+	key.Group = group
+
+	route, err := s.GetRoute(ctx, domain)
+	if err != nil {
+		return key, err
+	}
+	if route != nil {
+		key.Rule = route.Match(path)
+	}
+	return key, nil
+}
+
+func (s *Waitingroom) GetRoutes(ctx context.Context) ([]Route, error) {
+	v, err := s.repository.GetRoutes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Route{}
+	for domain, r := range v {
+		route := Route{}
+		if err := json.Unmarshal([]byte(r), &route); err != nil {
+			return nil, err
+		}
+		route.Domain = domain
+		ret = append(ret, route)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Domain < ret[j].Domain
+	})
+	return ret, nil
+}
+
+func (s *Waitingroom) SaveRoute(ctx context.Context, r *Route) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	defer s.invalidate(ctx, InvalidateRoute, r.Domain)
+	return s.repository.SaveRoute(ctx, r.Domain, string(b))
+}
+
+func (s *Waitingroom) DeleteRoute(ctx context.Context, domain string) error {
+	defer s.invalidate(ctx, InvalidateRoute, domain)
+	return s.repository.DeleteRoute(ctx, domain)
+}
@@ -0,0 +1,68 @@
+package waitingroom
+
+import "testing"
+
+func TestRoute_Match(t *testing.T) {
+	route := &Route{
+		Domain: "example.com",
+		Rules: []RouteRule{
+			{Name: "checkout", Prefix: "/checkout"},
+			{Name: "express", Prefix: "/checkout/express"},
+			{Name: "api", Prefix: "/api/"},
+		},
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/checkout", want: "checkout"},
+		{path: "/checkout/cart", want: "checkout"},
+		{path: "/checkouts", want: ""},
+		{path: "/checkout/express/1", want: "express"},
+		{path: "/api/items", want: "api"},
+		{path: "/api", want: ""},
+		{path: "/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := ""
+			if r := route.Match(tt.path); r != nil {
+				got = r.Name
+			}
+			if got != tt.want {
+				t.Errorf("Route.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateQueueKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "example.com"},
+		{key: "example.com:checkout"},
+		{key: "example.com:", wantErr: true},
+		{key: "example.com:check-out", wantErr: true},
+		{key: ":checkout", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := ValidateQueueKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateQueueKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoute_validate(t *testing.T) {
+	r := &Route{Rules: []RouteRule{{Name: "a", Prefix: "/a"}, {Name: "a", Prefix: "/b"}}}
+	if err := r.validate(); err == nil {
+		t.Error("Route.validate() should reject duplicate names")
+	}
+	r = &Route{Rules: []RouteRule{{Name: "a", Prefix: "/a"}, {Name: "b", Prefix: "/a"}}}
+	if err := r.validate(); err == nil {
+		t.Error("Route.validate() should reject duplicate prefixes")
+	}
+}
@@ -0,0 +1,228 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-redis/redis/v8"
+	"github.com/pyama86/waitingroom/repository"
+)
+
+var ErrSettingVersionConflict = repository.ErrSettingVersionConflict
+
+const InstanceHeartbeatInterval = 10 * time.Second
+
+// ハートビートがこの時間途絶えたインスタンスは停止したものとみなす
+const InstanceExpire = 3 * InstanceHeartbeatInterval
+
+// Redisに保存し、全インスタンスで共有する設定。省略した項目は設定ファイルの値を使う
+// 0を指定すると0で上書きするため、global_permit_budgetなどを無効に戻せる
+type Settings struct {
+	Version             int64  `json:"version" validate:"gte=0"`
+	PermittedAccessSec  *int   `json:"permitted_access_sec,omitempty" validate:"omitempty,gte=0"`
+	EntryDelaySec       *int64 `json:"entry_delay_sec,omitempty" validate:"omitempty,gte=0"`
+	QueueEnableSec      *int   `json:"queue_enable_sec,omitempty" validate:"omitempty,gte=0"`
+	PermitIntervalSec   *int   `json:"permit_interval_sec,omitempty" validate:"omitempty,gte=0"`
+	PermitUnitNumber    *int64 `json:"permit_unit_number,omitempty" validate:"omitempty,gte=0"`
+	CacheTTLSec         *int   `json:"cache_ttl_sec,omitempty" validate:"omitempty,gte=0"`
+	NegativeCacheTTLSec *int   `json:"negative_cache_ttl_sec,omitempty" validate:"omitempty,gte=0"`
+	GlobalPermitBudget  *int64 `json:"global_permit_budget,omitempty" validate:"omitempty,gte=0"`
+}
+
+// 設定を上書きしたコピーを返す
+func (c *Config) WithSettings(s *Settings) *Config {
+	ret := *c
+	if s == nil {
+		return &ret
+	}
+	override(&ret.PermittedAccessSec, s.PermittedAccessSec)
+	override(&ret.EntryDelaySec, s.EntryDelaySec)
+	override(&ret.QueueEnableSec, s.QueueEnableSec)
+	override(&ret.PermitIntervalSec, s.PermitIntervalSec)
+	override(&ret.PermitUnitNumber, s.PermitUnitNumber)
+	override(&ret.CacheTTLSec, s.CacheTTLSec)
+	override(&ret.NegativeCacheTTLSec, s.NegativeCacheTTLSec)
+	override(&ret.GlobalPermitBudget, s.GlobalPermitBudget)
+	return &ret
+}
+
+func override[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// 稼働中のインスタンスと、適用している設定のバージョン
+type Instance struct {
+	ID             string    `json:"id"`
+	Hostname       string    `json:"hostname"`
+	SettingVersion int64     `json:"setting_version"`
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type SettingModel struct {
+	repo       repository.SettingRepositoryer
+	configMu   sync.RWMutex
+	config     *Config
+	fileConfig *Config // 共有設定で上書きする前の設定ファイルの値
+}
+
+func NewSettingModel(r *redis.Client, config *Config) *SettingModel {
+	return &SettingModel{
+		repo:       repository.NewSettingRepository(r),
+		config:     config,
+		fileConfig: config,
+	}
+}
+
+func (s *SettingModel) Config() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+func (s *SettingModel) SetConfig(config *Config) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.config = config
+}
+
+func (s *SettingModel) FileConfig() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.fileConfig
+}
+
+func (s *SettingModel) SetFileConfig(config *Config) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.fileConfig = config
+}
+
+func (s *SettingModel) GetSettings(ctx context.Context) (*Settings, error) {
+	v, version, err := s.repo.GetSetting(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st := &Settings{}
+	if v != "" {
+		if err := json.Unmarshal([]byte(v), st); err != nil {
+			return nil, err
+		}
+	}
+	st.Version = version
+	return st, nil
+}
+
+// st.Versionが現在のバージョンと一致する場合のみ保存し、更新後の設定を返す
+// 省略した項目は設定ファイルの値に戻るため、各インスタンスと同じく設定ファイルの値に重ねて検証する
+func (s *SettingModel) SaveSettings(ctx context.Context, st *Settings) (*Settings, error) {
+	if err := validator.New().Struct(st); err != nil {
+		return nil, err
+	}
+	next := s.FileConfig().WithSettings(st)
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	v := *st
+	v.Version = 0
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.repo.SaveSetting(ctx, string(b), st.Version)
+	if err != nil {
+		return nil, err
+	}
+	v.Version = version
+
+	// 各インスタンスは反映を記録するだけにし、通知は保存したインスタンスから1度だけ送る
+	if diff := s.Config().Diff(next); len(diff) > 0 {
+		if err := NotifySlack(next, fmt.Sprintf("WaitingRoom settings version %d saved", version), strings.Join(diff, "\n")); err != nil {
+			slog.Error("can't notify settings change", slog.String("error", err.Error()))
+		}
+	}
+	return &v, nil
+}
+
+// 設定の変更をpub/subで受け取り、取りこぼしに備えて定期的にも確認する
+func (s *SettingModel) Watch(ctx context.Context, interval time.Duration, version int64, fn func(*Settings)) error {
+	pubsub := s.repo.SubscribeSetting(ctx)
+	defer pubsub.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	check := func() {
+		st, err := s.GetSettings(ctx)
+		if err != nil {
+			slog.Error("can't get settings", slog.String("error", err.Error()))
+			return
+		}
+		if st.Version == version {
+			return
+		}
+		version = st.Version
+		fn(st)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			check()
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+func (s *SettingModel) Heartbeat(ctx context.Context, instance *Instance) error {
+	v := *instance
+	v.UpdatedAt = time.Now()
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.repo.SaveInstance(ctx, v.ID, string(b))
+}
+
+// expireより長くハートビートのないインスタンスは停止したものとして削除する
+func (s *SettingModel) GetInstances(ctx context.Context, expire time.Duration) ([]Instance, error) {
+	v, err := s.repo.GetInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := []Instance{}
+	for id, value := range v {
+		i := Instance{}
+		if err := json.Unmarshal([]byte(value), &i); err != nil || time.Since(i.UpdatedAt) > expire {
+			if err := s.repo.DeleteInstance(ctx, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ret = append(ret, i)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func (s *SettingModel) DeleteInstance(ctx context.Context, id string) error {
+	return s.repo.DeleteInstance(ctx, id)
+}
@@ -0,0 +1,122 @@
+package waitingroom
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestConfig_WithSettings(t *testing.T) {
+	config := &Config{PermitUnitNumber: 1000, PermitIntervalSec: 60, CacheTTLSec: 20}
+	got := config.WithSettings(&Settings{PermitUnitNumber: ptr[int64](10), CacheTTLSec: ptr(30)})
+	if got.PermitUnitNumber != 10 || got.CacheTTLSec != 30 || got.PermitIntervalSec != 60 {
+		t.Errorf("Config.WithSettings() = %+v", got)
+	}
+	if config.PermitUnitNumber != 1000 {
+		t.Errorf("Config.WithSettings() modified original config %+v", config)
+	}
+
+	// 0を指定した項目は設定ファイルの値を0で上書きする
+	config.GlobalPermitBudget = 100
+	got = config.WithSettings(&Settings{GlobalPermitBudget: ptr[int64](0)})
+	if got.GlobalPermitBudget != 0 || got.PermitUnitNumber != 1000 {
+		t.Errorf("Config.WithSettings() = %+v", got)
+	}
+}
+
+func TestSettingModel(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	redisClient.Del(ctx, repository.Keys().Global("settings"), repository.Keys().Global("instances"))
+	defer redisClient.Del(ctx, repository.Keys().Global("settings"), repository.Keys().Global("instances"))
+	config := &Config{
+		PermittedAccessSec:  600,
+		EntryDelaySec:       10,
+		QueueEnableSec:      300,
+		PermitIntervalSec:   60,
+		PermitUnitNumber:    1000,
+		CacheTTLSec:         20,
+		NegativeCacheTTLSec: 10,
+	}
+	m := NewSettingModel(redisClient, config)
+
+	t.Run("save with version", func(t *testing.T) {
+		got, err := m.SaveSettings(ctx, &Settings{Version: 0, PermitUnitNumber: ptr[int64](10)})
+		if err != nil {
+			t.Fatalf("SettingModel.SaveSettings() error = %v", err)
+		}
+		if got.Version != 1 {
+			t.Errorf("SettingModel.SaveSettings() version = %d, want 1", got.Version)
+		}
+
+		_, err = m.SaveSettings(ctx, &Settings{Version: 0, PermitUnitNumber: ptr[int64](20)})
+		if !errors.Is(err, ErrSettingVersionConflict) {
+			t.Errorf("SettingModel.SaveSettings() error = %v, want conflict", err)
+		}
+
+		st, err := m.GetSettings(ctx)
+		if err != nil {
+			t.Fatalf("SettingModel.GetSettings() error = %v", err)
+		}
+		if st.Version != 1 || *st.PermitUnitNumber != 10 {
+			t.Errorf("SettingModel.GetSettings() = %+v", st)
+		}
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		if _, err := m.SaveSettings(ctx, &Settings{Version: 1, CacheTTLSec: ptr(120)}); err == nil {
+			t.Error("SettingModel.SaveSettings() want error when cache ttl exceeds permit interval")
+		}
+	})
+
+	t.Run("validate with file config", func(t *testing.T) {
+		// 適用中の設定ではなく、省略した項目が戻る設定ファイルの値に重ねて検証する
+		m.SetConfig(config.WithSettings(&Settings{PermitIntervalSec: ptr(200), CacheTTLSec: ptr(120)}))
+		defer m.SetConfig(config)
+		if _, err := m.SaveSettings(ctx, &Settings{Version: 1, CacheTTLSec: ptr(120)}); err == nil {
+			t.Error("SettingModel.SaveSettings() want error when cache ttl exceeds permit interval of file config")
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		wctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ch := make(chan *Settings, 1)
+		go m.Watch(wctx, time.Hour, 1, func(s *Settings) { ch <- s })
+		time.Sleep(100 * time.Millisecond)
+
+		if _, err := m.SaveSettings(ctx, &Settings{Version: 1, PermitUnitNumber: ptr[int64](30)}); err != nil {
+			t.Fatalf("SettingModel.SaveSettings() error = %v", err)
+		}
+		select {
+		case s := <-ch:
+			if s.Version != 2 || *s.PermitUnitNumber != 30 {
+				t.Errorf("SettingModel.Watch() = %+v", s)
+			}
+		case <-time.After(3 * time.Second):
+			t.Error("SettingModel.Watch() did not notify change")
+		}
+	})
+
+	t.Run("instances", func(t *testing.T) {
+		if err := m.Heartbeat(ctx, &Instance{ID: "alive", SettingVersion: 2}); err != nil {
+			t.Fatalf("SettingModel.Heartbeat() error = %v", err)
+		}
+		redisClient.HSet(ctx, repository.Keys().Global("instances"), "dead", `{"id":"dead","updated_at":"2000-01-01T00:00:00Z"}`)
+
+		got, err := m.GetInstances(ctx, InstanceExpire)
+		if err != nil {
+			t.Fatalf("SettingModel.GetInstances() error = %v", err)
+		}
+		if len(got) != 1 || got[0].ID != "alive" || got[0].SettingVersion != 2 {
+			t.Errorf("SettingModel.GetInstances() = %+v", got)
+		}
+		if redisClient.HExists(ctx, repository.Keys().Global("instances"), "dead").Val() {
+			t.Error("SettingModel.GetInstances() did not remove expired instance")
+		}
+	})
+}
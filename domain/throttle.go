@@ -0,0 +1,83 @@
+package waitingroom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// クライアントの識別方法
+const (
+	ThrottleByIP          = "ip"          // クライアントのIP。IPv6は/64ごとに数える
+	ThrottleByFingerprint = "fingerprint" // IPとUser-Agentなどのヘッダのハッシュ。同じIPの別の端末を区別する
+)
+
+// 発行数を数える対象
+const (
+	ThrottleKindID     = "id"
+	ThrottleKindSerial = "serial"
+)
+
+var ErrThrottled = errors.New("too many new clients")
+
+var throttleRejections, _ = otel.Meter("github.com/pyama86/waitingroom").Int64Counter(
+	"waitingroom.throttle.rejections",
+	metric.WithDescription("number of new ids and serial numbers rejected by throttling"),
+)
+
+// 発行数を数えるクライアントの識別子。IPとヘッダをそのまま保存しないようハッシュにする
+func (c *Config) throttleSubject(r *http.Request, ip netip.Addr) string {
+	if ip.Is6() {
+		ip = netip.PrefixFrom(ip, 64).Masked().Addr()
+	}
+	h := sha256.New()
+	h.Write([]byte(ip.String()))
+	if c.ThrottleBy == ThrottleByFingerprint {
+		for _, v := range []string{r.UserAgent(), r.Header.Get("Accept-Language"), r.Header.Get("Accept-Encoding")} {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// AssignSerialNumberで新しくIDまたは通し番号を発行するクライアントを、識別子ごとに数える
+// 上限を超えたらErrThrottledと、次に発行できるまでの時間を返す
+func (s *Waitingroom) Throttle(ctx context.Context, domain, subject string, c *Client) (time.Duration, error) {
+	config := s.Config()
+	if config.ThrottleWindowSec <= 0 || c.HasSerialNumber() {
+		return 0, nil
+	}
+
+	kind, max := ThrottleKindID, config.ThrottleMaxIDs
+	if c.HasID() {
+		if !c.canTakeSerialNumber() {
+			return 0, nil
+		}
+		kind, max = ThrottleKindSerial, config.ThrottleMaxSerials
+	}
+	if max <= 0 {
+		return 0, nil
+	}
+
+	n, ttl, err := s.repository.IncrThrottle(ctx, kind, domain, subject, time.Duration(config.ThrottleWindowSec)*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n <= max {
+		return 0, nil
+	}
+	throttleRejections.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("domain", domain),
+		attribute.String("kind", kind),
+	))
+	return ttl, ErrThrottled
+}
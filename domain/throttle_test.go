@@ -0,0 +1,146 @@
+package waitingroom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestConfig_throttleSubject(t *testing.T) {
+	request := func(ua string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", ua)
+		return r
+	}
+	subject := func(by, ip, ua string) string {
+		c := &Config{ThrottleBy: by}
+		return c.throttleSubject(request(ua), netip.MustParseAddr(ip))
+	}
+
+	if subject(ThrottleByIP, "192.0.2.1", "a") != subject(ThrottleByIP, "192.0.2.1", "b") {
+		t.Error("ip subject should not depend on headers")
+	}
+	if subject(ThrottleByIP, "192.0.2.1", "a") == subject(ThrottleByIP, "192.0.2.2", "a") {
+		t.Error("ip subject should differ by ip")
+	}
+	// IPv6は/64を1つのクライアントとみなす
+	if subject(ThrottleByIP, "2001:db8::1", "a") != subject(ThrottleByIP, "2001:db8::ffff:1", "a") {
+		t.Error("ipv6 subject should be same in /64")
+	}
+	if subject(ThrottleByFingerprint, "192.0.2.1", "a") == subject(ThrottleByFingerprint, "192.0.2.1", "b") {
+		t.Error("fingerprint subject should differ by user agent")
+	}
+}
+
+func TestWaitingroom_CheckThrottle(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	newRequest := func(ip, ua string, c *Client) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("User-Agent", ua)
+		if c != nil {
+			v, _ := testutils.SecureCookie.Encode(ClientCookieKey, c)
+			r.AddCookie(&http.Cookie{Name: ClientCookieKey, Value: v})
+		}
+		return r
+	}
+	waiting := func() *Client {
+		return &Client{ID: testutils.TestRandomString(10), TakeSerialNumberTime: time.Now().Add(-time.Minute).Unix()}
+	}
+
+	tests := []struct {
+		name          string
+		throttleBy    string
+		maxIDs        int64
+		maxSerials    int64
+		requests      []*http.Request
+		wantThrottled []bool
+	}{
+		{
+			name:   "new ids by ip",
+			maxIDs: 2,
+			requests: []*http.Request{
+				newRequest("192.0.2.1", "a", nil),
+				newRequest("192.0.2.1", "b", nil),
+				newRequest("192.0.2.1", "c", nil),
+				newRequest("192.0.2.2", "a", nil),
+			},
+			wantThrottled: []bool{false, false, true, false},
+		},
+		{
+			name:       "new ids by fingerprint",
+			throttleBy: ThrottleByFingerprint,
+			maxIDs:     1,
+			requests: []*http.Request{
+				newRequest("192.0.2.1", "a", nil),
+				newRequest("192.0.2.1", "b", nil),
+				newRequest("192.0.2.1", "a", nil),
+			},
+			wantThrottled: []bool{false, false, true},
+		},
+		{
+			name:       "serials by ip",
+			maxIDs:     1,
+			maxSerials: 1,
+			requests: []*http.Request{
+				newRequest("192.0.2.1", "a", waiting()),
+				newRequest("192.0.2.1", "a", waiting()),
+				// 通し番号を発行する時刻になっていないクライアントは数えない
+				newRequest("192.0.2.1", "a", &Client{ID: "delayed", TakeSerialNumberTime: time.Now().Add(time.Minute).Unix()}),
+				newRequest("192.0.2.1", "a", &Client{ID: "numbered", SerialNumber: 1}),
+				newRequest("192.0.2.1", "a", nil),
+			},
+			wantThrottled: []bool{false, true, false, false, false},
+		},
+		{
+			name: "disabled",
+			requests: []*http.Request{
+				newRequest("192.0.2.1", "a", nil),
+				newRequest("192.0.2.1", "a", nil),
+			},
+			wantThrottled: []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wr := NewWaitingroom(&Config{
+				CacheTTLSec:        60,
+				EntryDelaySec:      10,
+				PermittedAccessSec: 10,
+				PermitUnitNumber:   10,
+				PermitIntervalSec:  10,
+				QueueEnableSec:     10,
+				ThrottleWindowSec:  60,
+				ThrottleMaxIDs:     tt.maxIDs,
+				ThrottleMaxSerials: tt.maxSerials,
+				ThrottleBy:         tt.throttleBy,
+			}, repository.NewWaitingroomRepository(redisClient))
+			domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+
+			for i, r := range tt.requests {
+				status, result, err := wr.Check(httptest.NewRecorder(), r, testutils.SecureCookie, domain, "/", true)
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				if result.Throttled != tt.wantThrottled[i] {
+					t.Errorf("request %d: Check() throttled = %v, want %v", i, result.Throttled, tt.wantThrottled[i])
+				}
+				if !result.Throttled {
+					continue
+				}
+				if status != http.StatusTooManyRequests || result.SerialNo != 0 {
+					t.Errorf("request %d: Check() = %v %+v", i, status, *result)
+				}
+				if result.RemainingWaitSecond <= 0 || result.RemainingWaitSecond > 60 {
+					t.Errorf("request %d: Check() remaining wait second = %v", i, result.RemainingWaitSecond)
+				}
+			}
+		})
+	}
+}
@@ -25,3 +25,7 @@ func testContext(path, method string, params map[string]string) (echo.Context, *
 	ctx := e.NewContext(req, rec)
 	return ctx, rec
 }
+
+func ptr[T any](v T) *T {
+	return &v
+}
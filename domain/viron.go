@@ -2,6 +2,10 @@ package waitingroom
 
 import (
 	"context"
+	"encoding/json"
+	"html/template"
+	"sort"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/pyama86/waitingroom/repository"
@@ -12,9 +16,21 @@ type QueueModel struct {
 	config *Config
 }
 type Queue struct {
-	Domain          string `json:"domain" validate:"required,fqdn"`
+	Domain          string `json:"domain" validate:"required"` // ドメイン、またはドメイン:ルート名
 	CurrentNumber   int64  `json:"current_number" validate:"gte=0"`
 	PermitetdNumber int64  `json:"permitted_number" validate:"gte=0"`
+	MaxSerialNumber *int64 `json:"max_serial_number,omitempty" validate:"omitempty,gte=0"` // 通し番号の発行上限、0なら上限なし。省略すると変更しない
+	Closed          *bool  `json:"closed,omitempty"`                                       // 受付終了。省略すると変更しない
+	IssuedNumber    int64  `json:"issued_number"`                                          // 上限を設定してから発行した通し番号の数
+	SoldOut         bool   `json:"sold_out"`                                               // 新しく通し番号を発行できない
+}
+
+func (q *Queue) setLimit(l *QueueLimit) {
+	max, closed := l.MaxSerialNumber, l.Closed
+	q.MaxSerialNumber = &max
+	q.Closed = &closed
+	q.IssuedNumber = l.IssuedNumber
+	q.SoldOut = l.SoldOut()
 }
 
 func NewQueueModel(r *redis.Client, config *Config) *QueueModel {
@@ -26,11 +42,19 @@ func NewQueueModel(r *redis.Client, config *Config) *QueueModel {
 		wr:     wr,
 	}
 }
+func (q *QueueModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *QueueModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
+
 func (q *QueueModel) GetQueues(ctx context.Context, perPage, page int64) ([]Queue, int64, error) {
 	domains, err := q.wr.GetEnableDomains(ctx,
 		&DomainsParam{
-			PerPage: perPage * (page - 1),
-			Page:    page * perPage,
+			PerPage: page*perPage - 1,
+			Page:    perPage * (page - 1),
 		},
 	)
 
@@ -40,7 +64,7 @@ func (q *QueueModel) GetQueues(ctx context.Context, perPage, page int64) ([]Queu
 	ret := []Queue{}
 	for _, domain := range domains {
 		cn, err := q.wr.GetCurrentNumber(ctx, domain)
-		if err != nil {
+		if err != nil && err != redis.Nil {
 			return nil, 0, err
 		}
 		pn, err := q.wr.GetCurrentPermitNumber(ctx, domain)
@@ -48,11 +72,18 @@ func (q *QueueModel) GetQueues(ctx context.Context, perPage, page int64) ([]Queu
 			return nil, 0, err
 		}
 
-		ret = append(ret, Queue{
+		l, err := q.wr.fetchQueueLimit(ctx, domain)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		queue := Queue{
 			CurrentNumber:   cn,
 			PermitetdNumber: pn,
 			Domain:          domain,
-		})
+		}
+		queue.setLimit(l)
+		ret = append(ret, queue)
 	}
 	total, err := q.wr.GetEnableDomainsCount(ctx)
 	if err != nil {
@@ -61,7 +92,38 @@ func (q *QueueModel) GetQueues(ctx context.Context, perPage, page int64) ([]Queu
 	return ret, total, nil
 }
 
+func (q *QueueModel) GetQueue(ctx context.Context, domain string) (*Queue, error) {
+	cn, err := q.wr.GetCurrentNumber(ctx, domain)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	pn, err := q.wr.GetCurrentPermitNumber(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := q.wr.fetchQueueLimit(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &Queue{
+		CurrentNumber:   cn,
+		PermitetdNumber: pn,
+		Domain:          domain,
+	}
+	queue.setLimit(l)
+	return queue, nil
+}
+
+func (q *QueueModel) EnableQueue(ctx context.Context, domain string) error {
+	return q.wr.EnableQueue(ctx, domain)
+}
+
 func (q *QueueModel) UpdateQueues(ctx context.Context, m *Queue) error {
+	if err := ValidateQueueKey(m.Domain); err != nil {
+		return err
+	}
 	if err := q.wr.ExtendDomainsTTL(ctx); err != nil {
 		return err
 	}
@@ -74,7 +136,27 @@ func (q *QueueModel) UpdateQueues(ctx context.Context, m *Queue) error {
 		return err
 	}
 
-	return nil
+	// 上限と受付終了を省略した更新では、設定済みの上限を消さない
+	if m.MaxSerialNumber == nil && m.Closed == nil {
+		return nil
+	}
+	l, err := q.wr.fetchQueueLimit(ctx, m.Domain)
+	if err != nil {
+		return err
+	}
+	max, closed := l.MaxSerialNumber, l.Closed
+	if m.MaxSerialNumber != nil {
+		max = *m.MaxSerialNumber
+	}
+	if m.Closed != nil {
+		closed = *m.Closed
+	}
+	return q.SaveQueueLimit(ctx, m.Domain, max, closed)
+}
+
+// 待合室が無効でも設定でき、販売開始前に上限を決めておける
+func (q *QueueModel) SaveQueueLimit(ctx context.Context, domain string, max int64, closed bool) error {
+	return q.wr.SaveQueueLimit(ctx, domain, max, closed)
 }
 
 func (q *QueueModel) CreateQueues(ctx context.Context, m *Queue) error {
@@ -91,30 +173,66 @@ type WhiteListModel struct {
 	wr *Waitingroom
 }
 
+// DomainはWhiteListRuleのパターン(example.com、*.example.com、~正規表現)
 type WhiteList struct {
-	Domain string `json:"domain" validate:"required,fqdn"`
+	ID        string     `json:"id"` // パスを含むルール。削除に使う
+	Domain    string     `json:"domain" validate:"required"`
+	Path      string     `json:"path" validate:"omitempty,startswith=/"`
+	Type      string     `json:"type"`
+	ExpireAt  *time.Time `json:"expire_at,omitempty"`                // 未指定なら削除するまで有効
+	TTLSec    int64      `json:"ttl_sec,omitempty" validate:"gte=0"` // 登録時にexpire_atの代わりに指定できる
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
 
-func NewWhiteListModel(r *redis.Client) *WhiteListModel {
+func NewWhiteListModel(r *redis.Client, config *Config) *WhiteListModel {
 	repo := repository.NewWaitingroomRepository(r)
-	wr := NewWaitingroom(&Config{}, repo)
+	wr := NewWaitingroom(config, repo)
 	return &WhiteListModel{
 		wr: wr,
 	}
 }
+
+func (q *WhiteListModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *WhiteListModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
 func (q *WhiteListModel) GetWhiteList(ctx context.Context, perPage, page int64) ([]WhiteList, int64, error) {
 	members, err := q.wr.GetWhiteListDomains(ctx,
 		&DomainsParam{
-			PerPage: perPage * (page - 1),
-			Page:    page * perPage,
+			PerPage: page*perPage - 1,
+			Page:    perPage * (page - 1),
 		},
 	)
 	if err != nil {
 		return nil, 0, err
 	}
+	metas, err := q.wr.GetWhiteListMetas(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 	ret := []WhiteList{}
 	for _, m := range members {
-		ret = append(ret, WhiteList{Domain: m})
+		meta := metas[m]
+		w := WhiteList{
+			ID:        m,
+			Domain:    m,
+			ExpireAt:  meta.ExpireAt,
+			Reason:    meta.Reason,
+			CreatedBy: meta.CreatedBy,
+			CreatedAt: meta.CreatedAt,
+		}
+		// 解釈できないルールも削除できるよう、そのまま返す
+		if r, err := ParseWhiteListRule(m); err == nil {
+			w.Domain = r.Pattern
+			w.Path = r.Path
+			w.Type = r.Type
+		}
+		ret = append(ret, w)
 	}
 
 	total, err := q.wr.GetWhiteListDomainsCount(ctx)
@@ -124,10 +242,273 @@ func (q *WhiteListModel) GetWhiteList(ctx context.Context, perPage, page int64)
 	return ret, total, nil
 }
 
-func (q *WhiteListModel) CreateWhiteList(ctx context.Context, domain string) error {
-	return q.wr.AddWhiteListDomain(ctx, domain)
+func (q *WhiteListModel) CreateWhiteList(ctx context.Context, w *WhiteList) error {
+	expireAt := w.ExpireAt
+	if expireAt == nil && w.TTLSec > 0 {
+		t := time.Now().Add(time.Duration(w.TTLSec) * time.Second)
+		expireAt = &t
+	}
+	return q.wr.AddWhiteListDomain(ctx, w.Domain+w.Path, &WhiteListMeta{
+		ExpireAt:  expireAt,
+		Reason:    w.Reason,
+		CreatedBy: w.CreatedBy,
+	})
+}
+
+func (q *WhiteListModel) DeleteWhiteList(ctx context.Context, id string) error {
+	return q.wr.RemoveWhiteListDomain(ctx, id)
+}
+
+type PageModel struct {
+	repository repository.PageRepositoryer
+	wr         *Waitingroom
+}
+
+// rendererには、このインスタンスで待機ページを描画するものを渡し、変更をすぐに反映する
+func NewPageModel(r *redis.Client, config *Config, renderer *PageRenderer) *PageModel {
+	wr := NewWaitingroom(config, repository.NewWaitingroomRepository(r))
+	wr.SetPageRenderer(renderer)
+	return &PageModel{
+		repository: repository.NewPageRepository(r),
+		wr:         wr,
+	}
+}
+
+func (q *PageModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *PageModel) GetPages(ctx context.Context, perPage, page int64) ([]Page, int64, error) {
+	pages, err := q.repository.GetPages(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	domains := make([]string, 0, len(pages))
+	for d := range pages {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	start := perPage * (page - 1)
+	end := start + perPage
+	if start > int64(len(domains)) {
+		start = int64(len(domains))
+	}
+	if end > int64(len(domains)) {
+		end = int64(len(domains))
+	}
+
+	ret := []Page{}
+	for _, d := range domains[start:end] {
+		p := Page{}
+		if err := json.Unmarshal([]byte(pages[d]), &p); err != nil {
+			return nil, 0, err
+		}
+		p.Domain = d
+		ret = append(ret, p)
+	}
+	return ret, int64(len(domains)), nil
+}
+
+func (q *PageModel) SavePage(ctx context.Context, p *Page) error {
+	if p.Template != "" {
+		if _, err := template.New(pageTemplateName).Parse(p.Template); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := q.repository.SavePage(ctx, p.Domain, string(b)); err != nil {
+		return err
+	}
+	q.wr.invalidate(ctx, InvalidatePage, p.Domain)
+	return nil
+}
+
+func (q *PageModel) DeletePage(ctx context.Context, domain string) error {
+	if err := q.repository.DeletePage(ctx, domain); err != nil {
+		return err
+	}
+	q.wr.invalidate(ctx, InvalidatePage, domain)
+	return nil
+}
+
+type MaintenanceModel struct {
+	wr *Waitingroom
+}
+
+func NewMaintenanceModel(r *redis.Client, config *Config) *MaintenanceModel {
+	repo := repository.NewWaitingroomRepository(r)
+	return &MaintenanceModel{
+		wr: NewWaitingroom(config, repo),
+	}
+}
+
+func (q *MaintenanceModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *MaintenanceModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
+
+func (q *MaintenanceModel) GetMaintenances(ctx context.Context, perPage, page int64) ([]Maintenance, int64, error) {
+	ms, err := q.wr.GetMaintenances(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := perPage * (page - 1)
+	end := start + perPage
+	if start > int64(len(ms)) {
+		start = int64(len(ms))
+	}
+	if end > int64(len(ms)) {
+		end = int64(len(ms))
+	}
+	return ms[start:end], int64(len(ms)), nil
+}
+
+func (q *MaintenanceModel) SaveMaintenance(ctx context.Context, m *Maintenance) error {
+	return q.wr.SaveMaintenance(ctx, m)
+}
+
+func (q *MaintenanceModel) DeleteMaintenance(ctx context.Context, domain string) error {
+	return q.wr.DeleteMaintenance(ctx, domain)
+}
+
+type RouteModel struct {
+	wr *Waitingroom
+}
+
+func NewRouteModel(r *redis.Client, config *Config) *RouteModel {
+	repo := repository.NewWaitingroomRepository(r)
+	return &RouteModel{
+		wr: NewWaitingroom(config, repo),
+	}
+}
+
+func (q *RouteModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *RouteModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
+
+func (q *RouteModel) GetRoutes(ctx context.Context, perPage, page int64) ([]Route, int64, error) {
+	rs, err := q.wr.GetRoutes(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := perPage * (page - 1)
+	end := start + perPage
+	if start > int64(len(rs)) {
+		start = int64(len(rs))
+	}
+	if end > int64(len(rs)) {
+		end = int64(len(rs))
+	}
+	return rs[start:end], int64(len(rs)), nil
+}
+
+func (q *RouteModel) SaveRoute(ctx context.Context, r *Route) error {
+	return q.wr.SaveRoute(ctx, r)
+}
+
+func (q *RouteModel) DeleteRoute(ctx context.Context, domain string) error {
+	return q.wr.DeleteRoute(ctx, domain)
+}
+
+type GroupModel struct {
+	wr *Waitingroom
+}
+
+func NewGroupModel(r *redis.Client, config *Config) *GroupModel {
+	repo := repository.NewWaitingroomRepository(r)
+	return &GroupModel{
+		wr: NewWaitingroom(config, repo),
+	}
+}
+
+func (q *GroupModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *GroupModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
+
+func (q *GroupModel) GetGroups(ctx context.Context, perPage, page int64) ([]Group, int64, error) {
+	gs, err := q.wr.GetGroups(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := perPage * (page - 1)
+	end := start + perPage
+	if start > int64(len(gs)) {
+		start = int64(len(gs))
+	}
+	if end > int64(len(gs)) {
+		end = int64(len(gs))
+	}
+	return gs[start:end], int64(len(gs)), nil
+}
+
+func (q *GroupModel) SaveGroup(ctx context.Context, g *Group) error {
+	return q.wr.SaveGroup(ctx, g)
+}
+
+func (q *GroupModel) DeleteGroup(ctx context.Context, name string) error {
+	return q.wr.DeleteGroup(ctx, name)
+}
+
+type IPRuleModel struct {
+	wr *Waitingroom
+}
+
+func NewIPRuleModel(r *redis.Client, config *Config) *IPRuleModel {
+	repo := repository.NewWaitingroomRepository(r)
+	return &IPRuleModel{
+		wr: NewWaitingroom(config, repo),
+	}
+}
+
+func (q *IPRuleModel) SetConfig(config *Config) {
+	q.wr.SetConfig(config)
+}
+
+func (q *IPRuleModel) WatchInvalidations(ctx context.Context) error {
+	return q.wr.WatchInvalidations(ctx)
+}
+
+func (q *IPRuleModel) GetIPRules(ctx context.Context, perPage, page int64) ([]IPRule, int64, error) {
+	rs, err := q.wr.GetIPRules(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := perPage * (page - 1)
+	end := start + perPage
+	if start > int64(len(rs)) {
+		start = int64(len(rs))
+	}
+	if end > int64(len(rs)) {
+		end = int64(len(rs))
+	}
+	return rs[start:end], int64(len(rs)), nil
+}
+
+func (q *IPRuleModel) SaveIPRule(ctx context.Context, r *IPRule) error {
+	return q.wr.SaveIPRule(ctx, r)
 }
 
-func (q *WhiteListModel) DeleteWhiteList(ctx context.Context, domain string) error {
-	return q.wr.RemoveWhiteListDomain(ctx, domain)
+func (q *IPRuleModel) DeleteIPRule(ctx context.Context, id string) error {
+	return q.wr.DeleteIPRule(ctx, id)
 }
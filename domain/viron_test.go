@@ -0,0 +1,114 @@
+package waitingroom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestQueueModel_UpdateQueues(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{
+		CacheTTLSec:         60,
+		NegativeCacheTTLSec: 10,
+		QueueEnableSec:      60,
+	}
+	m := NewQueueModel(testutils.TestRedisClient(), config)
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	defer m.DeleteQueues(ctx, domain)
+	defer m.SaveQueueLimit(ctx, domain, 0, false)
+
+	max, closed := int64(100), true
+	if err := m.CreateQueues(ctx, &Queue{Domain: domain, MaxSerialNumber: &max, Closed: &closed}); err != nil {
+		t.Fatalf("CreateQueues() error = %v", err)
+	}
+
+	// 上限と受付終了を省略した更新では、設定済みの上限を消さない
+	if err := m.UpdateQueues(ctx, &Queue{Domain: domain, CurrentNumber: 10, PermitetdNumber: 5}); err != nil {
+		t.Fatalf("UpdateQueues() error = %v", err)
+	}
+	q, err := m.GetQueue(ctx, domain)
+	if err != nil {
+		t.Fatalf("GetQueue() error = %v", err)
+	}
+	if *q.MaxSerialNumber != 100 || !*q.Closed || q.CurrentNumber != 10 || q.PermitetdNumber != 5 {
+		t.Errorf("GetQueue() = %+v, want limit kept", *q)
+	}
+
+	// 指定したフィールドだけを変更する
+	open := false
+	if err := m.UpdateQueues(ctx, &Queue{Domain: domain, CurrentNumber: 10, PermitetdNumber: 5, Closed: &open}); err != nil {
+		t.Fatalf("UpdateQueues() error = %v", err)
+	}
+	q, err = m.GetQueue(ctx, domain)
+	if err != nil {
+		t.Fatalf("GetQueue() error = %v", err)
+	}
+	if *q.MaxSerialNumber != 100 || *q.Closed {
+		t.Errorf("GetQueue() = max %d closed %v, want max 100 and open", *q.MaxSerialNumber, *q.Closed)
+	}
+}
+
+func TestPageModel_SavePage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	redisClient := testutils.TestRedisClient()
+	config := &Config{CacheTTLSec: 60, NegativeCacheTTLSec: 10}
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	local := NewPageRenderer(config, repository.NewPageRepository(redisClient))
+	remote := NewPageRenderer(config, repository.NewPageRepository(redisClient))
+	m := NewPageModel(redisClient, config, local)
+	defer m.DeletePage(context.Background(), domain)
+
+	render := func(p *PageRenderer) string {
+		var buf bytes.Buffer
+		if err := p.Render(ctx, &buf, "ja", NewPageData(domain, &QueueResult{}, config)); err != nil {
+			t.Fatalf("PageRenderer.Render() error = %v", err)
+		}
+		return buf.String()
+	}
+	// 組み込みのテンプレートをキャッシュさせる
+	render(local)
+	render(remote)
+
+	wr := NewWaitingroom(config, repository.NewWaitingroomRepository(redisClient))
+	wr.SetPageRenderer(remote)
+	go wr.WatchInvalidations(ctx)
+
+	if err := m.SavePage(ctx, &Page{Domain: domain, Template: "v1"}); err != nil {
+		t.Fatalf("PageModel.SavePage() error = %v", err)
+	}
+	// このインスタンスの待機ページはすぐに変わる
+	if got := render(local); got != "v1" {
+		t.Errorf("PageRenderer.Render() = %q, want v1", got)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for i := 2; ; i++ {
+		// 購読を始める前の通知は届かないため、届くまで変更し直す
+		v := fmt.Sprintf("v%d", i)
+		if err := m.SavePage(ctx, &Page{Domain: domain, Template: v}); err != nil {
+			t.Fatalf("PageModel.SavePage() error = %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if render(remote) == v {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("page cache was not invalidated by other instance")
+		}
+	}
+
+	if err := m.DeletePage(ctx, domain); err != nil {
+		t.Fatalf("PageModel.DeletePage() error = %v", err)
+	}
+	if got := render(local); !strings.Contains(got, "<!DOCTYPE html>") {
+		t.Errorf("PageRenderer.Render() = %q, want builtin template", got)
+	}
+}
@@ -2,36 +2,60 @@ package waitingroom
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/pkg/errors"
 	"github.com/pyama86/waitingroom/repository"
-
-	"github.com/nlopes/slack"
+	"golang.org/x/sync/singleflight"
 )
 
 type Waitingroom struct {
 	enableCache              *ttlcache.Cache[string, bool]
-	permittedClientCache     *ttlcache.Cache[string, bool]
+	permittedClientCache     *ttlcache.Cache[string, *permitRecord] // nilなら許可されていない
 	currentPermitNumberCache *ttlcache.Cache[string, int64]
-	whiteListCache           *ttlcache.Cache[string, bool]
+	whiteListCache           *ttlcache.Cache[string, *whiteListRules]
+	maintenanceCache         *ttlcache.Cache[string, *Maintenance]
+	limitCache               *ttlcache.Cache[string, *QueueLimit]
+	routeCache               *ttlcache.Cache[string, *Route]
+	groupCache               *ttlcache.Cache[string, *Group]
+	ipRuleCache              *ttlcache.Cache[string, *ipRules]
+	backlogCache             *ttlcache.Cache[string, int64] // 待合室ごとの待ち人数。作業証明の難易度に使う
+	permitUnitCache          *ttlcache.Cache[string, int64] // 待合室ごとの直近の判定で配分した許可数。待ち時間の見積もりに使う
 	config                   *Config
+	configMu                 sync.RWMutex
 	repository               repository.WaitingroomRepositoryer
+
+	id          string // キャッシュの破棄の通知で、自身の変更を見分ける
+	flight      singleflight.Group
+	noCoalesce  bool // 負荷試験で比較するため、同時の問い合わせをまとめない
+	breaker     *circuitBreaker
+	lastKnownMu sync.RWMutex
+	lastKnown   map[string]int64 // 待合室ごとに最後に取得できた許可番号。Redisに接続できない間の判定に使う
+
+	captchaMu        sync.RWMutex
+	captchaVerifiers map[string]CaptchaVerifier // ドメインごとに差し替えたCAPTCHAの検証
+	siteVerifiers    map[string]*SiteVerifier   // 設定のドメインごとのsiteverify APIの検証。設定を差し替えるたびに作り直す
+
+	pageRenderer *PageRenderer // 待機ページの変更の通知を受けて、キャッシュを破棄する
 }
 
 var ErrClientNotIncrese = errors.New("client not increase")
+var ErrPermitMismatch = errors.New("permit is bound to another queue or client")
 
 func NewWaitingroom(config *Config, r repository.WaitingroomRepositoryer) *Waitingroom {
 	enableCache := ttlcache.New[string, bool](
 		ttlcache.WithTTL[string, bool](time.Duration(config.CacheTTLSec)*time.Second),
 		ttlcache.WithDisableTouchOnHit[string, bool](),
 	)
-	permittedClientCache := ttlcache.New[string, bool](
-		ttlcache.WithTTL[string, bool](time.Duration(config.CacheTTLSec)*time.Second),
-		ttlcache.WithDisableTouchOnHit[string, bool](),
+	permittedClientCache := ttlcache.New[string, *permitRecord](
+		ttlcache.WithTTL[string, *permitRecord](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *permitRecord](),
 	)
 
 	currentPermitNumberCache := ttlcache.New[string, int64](
@@ -39,9 +63,44 @@ func NewWaitingroom(config *Config, r repository.WaitingroomRepositoryer) *Waiti
 		ttlcache.WithDisableTouchOnHit[string, int64](),
 	)
 
-	whiteListCache := ttlcache.New[string, bool](
-		ttlcache.WithTTL[string, bool](time.Duration(config.CacheTTLSec)*time.Second),
-		ttlcache.WithDisableTouchOnHit[string, bool](),
+	whiteListCache := ttlcache.New[string, *whiteListRules](
+		ttlcache.WithTTL[string, *whiteListRules](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *whiteListRules](),
+	)
+
+	maintenanceCache := ttlcache.New[string, *Maintenance](
+		ttlcache.WithTTL[string, *Maintenance](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *Maintenance](),
+	)
+
+	limitCache := ttlcache.New[string, *QueueLimit](
+		ttlcache.WithTTL[string, *QueueLimit](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *QueueLimit](),
+	)
+
+	routeCache := ttlcache.New[string, *Route](
+		ttlcache.WithTTL[string, *Route](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *Route](),
+	)
+
+	groupCache := ttlcache.New[string, *Group](
+		ttlcache.WithTTL[string, *Group](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *Group](),
+	)
+
+	ipRuleCache := ttlcache.New[string, *ipRules](
+		ttlcache.WithTTL[string, *ipRules](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, *ipRules](),
+	)
+
+	backlogCache := ttlcache.New[string, int64](
+		ttlcache.WithTTL[string, int64](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, int64](),
+	)
+
+	permitUnitCache := ttlcache.New[string, int64](
+		ttlcache.WithTTL[string, int64](time.Duration(config.CacheTTLSec)*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, int64](),
 	)
 
 	return &Waitingroom{
@@ -50,10 +109,41 @@ func NewWaitingroom(config *Config, r repository.WaitingroomRepositoryer) *Waiti
 		permittedClientCache:     permittedClientCache,
 		currentPermitNumberCache: currentPermitNumberCache,
 		whiteListCache:           whiteListCache,
+		maintenanceCache:         maintenanceCache,
+		limitCache:               limitCache,
+		routeCache:               routeCache,
+		groupCache:               groupCache,
+		ipRuleCache:              ipRuleCache,
+		backlogCache:             backlogCache,
+		permitUnitCache:          permitUnitCache,
 		repository:               r,
+		id:                       uuid.NewString(),
+		breaker:                  &circuitBreaker{},
+		lastKnown:                map[string]int64{},
+		captchaVerifiers:         map[string]CaptchaVerifier{},
+		siteVerifiers:            newSiteVerifiers(config),
 	}
 }
 
+func (s *Waitingroom) Config() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// 設定を差し替え、古い設定で作られたキャッシュを破棄する
+func (s *Waitingroom) SetConfig(config *Config) {
+	s.configMu.Lock()
+	s.config = config
+	s.configMu.Unlock()
+
+	s.captchaMu.Lock()
+	s.siteVerifiers = newSiteVerifiers(config)
+	s.captchaMu.Unlock()
+
+	s.flushAll()
+}
+
 type DomainsParam struct {
 	PerPage int64
 	Page    int64
@@ -84,6 +174,11 @@ func (s *Waitingroom) GetEnableDomainsCount(ctx context.Context) (int64, error)
 }
 
 func (s *Waitingroom) AppendPermitNumber(ctx context.Context, domain string) error {
+	return s.AppendPermitNumberBy(ctx, domain, s.Config().PermitUnitNumber)
+}
+
+// 許可番号をunitだけ進める。0でも待合室の延長とリセットの判定は行う
+func (s *Waitingroom) AppendPermitNumberBy(ctx context.Context, domain string, unit int64) error {
 	an, err := s.repository.GetCurrentPermitNumber(ctx, domain)
 	if err != nil {
 		return errors.Wrap(err, "failed to get current permitted number")
@@ -125,14 +220,15 @@ func (s *Waitingroom) AppendPermitNumber(ctx context.Context, domain string) err
 		return ErrClientNotIncrese
 	}
 
-	an = an + s.config.PermitUnitNumber
+	config := s.Config()
+	an = an + unit
 
 	// 現在のクライアント数が許可数より多いのであれば、起動時間を延長する
 	if cn > an {
-		ttl = time.Duration(s.config.QueueEnableSec) * time.Second
+		ttl = time.Duration(config.QueueEnableSec) * time.Second
 	}
 
-	if err := s.repository.AppendPermitNumber(ctx, domain, s.config.PermitUnitNumber, ttl); err != nil {
+	if err := s.repository.AppendPermitNumber(ctx, domain, unit, ttl); err != nil {
 		return err
 	}
 
@@ -144,6 +240,13 @@ func (s *Waitingroom) AppendPermitNumber(ctx context.Context, domain string) err
 		return err
 	}
 
+	if config.GlobalPermitBudget > 0 {
+		if err := s.repository.SavePermitUnit(ctx, domain, unit, ttl); err != nil {
+			return err
+		}
+	}
+	s.invalidate(ctx, InvalidateQueue, domain)
+
 	slog.Info(
 		"append permit number",
 		slog.String("domain", domain),
@@ -152,6 +255,9 @@ func (s *Waitingroom) AppendPermitNumber(ctx context.Context, domain string) err
 		slog.String("ttl", ttl.String()),
 	)
 
+	if unit == 0 {
+		return nil
+	}
 	err = s.NotifySlackWithPermittedStatus(domain, "WaitingRoom Additional access granted", ttl, an, cn)
 	if err != nil {
 		slog.Error(
@@ -177,56 +283,27 @@ func (s *Waitingroom) NotifySlackWithPermittedStatus(domain string, message stri
 		return nil
 	}
 
-	if s.config.SlackApiToken != "" && s.config.SlackChannel != "" {
-		c := slack.New(s.config.SlackApiToken)
-		_, _, err := c.PostMessage(s.config.SlackChannel, slack.MsgOptionBlocks(
-			slack.NewSectionBlock(
-				&slack.TextBlockObject{Type: "mrkdwn", Text: fmt.Sprintf("*%s*", message)},
-				[]*slack.TextBlockObject{
-					{Type: "plain_text", Text: fmt.Sprintf("Domain: %s", domain)},
-					{Type: "plain_text", Text: fmt.Sprintf("CurrentClient: %d", currentNumber)},
-					{Type: "plain_text", Text: fmt.Sprintf("PermittedNumber: %d", permittedNumber)},
-					{Type: "plain_text", Text: fmt.Sprintf("TTL: %d", ttl/time.Second)},
-					{Type: "plain_text", Text: fmt.Sprintf("Time: %s", time.Now().Format("2006-01-02 15:04:05"))},
-				},
-				nil,
-			),
-		))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return NotifySlack(s.Config(), message,
+		fmt.Sprintf("Domain: %s", domain),
+		fmt.Sprintf("CurrentClient: %d", currentNumber),
+		fmt.Sprintf("PermittedNumber: %d", permittedNumber),
+		fmt.Sprintf("TTL: %d", ttl/time.Second),
+	)
 }
 
 func (s *Waitingroom) flushCache(domain string) {
 	s.enableCache.Delete(domain)
 	s.currentPermitNumberCache.Delete(domain)
-
+	s.backlogCache.Delete(domain)
+	s.permitUnitCache.Delete(domain)
 }
 
 func (s *Waitingroom) Reset(ctx context.Context, domain string) error {
-	defer s.flushCache(domain)
-	return s.repository.DisableDomain(ctx, domain)
-}
-
-func (s *Waitingroom) IsInWhitelist(ctx context.Context, domain string) (bool, error) {
-	v := s.whiteListCache.Get(domain)
-	if v != nil {
-		return v.Value(), nil
-	}
-
-	r, err := s.repository.IsWhiteListDomain(ctx, domain)
-	if err != nil {
-		return false, err
-	}
-	if r {
-		s.whiteListCache.Set(domain, r, time.Duration(s.config.CacheTTLSec)*time.Second)
-	} else {
-		s.whiteListCache.Set(domain, r, time.Duration(s.config.NegativeCacheTTLSec)*time.Second)
+	if err := s.repository.DisableDomain(ctx, domain); err != nil {
+		return err
 	}
-
-	return r, nil
+	s.invalidate(ctx, InvalidateQueue, domain)
+	return nil
 }
 
 func (s *Waitingroom) IsEnabledQueue(ctx context.Context, domain string) (bool, error) {
@@ -240,36 +317,66 @@ func (s *Waitingroom) IsEnabledQueue(ctx context.Context, domain string) (bool,
 // 制限中ドメインリストに、ロックを取りながらドメインを追加する
 func (s *Waitingroom) EnableQueue(ctx context.Context, domain string) error {
 	if s.enableCache.Get(domain) == nil {
-		if err := s.repository.EnableDomain(ctx, domain, time.Duration(s.config.QueueEnableSec)*time.Second); err != nil {
+		if err := s.repository.EnableDomain(ctx, domain, time.Duration(s.Config().QueueEnableSec)*time.Second); err != nil {
 			return err
 		}
-		s.flushCache(domain)
+		s.invalidate(ctx, InvalidateQueue, domain)
 		// 大量に更新するとパフォーマンスが落ちるので、TTLの半分の時間は何もしない
-		s.enableCache.Set(domain, true, time.Duration(s.config.QueueEnableSec/2)*time.Second)
+		s.enableCache.Set(domain, true, time.Duration(s.Config().QueueEnableSec/2)*time.Second)
 		slog.Info("EnableQueue", slog.String("enable queue", domain))
 	}
 	return nil
 }
 
+// 許可済みのクライアントかを返す
+// クッキーや許可の記録が照合方法に一致しなければ、ErrPermitMismatchを返す
 func (s *Waitingroom) IsPermittedClient(ctx context.Context, client *Client) (bool, error) {
-	if client.HasID() {
-		v := s.permittedClientCache.Get(client.ID)
-		if v == nil {
-			permitted, err := s.repository.Exists(ctx, client.ID)
+	if !client.HasID() {
+		return false, nil
+	}
+	// 別の待合室で発行されたクッキーは、Redisに問い合わせるまでもなく使えない
+	if reason := client.permitMismatch(nil); reason != "" {
+		return false, s.rejectPermit(ctx, client, reason)
+	}
+
+	v := s.permittedClientCache.Get(client.permitKey())
+	var rec *permitRecord
+	if v == nil {
+		var err error
+		rec, err = coalesce(ctx, s, "permitted:"+client.permitKey(), func(ctx context.Context) (*permitRecord, error) {
+			// 照合しなければ記録の中身は使わないため、有無だけを確かめる
+			if !client.bound() {
+				permitted, err := s.repository.IsPermitted(ctx, client.permitKey())
+				if err != nil || !permitted {
+					return nil, err
+				}
+				return &permitRecord{}, nil
+			}
+			v, err := s.repository.GetPermit(ctx, client.permitKey())
 			if err != nil {
-				return false, err
+				return nil, err
 			}
-			ttl := time.Duration(s.config.CacheTTLSec) * time.Second
+			return parsePermitRecord(v), nil
+		})
+		if err != nil {
+			return false, err
+		}
+		ttl := time.Duration(s.Config().CacheTTLSec) * time.Second
 
-			if !permitted {
-				ttl = time.Duration(s.config.NegativeCacheTTLSec) * time.Second
-			}
-			s.permittedClientCache.Set(client.ID, permitted, ttl)
-			return permitted, nil
+		if rec == nil {
+			ttl = time.Duration(s.Config().NegativeCacheTTLSec) * time.Second
 		}
-		return v.Value(), nil
+		s.permittedClientCache.Set(client.permitKey(), rec, ttl)
+	} else {
+		rec = v.Value()
 	}
-	return false, nil
+	if rec == nil {
+		return false, nil
+	}
+	if reason := client.permitMismatch(rec); reason != "" {
+		return false, s.rejectPermit(ctx, client, reason)
+	}
+	return true, nil
 }
 
 func (s *Waitingroom) currentPermitedNumber(ctx context.Context, domain string) (int64, error) {
@@ -278,19 +385,36 @@ func (s *Waitingroom) currentPermitedNumber(ctx context.Context, domain string)
 		return v.Value(), nil
 	}
 
-	cn, err := s.repository.GetCurrentPermitNumber(ctx, domain)
+	cn, err := coalesce(ctx, s, "permit:"+domain, func(ctx context.Context) (int64, error) {
+		return s.repository.GetCurrentPermitNumber(ctx, domain)
+	})
 	if err != nil {
 		return 0, err
 	}
+	s.cachePermitNumber(domain, cn)
+	return cn, nil
+}
+
+func (s *Waitingroom) lastPermitUnit(ctx context.Context, domain string) (int64, error) {
+	if v := s.permitUnitCache.Get(domain); v != nil {
+		return v.Value(), nil
+	}
+	if err := s.prefetchQueue(ctx, domain); err != nil {
+		return 0, err
+	}
+	if v := s.permitUnitCache.Get(domain); v != nil {
+		return v.Value(), nil
+	}
+	return 0, nil
+}
 
+func (s *Waitingroom) cachePermitNumber(domain string, cn int64) {
+	s.setLastPermitNumber(domain, cn)
 	if cn == -1 {
-		s.currentPermitNumberCache.Set(domain, -1, time.Duration(s.config.NegativeCacheTTLSec)*time.Second)
-		return -1, nil
+		s.currentPermitNumberCache.Set(domain, -1, time.Duration(s.Config().NegativeCacheTTLSec)*time.Second)
+		return
 	}
-
-	s.currentPermitNumberCache.Set(domain, cn, time.Duration(s.config.CacheTTLSec)*time.Second)
-	return cn, nil
-
+	s.currentPermitNumberCache.Set(domain, cn, time.Duration(s.Config().CacheTTLSec)*time.Second)
 }
 
 func (s *Waitingroom) CheckAndPermitClient(ctx context.Context, domain string, c *Client) (bool, error) {
@@ -301,11 +425,29 @@ func (s *Waitingroom) CheckAndPermitClient(ctx context.Context, domain string, c
 
 	// 許可されたとおり番号以下の値を持っている
 	if c.IsPermitClient(an) {
-		err := s.repository.PermitClient(ctx, c.ID, time.Duration(s.config.PermittedAccessSec)*time.Second)
+		// ネガティブキャッシュの間に別の端末で許可されていれば、上書きせずに拒否する
+		if c.bound() {
+			v, err := s.repository.GetPermit(ctx, c.permitKey())
+			if err != nil {
+				return false, err
+			}
+			if reason := c.permitMismatch(parsePermitRecord(v)); reason != "" {
+				return false, s.rejectPermit(ctx, c, reason)
+			}
+		}
+
+		// 別の待合室や端末で使い回されないよう、許可した待合室とクライアントの特徴を記録する
+		rec := &permitRecord{Queue: domain, Fingerprint: c.fingerprint}
+		v, err := json.Marshal(rec)
 		if err != nil {
 			return false, err
 		}
-		slog.Info("PermitClient", slog.String("permit client", c.ID))
+		ttl := time.Duration(s.Config().PermittedAccessSec) * time.Second
+		if err := s.repository.PermitClient(ctx, c.permitKey(), string(v), ttl); err != nil {
+			return false, err
+		}
+		s.permittedClientCache.Set(c.permitKey(), rec, min(ttl, time.Duration(s.Config().CacheTTLSec)*time.Second))
+		slog.Info("PermitClient", slog.String("permit client", c.permitKey()))
 		return true, nil
 	}
 	return false, nil
@@ -317,12 +459,15 @@ func (s *Waitingroom) AssignSerialNumber(ctx context.Context, domain string, c *
 	}
 
 	if !c.HasID() {
-		if err := c.AssignID(s.config.EntryDelaySec); err != nil {
+		if err := c.AssignID(s.Config().EntryDelaySec); err != nil {
 			return 0, err
 		}
 	} else if c.canTakeSerialNumber() {
-		cn, err := s.repository.IncrCurrentNumber(ctx, domain, time.Duration(s.config.QueueEnableSec)*time.Second)
+		cn, err := s.repository.IncrCurrentNumber(ctx, domain, time.Duration(s.Config().QueueEnableSec)*time.Second)
 		if err != nil {
+			if errors.Is(err, ErrSoldOut) {
+				s.invalidate(ctx, InvalidateLimit, domain)
+			}
 			return 0, err
 		}
 		c.AssignSerialNumber(cn)
@@ -336,12 +481,25 @@ func (s *Waitingroom) CalcRemainingWaitSecond(ctx context.Context, domain string
 	if err != nil {
 		return 0, 0, err
 	}
+	config := s.Config()
+	unit := config.PermitUnitNumber
+	if config.GlobalPermitBudget > 0 {
+		// 全体の許可数を配分している場合は、直近の判定でこの待合室に配分した数で見積もる
+		// まだ配分していないか、配分が0だった場合は待合室ごとの許可数で見積もる
+		u, err := s.lastPermitUnit(ctx, domain)
+		if err != nil {
+			return 0, 0, err
+		}
+		if u > 0 {
+			unit = u
+		}
+	}
 	waitDiff := serialNumber - cp
 	if waitDiff > 0 {
-		if waitDiff%s.config.PermitUnitNumber == 0 {
-			remainingWaitSecond = waitDiff / s.config.PermitUnitNumber * int64(s.config.PermitIntervalSec)
+		if waitDiff%unit == 0 {
+			remainingWaitSecond = waitDiff / unit * int64(config.PermitIntervalSec)
 		} else {
-			remainingWaitSecond = (waitDiff/s.config.PermitUnitNumber + 1) * int64(s.config.PermitIntervalSec)
+			remainingWaitSecond = (waitDiff/unit + 1) * int64(config.PermitIntervalSec)
 		}
 	}
 	return remainingWaitSecond, cp, nil
@@ -349,15 +507,19 @@ func (s *Waitingroom) CalcRemainingWaitSecond(ctx context.Context, domain string
 }
 
 func (s *Waitingroom) ExtendDomainsTTL(ctx context.Context) error {
-	return s.repository.ExtendDomainsTTL(ctx, time.Duration(s.config.QueueEnableSec*2)*time.Second)
+	return s.repository.ExtendDomainsTTL(ctx, time.Duration(s.Config().QueueEnableSec*2)*time.Second)
 }
 
 func (s *Waitingroom) SaveCurrentNumber(ctx context.Context, domain string, num int64) error {
-	return s.repository.SaveCurrentNumber(ctx, domain, num, time.Duration(s.config.QueueEnableSec)*time.Second)
+	return s.repository.SaveCurrentNumber(ctx, domain, num, time.Duration(s.Config().QueueEnableSec)*time.Second)
 }
 
 func (s *Waitingroom) SaveCurrentPermitNumber(ctx context.Context, domain string, num int64) error {
-	return s.repository.SaveCurrentPermitNumber(ctx, domain, num, time.Duration(s.config.QueueEnableSec)*time.Second)
+	if err := s.repository.SaveCurrentPermitNumber(ctx, domain, num, time.Duration(s.Config().QueueEnableSec)*time.Second); err != nil {
+		return err
+	}
+	s.invalidate(ctx, InvalidateQueue, domain)
+	return nil
 }
 
 func (s *Waitingroom) GetWhiteListDomains(ctx context.Context, params ...*DomainsParam) ([]string, error) {
@@ -372,8 +534,36 @@ func (s *Waitingroom) GetWhiteListDomains(ctx context.Context, params ...*Domain
 	return s.repository.GetWhiteListDomains(ctx, page, perPage)
 }
 
-func (s *Waitingroom) AddWhiteListDomain(ctx context.Context, domain string) error {
-	return s.repository.AddWhiteListDomain(ctx, domain)
+// ルールを検証し、小文字にそろえて保存する。metaがnilなら有効期限を設けない
+func (s *Waitingroom) AddWhiteListDomain(ctx context.Context, rule string, meta *WhiteListMeta) error {
+	r, err := ParseWhiteListRule(rule)
+	if err != nil {
+		return err
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	m := WhiteListMeta{}
+	if meta != nil {
+		m = *meta
+	}
+	now := time.Now()
+	if m.Expired(now) {
+		return fmt.Errorf("expire_at must be in the future")
+	}
+	if m.CreatedAt == nil {
+		m.CreatedAt = &now
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.AddWhiteListDomain(ctx, r.String(), string(b)); err != nil {
+		return err
+	}
+	s.invalidate(ctx, InvalidateWhitelist, r.String())
+	return nil
 }
 
 func (s *Waitingroom) GetWhiteListDomainsCount(ctx context.Context) (int64, error) {
@@ -381,5 +571,9 @@ func (s *Waitingroom) GetWhiteListDomainsCount(ctx context.Context) (int64, erro
 }
 
 func (s *Waitingroom) RemoveWhiteListDomain(ctx context.Context, domain string) error {
-	return s.repository.RemoveWhiteListDomain(ctx, domain)
+	if _, err := s.repository.RemoveWhiteListDomain(ctx, domain); err != nil {
+		return err
+	}
+	s.invalidate(ctx, InvalidateWhitelist, domain)
+	return nil
 }
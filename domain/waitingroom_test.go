@@ -31,6 +31,7 @@ func TestWaitingroom_AppendPermitNumber(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 				mock.EXPECT().GetCurrentPermitNumber(context.Background(), domain).Return(int64(1), nil).Times(1)
 
 				mock.EXPECT().GetCurrentPermitNumberTTL(context.Background(), domain).Return(time.Second, nil).Times(1)
@@ -57,6 +58,7 @@ func TestWaitingroom_AppendPermitNumber(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 				mock.EXPECT().GetCurrentPermitNumber(context.Background(), domain).Return(int64(2), nil).Times(1)
 
 				mock.EXPECT().GetCurrentPermitNumberTTL(context.Background(), domain).Return(time.Second, nil).Times(1)
@@ -104,6 +106,7 @@ func TestWaitingroom_Reset(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 				mock.EXPECT().DisableDomain(context.Background(), domain).Return(nil).Times(1)
 				return mock
 			},
@@ -209,6 +212,7 @@ func TestWaitingroom_EnableQueue(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().PublishInvalidation(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 				mock.EXPECT().EnableDomain(context.Background(), domain, 600*time.Second).Return(nil).Times(1)
 				return mock
 			},
@@ -259,7 +263,7 @@ func TestWaitingroom_IsPermittedClient(t *testing.T) {
 
 			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
-				mock.EXPECT().Exists(context.Background(), id).Return(true, nil).Times(1)
+				mock.EXPECT().IsPermitted(context.Background(), id).Return(true, nil).Times(1)
 				return mock
 			},
 			wantErr: nil,
@@ -280,12 +284,198 @@ func TestWaitingroom_IsPermittedClient(t *testing.T) {
 
 			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
-				mock.EXPECT().Exists(context.Background(), id).Return(false, nil).Times(1)
+				mock.EXPECT().IsPermitted(context.Background(), id).Return(false, nil).Times(1)
 				return mock
 			},
 			wantErr: nil,
 			want:    false,
 		},
+		{
+			name: "permitted with domain binding",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return(`{"queue":"example.com"}`, nil).Times(1)
+				return mock
+			},
+			wantErr: nil,
+			want:    true,
+		},
+		{
+			name: "not permitted with domain binding",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return("", nil).Times(1)
+				return mock
+			},
+			wantErr: nil,
+			want:    false,
+		},
+		{
+			name: "other domain",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return(`{"queue":"other.example.com"}`, nil).Times(1)
+				return mock
+			},
+			wantErr: ErrPermitMismatch,
+			want:    false,
+		},
+		{
+			name: "other fingerprint",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingFingerprint,
+				fingerprint:  "b",
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return(`{"queue":"example.com","fingerprint":"a"}`, nil).Times(1)
+				return mock
+			},
+			wantErr: ErrPermitMismatch,
+			want:    false,
+		},
+		{
+			name: "fingerprint is ignored by domain binding",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+				fingerprint:  "b",
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return(`{"queue":"example.com","fingerprint":"a"}`, nil).Times(1)
+				return mock
+			},
+			wantErr: nil,
+			want:    true,
+		},
+		{
+			name: "legacy record",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().GetPermit(context.Background(), id).Return("1", nil).Times(1)
+				return mock
+			},
+			wantErr: nil,
+			want:    true,
+		},
+		{
+			name: "cookie of other domain",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				Queue:        "other.example.com",
+				domain:       "example.com",
+				binding:      PermitBindingDomain,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				return repository.NewMockWaitingroomRepositoryer(ctrl)
+			},
+			wantErr: ErrPermitMismatch,
+			want:    false,
+		},
+		{
+			name: "without binding",
+			fields: fields{
+				config: &Config{
+					PermitUnitNumber: 1000,
+					QueueEnableSec:   600,
+				},
+			},
+			client: &Client{
+				ID:           testutils.TestRandomString(10),
+				SerialNumber: 1,
+				Queue:        "other.example.com",
+				domain:       "example.com",
+				binding:      PermitBindingOff,
+			},
+
+			waitingroomRepoMock: func(ctrl *gomock.Controller, id string) *repository.MockWaitingroomRepositoryer {
+				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
+				mock.EXPECT().IsPermitted(context.Background(), id).Return(true, nil).Times(1)
+				return mock
+			},
+			wantErr: nil,
+			want:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -334,7 +524,7 @@ func TestWaitingroom_CheckAndPermitClient(t *testing.T) {
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain, id string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
 				mock.EXPECT().GetCurrentPermitNumber(context.Background(), domain).Return(int64(100), nil).Times(1)
-				mock.EXPECT().PermitClient(context.Background(), id, 10*time.Second).Return(nil).Times(1)
+				mock.EXPECT().PermitClient(context.Background(), id, `{"queue":"`+domain+`"}`, 10*time.Second).Return(nil).Times(1)
 				return mock
 			},
 			wantErr: nil,
@@ -423,7 +613,8 @@ func TestWaitingroom_isWaitingroomIsInWhitelist(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
-				mock.EXPECT().IsWhiteListDomain(context.Background(), domain).Return(false, nil).Times(1)
+				mock.EXPECT().GetWhiteListDomains(context.Background(), int64(0), int64(-1)).Return([]string{"other." + domain}, nil).Times(1)
+				mock.EXPECT().GetWhiteListMetas(context.Background()).Return(map[string]string{}, nil).Times(1)
 				return mock
 			},
 			wantErr: false,
@@ -438,7 +629,8 @@ func TestWaitingroom_isWaitingroomIsInWhitelist(t *testing.T) {
 			},
 			waitingroomRepoMock: func(ctrl *gomock.Controller, domain string) *repository.MockWaitingroomRepositoryer {
 				mock := repository.NewMockWaitingroomRepositoryer(ctrl)
-				mock.EXPECT().IsWhiteListDomain(context.Background(), domain).Return(true, nil).Times(1)
+				mock.EXPECT().GetWhiteListDomains(context.Background(), int64(0), int64(-1)).Return([]string{domain}, nil).Times(1)
+				mock.EXPECT().GetWhiteListMetas(context.Background()).Return(map[string]string{}, nil).Times(1)
 				return mock
 			},
 			wantErr: false,
@@ -450,10 +642,10 @@ func TestWaitingroom_isWaitingroomIsInWhitelist(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			domain := testutils.TestRandomString(10)
+			domain := testutils.TestRandomString(10) + ".example.com"
 			waitingroomRepoMock := tt.waitingroomRepoMock(ctrl, domain)
 			s := NewWaitingroom(tt.fields.config, waitingroomRepoMock)
-			got, err := s.IsInWhitelist(context.Background(), domain)
+			got, err := s.IsInWhitelist(context.Background(), domain, "/")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Waitingroom.IsInWhitelist() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,311 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+)
+
+// ホワイトリストのルールの種類。判定はこの順に行う
+const (
+	WhiteListTypeExact  = "exact"  // example.com
+	WhiteListTypeSuffix = "suffix" // *.example.com。サブドメインに一致し、example.com自体には一致しない
+	WhiteListTypeRegexp = "regexp" // ~shop[0-9]+\.example\.com。ドメイン全体に一致したものだけを対象にする
+)
+
+const (
+	whiteListSuffixPrefix = "*."
+	whiteListRegexpPrefix = "~"
+)
+
+// ルールはまとめて取得してコンパイルし、このキーでキャッシュする
+const whiteListCacheKey = "rules"
+
+// ルールの有効期限と登録の経緯
+// 有効期限を過ぎたルールは判定に使わず、許可番号の判定周期で削除して通知する
+type WhiteListMeta struct {
+	ExpireAt  *time.Time `json:"expire_at,omitempty"` // 未指定なら削除するまで有効
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+func (m *WhiteListMeta) Expired(now time.Time) bool {
+	return m.ExpireAt != nil && !now.Before(*m.ExpireAt)
+}
+
+// 解釈できなければ記録し、有効期限のないルールとして扱う
+func parseWhiteListMeta(rule, raw string) WhiteListMeta {
+	m := WhiteListMeta{}
+	if raw == "" {
+		return m
+	}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		slog.Warn("invalid whitelist meta", slog.String("rule", rule), slog.String("error", err.Error()))
+		return WhiteListMeta{}
+	}
+	return m
+}
+
+// ホワイトリストのルール
+// Redisにはドメインのパターンにパスをつなげた文字列(example.com/admin)で保存する
+type WhiteListRule struct {
+	WhiteListMeta
+	Pattern string
+	Path    string // 空ならすべてのパスに一致する
+	Type    string
+	re      *regexp.Regexp
+}
+
+// パターンの種類を判定し、正規表現ならコンパイルする
+// ドメインの形式は検証しないため、登録する前にValidateを呼ぶ
+func NewWhiteListRule(pattern, path string) (*WhiteListRule, error) {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /: %s", path)
+	}
+
+	r := &WhiteListRule{Pattern: pattern, Path: path}
+	switch {
+	case strings.HasPrefix(pattern, whiteListRegexpPrefix):
+		r.Type = WhiteListTypeRegexp
+		expr := strings.TrimPrefix(pattern, whiteListRegexpPrefix)
+		if expr == "" || strings.Contains(expr, "/") {
+			return nil, fmt.Errorf("invalid whitelist regexp: %s", pattern)
+		}
+		// 部分一致で意図しないドメインを通さないよう、常に全体で一致させる
+		re, err := regexp.Compile("^(?i:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid whitelist regexp %s: %w", pattern, err)
+		}
+		r.re = re
+	case strings.HasPrefix(pattern, whiteListSuffixPrefix):
+		r.Type = WhiteListTypeSuffix
+		r.Pattern = strings.ToLower(pattern)
+	default:
+		r.Type = WhiteListTypeExact
+		r.Pattern = strings.ToLower(pattern)
+	}
+	return r, nil
+}
+
+// 完全一致とサフィックスのパターンがドメインの形式かを検証する
+func (r *WhiteListRule) Validate() error {
+	var d string
+	switch r.Type {
+	case WhiteListTypeExact:
+		d = r.Pattern
+	case WhiteListTypeSuffix:
+		d = strings.TrimPrefix(r.Pattern, whiteListSuffixPrefix)
+	default:
+		return nil
+	}
+	if err := validator.New().Var(d, "fqdn"); err != nil {
+		return fmt.Errorf("invalid whitelist domain %s: %w", r.Pattern, err)
+	}
+	return nil
+}
+
+// Redisに保存した文字列からルールを作る。パターンはパスの/を含まない
+func ParseWhiteListRule(s string) (*WhiteListRule, error) {
+	if i := strings.Index(s, "/"); i >= 0 {
+		return NewWhiteListRule(s[:i], s[i:])
+	}
+	return NewWhiteListRule(s, "")
+}
+
+func (r *WhiteListRule) String() string {
+	return r.Pattern + r.Path
+}
+
+// domainは小文字にしてから渡す
+func (r *WhiteListRule) Match(domain, path string) bool {
+	if r.Path != "" && !matchPathPrefix(r.Path, path) {
+		return false
+	}
+	switch r.Type {
+	case WhiteListTypeSuffix:
+		return strings.HasSuffix(domain, strings.TrimPrefix(r.Pattern, "*"))
+	case WhiteListTypeRegexp:
+		return r.re.MatchString(domain)
+	}
+	return domain == r.Pattern
+}
+
+// 種類ごとに分けたルール
+type whiteListRules struct {
+	exact   map[string][]*WhiteListRule
+	suffix  map[string][]*WhiteListRule // *.を除いたドメインごと
+	regexps []*WhiteListRule
+}
+
+// 解釈できないルールは記録して読み飛ばす。metasはルールごとのWhiteListMetaのJSON
+func compileWhiteList(members []string, metas map[string]string) *whiteListRules {
+	ret := &whiteListRules{
+		exact:  map[string][]*WhiteListRule{},
+		suffix: map[string][]*WhiteListRule{},
+	}
+	for _, m := range members {
+		r, err := ParseWhiteListRule(m)
+		if err != nil {
+			slog.Warn("skip whitelist rule", slog.String("rule", m), slog.String("error", err.Error()))
+			continue
+		}
+		r.WhiteListMeta = parseWhiteListMeta(m, metas[m])
+		switch r.Type {
+		case WhiteListTypeExact:
+			ret.exact[r.Pattern] = append(ret.exact[r.Pattern], r)
+		case WhiteListTypeSuffix:
+			d := strings.TrimPrefix(r.Pattern, whiteListSuffixPrefix)
+			ret.suffix[d] = append(ret.suffix[d], r)
+		case WhiteListTypeRegexp:
+			ret.regexps = append(ret.regexps, r)
+		}
+	}
+
+	// 同じパターンでは長いパスを優先し、パスのないルールを最後にする
+	byPath := func(rules []*WhiteListRule) {
+		sort.SliceStable(rules, func(i, j int) bool {
+			if rules[i].Pattern != rules[j].Pattern {
+				return rules[i].Pattern < rules[j].Pattern
+			}
+			return len(rules[i].Path) > len(rules[j].Path)
+		})
+	}
+	for _, rules := range ret.exact {
+		byPath(rules)
+	}
+	for _, rules := range ret.suffix {
+		byPath(rules)
+	}
+	byPath(ret.regexps)
+	return ret
+}
+
+// 完全一致、長いサフィックス、正規表現(パターンの辞書順)の順に調べ、最初に一致したルールを返す
+// 有効期限を過ぎたルールは削除される前でも使わない
+func (w *whiteListRules) Match(domain, path string) *WhiteListRule {
+	domain = strings.ToLower(domain)
+	now := time.Now()
+	first := func(rules []*WhiteListRule) *WhiteListRule {
+		for _, r := range rules {
+			if !r.Expired(now) && r.Match(domain, path) {
+				return r
+			}
+		}
+		return nil
+	}
+
+	if r := first(w.exact[domain]); r != nil {
+		return r
+	}
+	for d := domain; ; {
+		_, rest, ok := strings.Cut(d, ".")
+		if !ok {
+			break
+		}
+		if r := first(w.suffix[rest]); r != nil {
+			return r
+		}
+		d = rest
+	}
+	return first(w.regexps)
+}
+
+func (s *Waitingroom) whiteListRules(ctx context.Context) (*whiteListRules, error) {
+	if v := s.whiteListCache.Get(whiteListCacheKey); v != nil {
+		return v.Value(), nil
+	}
+
+	return coalesce(ctx, s, "whitelist", func(ctx context.Context) (*whiteListRules, error) {
+		members, err := s.repository.GetWhiteListDomains(ctx, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		metas, err := s.repository.GetWhiteListMetas(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rules := compileWhiteList(members, metas)
+		s.whiteListCache.Set(whiteListCacheKey, rules, time.Duration(s.Config().CacheTTLSec)*time.Second)
+		return rules, nil
+	})
+}
+
+// ドメインとパスに一致するホワイトリストのルールを返す。一致しなければnilを返す
+func (s *Waitingroom) MatchWhiteList(ctx context.Context, domain, path string) (*WhiteListRule, error) {
+	rules, err := s.whiteListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Match(domain, path), nil
+}
+
+func (s *Waitingroom) IsInWhitelist(ctx context.Context, domain, path string) (bool, error) {
+	r, err := s.MatchWhiteList(ctx, domain, path)
+	if err != nil {
+		return false, err
+	}
+	return r != nil, nil
+}
+
+func (s *Waitingroom) GetWhiteListMetas(ctx context.Context) (map[string]WhiteListMeta, error) {
+	v, err := s.repository.GetWhiteListMetas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]WhiteListMeta{}
+	for rule, raw := range v {
+		ret[rule] = parseWhiteListMeta(rule, raw)
+	}
+	return ret, nil
+}
+
+// 有効期限を過ぎたルールを削除する
+// 複数のインスタンスで実行しても、削除できたインスタンスだけが通知する
+func (s *Waitingroom) RemoveExpiredWhiteList(ctx context.Context) error {
+	metas, err := s.GetWhiteListMetas(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get whitelist metas")
+	}
+
+	now := time.Now()
+	for rule, m := range metas {
+		if !m.Expired(now) {
+			continue
+		}
+		deleted, err := s.repository.RemoveWhiteListDomain(ctx, rule)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			continue
+		}
+		s.invalidate(ctx, InvalidateWhitelist, rule)
+		slog.Info(
+			"whitelist expired",
+			slog.String("rule", rule),
+			slog.String("reason", m.Reason),
+			slog.String("created_by", m.CreatedBy),
+		)
+		if err := NotifySlack(s.Config(), "WaitingRoom whitelist expired",
+			fmt.Sprintf("Rule: %s", rule),
+			fmt.Sprintf("Reason: %s", m.Reason),
+			fmt.Sprintf("Created by: %s", m.CreatedBy),
+		); err != nil {
+			slog.Error(
+				"failed to notify slack",
+				slog.String("rule", rule),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+)
+
+func TestWhiteListRules_Match(t *testing.T) {
+	rules := compileWhiteList([]string{
+		"example.com",
+		"admin.example.com/admin",
+		"*.example.com",
+		"*.shop.example.com/cart",
+		`~shop[0-9]+\.example\.net`,
+		"~[a-z]+.example.org/api/",
+		"~(invalid",
+		"expired.example.com",
+	}, map[string]string{
+		"expired.example.com": `{"expire_at":"2000-01-01T00:00:00Z"}`,
+		"*.example.com":       `{"expire_at":"2999-01-01T00:00:00Z"}`,
+	})
+	tests := []struct {
+		domain string
+		path   string
+		want   string
+	}{
+		{domain: "example.com", path: "/", want: "example.com"},
+		{domain: "EXAMPLE.com", path: "/", want: "example.com"},
+		{domain: "www.example.com", path: "/", want: "*.example.com"},
+		{domain: "admin.example.com", path: "/admin/users", want: "admin.example.com/admin"},
+		// パスが一致しなければ、次に優先されるルールで判定する
+		{domain: "admin.example.com", path: "/administrator", want: "*.example.com"},
+		{domain: "a.shop.example.com", path: "/cart", want: "*.shop.example.com/cart"},
+		{domain: "a.shop.example.com", path: "/", want: "*.example.com"},
+		{domain: "example.com.evil.test", path: "/", want: ""},
+		// 有効期限を過ぎたルールは使わない
+		{domain: "expired.example.com", path: "/", want: "*.example.com"},
+		{domain: "shop12.example.net", path: "/", want: `~shop[0-9]+\.example\.net`},
+		// 正規表現はドメイン全体に一致したものだけを対象にする
+		{domain: "shop12.example.net.evil.test", path: "/", want: ""},
+		{domain: "xshop1.example.net", path: "/", want: ""},
+		{domain: "www.example.org", path: "/api/items", want: "~[a-z]+.example.org/api/"},
+		{domain: "www.example.org", path: "/api", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain+tt.path, func(t *testing.T) {
+			got := ""
+			if r := rules.Match(tt.domain, tt.path); r != nil {
+				got = r.String()
+			}
+			if got != tt.want {
+				t.Errorf("whiteListRules.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWhiteListRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		wantType string
+		wantPath string
+		wantErr  bool
+	}{
+		{rule: "Example.com", wantType: WhiteListTypeExact},
+		{rule: "*.example.com/admin", wantType: WhiteListTypeSuffix, wantPath: "/admin"},
+		{rule: `~shop[0-9]+\.example\.com`, wantType: WhiteListTypeRegexp},
+		{rule: "~(shop", wantErr: true},
+		{rule: "~", wantErr: true},
+		{rule: "example", wantErr: true},
+		{rule: "*.example", wantErr: true},
+		{rule: "*example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := ParseWhiteListRule(tt.rule)
+			if err == nil {
+				err = r.Validate()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWhiteListRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if r.Type != tt.wantType || r.Path != tt.wantPath {
+				t.Errorf("ParseWhiteListRule() = %v %v, want %v %v", r.Type, r.Path, tt.wantType, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestWaitingroom_AddWhiteListDomain(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	wr := NewWaitingroom(&Config{CacheTTLSec: 60}, repository.NewWaitingroomRepository(redisClient))
+	ctx := context.Background()
+	base := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	rule := "*." + base + "/admin"
+	defer wr.RemoveWhiteListDomain(ctx, rule)
+
+	ok, err := wr.IsInWhitelist(ctx, "www."+base, "/admin")
+	if err != nil || ok {
+		t.Fatalf("IsInWhitelist() = %v, %v, want false", ok, err)
+	}
+
+	if err := wr.AddWhiteListDomain(ctx, rule, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.AddWhiteListDomain(ctx, "*.invalid", nil); err == nil {
+		t.Error("AddWhiteListDomain() should reject invalid domain")
+	}
+
+	// 追加したインスタンスのキャッシュはすぐに破棄される
+	ok, err = wr.IsInWhitelist(ctx, "www."+base, "/admin/users")
+	if err != nil || !ok {
+		t.Errorf("IsInWhitelist() = %v, %v, want true", ok, err)
+	}
+	ok, err = wr.IsInWhitelist(ctx, "www."+base, "/")
+	if err != nil || ok {
+		t.Errorf("IsInWhitelist() = %v, %v, want false", ok, err)
+	}
+}
+
+func TestWaitingroom_RemoveExpiredWhiteList(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	repo := repository.NewWaitingroomRepository(redisClient)
+	config := &Config{CacheTTLSec: 60}
+	wr := NewWaitingroom(config, repo)
+	other := NewWaitingroom(config, repo)
+	ctx := context.Background()
+	expired := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	active := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	defer wr.RemoveWhiteListDomain(ctx, expired)
+	defer wr.RemoveWhiteListDomain(ctx, active)
+
+	past := time.Now().Add(-time.Minute)
+	if err := wr.AddWhiteListDomain(ctx, expired, &WhiteListMeta{ExpireAt: &past}); err == nil {
+		t.Error("AddWhiteListDomain() should reject expire_at in the past")
+	}
+	if err := wr.AddWhiteListDomain(ctx, expired, &WhiteListMeta{Reason: "incident", CreatedBy: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := wr.AddWhiteListDomain(ctx, active, &WhiteListMeta{ExpireAt: &future}); err != nil {
+		t.Fatal(err)
+	}
+	// 有効期限が過ぎた状態を作る
+	metas, err := wr.GetWhiteListMetas(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metas[expired]
+	if m.Reason != "incident" || m.CreatedBy != "alice" || m.CreatedAt == nil {
+		t.Errorf("GetWhiteListMetas() = %+v", m)
+	}
+	m.ExpireAt = &past
+	b, _ := json.Marshal(m)
+	if err := repo.AddWhiteListDomain(ctx, expired, string(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := wr.IsInWhitelist(ctx, expired, "/")
+	if err != nil || ok {
+		t.Errorf("IsInWhitelist() = %v, %v, want false before removal", ok, err)
+	}
+
+	if err := wr.RemoveExpiredWhiteList(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.RemoveExpiredWhiteList(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := repo.IsWhiteListDomain(ctx, expired); ok {
+		t.Errorf("expired rule should be removed")
+	}
+	if ok, _ := repo.IsWhiteListDomain(ctx, active); !ok {
+		t.Errorf("active rule should not be removed")
+	}
+	metas, err = wr.GetWhiteListMetas(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metas[expired]; ok {
+		t.Errorf("meta of expired rule should be removed")
+	}
+}
@@ -31,6 +31,12 @@ import "github.com/pyama86/waitingroom/cmd"
 // @BasePath /v1
 // @tag.name queues
 // @tag.name whitelist
+// @tag.name pages
+// @tag.name maintenances
+// @tag.name routes
+// @tag.name groups
+// @tag.name iprules
+// @tag.name settings
 // @tag.name viron
 
 func main() {
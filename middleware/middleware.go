@@ -0,0 +1,192 @@
+// Package middleware は、nginxを経由せずにGoのアプリケーション内で
+// 待合室を有効にするためのnet/httpミドルウェアを提供する。
+//
+// net/httpやchiでは Handler をそのまま利用でき、echoでは Echo を利用する。
+// 許可番号の更新はwaitingroom serverのワーカーが行うため、同じRedisを参照する
+// waitingroom serverが別途稼働している必要がある。
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/pyama86/waitingroom/repository"
+)
+
+type Middleware struct {
+	wr             *waitingroom.Waitingroom
+	sc             *securecookie.SecureCookie
+	domainFunc     func(*http.Request) string
+	enableFunc     func(*http.Request) bool
+	waitingHandler func(http.ResponseWriter, *http.Request, *waitingroom.QueueResult)
+	errorHandler   func(http.ResponseWriter, *http.Request, error)
+}
+
+type Option func(*Middleware)
+
+// 待合室のキーとなるドメインをリクエストから決定する関数を指定する
+func WithDomainFunc(f func(*http.Request) string) Option {
+	return func(m *Middleware) {
+		m.domainFunc = f
+	}
+}
+
+// trueを返したリクエストで待合室を有効にする
+// nginxの構成における /queues/:domain/enable に相当する
+func WithEnableFunc(f func(*http.Request) bool) Option {
+	return func(m *Middleware) {
+		m.enableFunc = f
+	}
+}
+
+// 待機中のクライアントへの応答を差し替える
+func WithWaitingHandler(f func(http.ResponseWriter, *http.Request, *waitingroom.QueueResult)) Option {
+	return func(m *Middleware) {
+		m.waitingHandler = f
+	}
+}
+
+// 待機中のクライアントに、テンプレートから描画した待機ページを返す
+func WithWaitingPage(renderer *waitingroom.PageRenderer, config *waitingroom.Config) Option {
+	return func(m *Middleware) {
+		m.waitingHandler = func(w http.ResponseWriter, r *http.Request, result *waitingroom.QueueResult) {
+			if result.Denied {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			var buf bytes.Buffer
+			data := waitingroom.NewPageData(m.domainFunc(r), result, config)
+			if err := renderer.Render(r.Context(), &buf, r.Header.Get("Accept-Language"), data); err != nil {
+				slog.Error("failed to render waiting page", slog.String("error", err.Error()))
+				DefaultWaitingHandler(w, r, result)
+				return
+			}
+
+			if ra := result.RetryAfter(); ra > 0 {
+				w.Header().Set("Retry-After", strconv.FormatInt(ra, 10))
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			if result.SoldOut {
+				w.WriteHeader(http.StatusGone)
+			} else if result.Throttled {
+				w.WriteHeader(http.StatusTooManyRequests)
+			} else {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			if _, err := buf.WriteTo(w); err != nil {
+				slog.Error("failed to write waiting page", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// 判定でエラーが発生した際の応答を差し替える
+func WithErrorHandler(f func(http.ResponseWriter, *http.Request, error)) Option {
+	return func(m *Middleware) {
+		m.errorHandler = f
+	}
+}
+
+func New(
+	sc *securecookie.SecureCookie,
+	redisC *redis.Client,
+	config *waitingroom.Config,
+	opts ...Option,
+) *Middleware {
+	repo := repository.NewWaitingroomRepository(redisC)
+	return NewWithWaitingroom(sc, waitingroom.NewWaitingroom(config, repo), opts...)
+}
+
+// 既存のWaitingroomを共有してミドルウェアを作成する
+func NewWithWaitingroom(sc *securecookie.SecureCookie, wr *waitingroom.Waitingroom, opts ...Option) *Middleware {
+	m := &Middleware{
+		wr:             wr,
+		sc:             sc,
+		domainFunc:     DomainFromHost,
+		enableFunc:     func(*http.Request) bool { return false },
+		waitingHandler: DefaultWaitingHandler,
+		errorHandler:   DefaultErrorHandler,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, result, err := m.wr.Check(w, r, m.sc, m.domainFunc(r), r.URL.Path, m.enableFunc(r))
+		if err != nil {
+			slog.Error(
+				"error waitingroom middleware",
+				slog.String("host", r.Host),
+				slog.String("error", err.Error()),
+			)
+			m.errorHandler(w, r, err)
+			return
+		}
+
+		if status == http.StatusOK {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.waitingHandler(w, r, result)
+	})
+}
+
+// 他のインスタンスでの変更をキャッシュに反映する。ctxがキャンセルされるまで戻らない
+func (m *Middleware) WatchInvalidations(ctx context.Context) error {
+	return m.wr.WatchInvalidations(ctx)
+}
+
+func (m *Middleware) Echo() echo.MiddlewareFunc {
+	return echo.WrapMiddleware(m.Handler)
+}
+
+// ポート番号を除いたHostを待合室のドメインとする
+func DomainFromHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
+
+// mrubyと同様にserial_no,permitted_noをヘッダに設定し、判定結果をJSONで返す
+// メンテナンス中とRedisに接続できず通し番号を持たないクライアントには503、受付終了後は410、
+// IPのルールで拒否したクライアントには403、発行数の上限に達したクライアントには通し番号のヘッダを付けずに429を返す
+func DefaultWaitingHandler(w http.ResponseWriter, r *http.Request, result *waitingroom.QueueResult) {
+	status := http.StatusTooManyRequests
+	if result.Denied {
+		status = http.StatusForbidden
+	} else if result.Maintenance || (result.Degraded && result.SerialNo == 0) {
+		status = http.StatusServiceUnavailable
+	} else if result.SoldOut {
+		status = http.StatusGone
+	} else if !result.Throttled {
+		w.Header().Set("serial_no", strconv.FormatInt(result.SerialNo, 10))
+		w.Header().Set("permitted_no", strconv.FormatInt(result.PermittedNo, 10))
+	}
+	if ra := result.RetryAfter(); ra > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(ra, 10))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error("failed to write waiting response", slog.String("error", err.Error()))
+	}
+}
+
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
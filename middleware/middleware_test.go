@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	waitingroom "github.com/pyama86/waitingroom/domain"
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_Handler(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	config := &waitingroom.Config{
+		EntryDelaySec:      10,
+		PermittedAccessSec: 10,
+		PermitUnitNumber:   10,
+		PermitIntervalSec:  10,
+		QueueEnableSec:     10,
+	}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		beforeHook func(string, *redis.Client)
+		wantStatus int
+		wantNext   bool
+	}{
+		{
+			name:       "queue isn't start",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name: "waiting",
+			beforeHook: func(key string, redisClient *redis.Client) {
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 0, 10*time.Second)
+			},
+			wantStatus: http.StatusTooManyRequests,
+			wantNext:   false,
+		},
+		{
+			name: "enable by option",
+			opts: []Option{
+				WithEnableFunc(func(*http.Request) bool { return true }),
+			},
+			wantStatus: http.StatusTooManyRequests,
+			wantNext:   false,
+		},
+		{
+			name: "custom waiting response",
+			opts: []Option{
+				WithWaitingHandler(func(w http.ResponseWriter, r *http.Request, result *waitingroom.QueueResult) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}),
+			},
+			beforeHook: func(key string, redisClient *redis.Client) {
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 0, 10*time.Second)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantNext:   false,
+		},
+		{
+			name: "is in whitelist",
+			beforeHook: func(key string, redisClient *redis.Client) {
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "current_no"), 1, 10*time.Second)
+				redisClient.SetEX(context.Background(), repository.Keys().Queue(key, "permitted_no"), 0, 10*time.Second)
+				redisClient.ZAdd(context.Background(), repository.Keys().Global("whitelist"), &redis.Z{Member: key, Score: 1})
+			},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := testutils.TestRandomString(20)
+			if tt.beforeHook != nil {
+				tt.beforeHook(domain, redisClient)
+			}
+
+			m := New(testutils.SecureCookie, redisClient, config, tt.opts...)
+			called := false
+			h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = domain + ":8080"
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantNext, called)
+		})
+	}
+}
+
+func TestMiddleware_Echo(t *testing.T) {
+	redisClient := testutils.TestRedisClient()
+	domain := testutils.TestRandomString(20)
+	redisClient.SetEX(context.Background(), repository.Keys().Queue(domain, "current_no"), 1, 10*time.Second)
+	redisClient.SetEX(context.Background(), repository.Keys().Queue(domain, "permitted_no"), 0, 10*time.Second)
+
+	m := New(testutils.SecureCookie, redisClient, &waitingroom.Config{
+		EntryDelaySec:      10,
+		PermittedAccessSec: 10,
+		PermitUnitNumber:   10,
+		PermitIntervalSec:  10,
+	})
+
+	e := echo.New()
+	e.Use(m.Echo())
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = domain
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Set-Cookie"))
+}
@@ -1,9 +1,14 @@
+# ルートごとの待合室を判定できるよう、アクセスされたパスを渡す
+def escape_uri(s)
+  s.gsub(/[^A-Za-z0-9\-._~\/]/) { |c| c.bytes.map { |b| "%%%02X" % b }.join }
+end
+
 def run(enable)
   begin
     r = Nginx::Request.new
     url = "/queues/#{r.var.host}"
     url << "/enable" if enable
-    Nginx::Async::HTTP.sub_request url
+    Nginx::Async::HTTP.sub_request url, "uri=#{escape_uri(r.var.uri)}"
     res = Nginx::Async::HTTP.last_response
     ho = r.headers_out
     ho["Set-Cookie"] = res.headers["Set-Cookie"]
@@ -19,6 +24,12 @@ def run(enable)
         ho[n] = r[n].to_s
       end
       return Nginx::HTTP_SERVICE_UNAVAILABLE
+    when 403
+      # IPのルールで拒否
+      return Nginx::HTTP_FORBIDDEN
+    when 503, 410
+      # メンテナンス中、受付終了
+      return Nginx::HTTP_SERVICE_UNAVAILABLE
     end
   rescue => e
     Nginx.errlogger Nginx::LOG_ERR, e.inspect
@@ -5,36 +5,43 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 )
 
-const suffixPermittedNoLock = "_permitted_no_lock"
+const keyPermittedNoLock = "permitted_no_lock"
+
+// 自身が取ったロックの場合のみ削除する
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
 
 type ClusterRepositoryer interface {
 	GetLockforPermittedNumber(context.Context, string, time.Duration) (bool, error)
+	ReleaseLockforPermittedNumber(context.Context, string) error
 }
 
 type ClusterRepository struct {
 	redisC *redis.Client
+	keys   *Keyspace
+	owner  string // ロックに保存し、期限切れの後に他のインスタンスが取ったロックを消さないようにする
 }
 
-func NewClusterRepository(redisC *redis.Client) *ClusterRepository {
+func NewClusterRepository(redisC *redis.Client, keys *Keyspace) *ClusterRepository {
 	return &ClusterRepository{
 		redisC: redisC,
+		keys:   keys,
+		owner:  uuid.NewString(),
 	}
 }
 
 func (c *ClusterRepository) GetLockforPermittedNumber(ctx context.Context, domain string, ttl time.Duration) (bool, error) {
-	key := domain + suffixPermittedNoLock
-	ok, err := c.redisC.SetNX(ctx, key, "1", 0).Result()
-	if err != nil {
-		return false, err
-	}
+	// 取得と有効期限の設定の間で停止しても、ロックが残り続けないよう同時に行う
+	return c.redisC.SetNX(ctx, c.keys.Queue(domain, keyPermittedNoLock), c.owner, ttl).Result()
+}
 
-	if ok {
-		err = c.redisC.Expire(ctx, key, ttl).Err()
-		if err != nil {
-			return false, err
-		}
-	}
-	return ok, nil
+func (c *ClusterRepository) ReleaseLockforPermittedNumber(ctx context.Context, domain string) error {
+	return releaseLockScript.Run(ctx, c.redisC, []string{c.keys.Queue(domain, keyPermittedNoLock)}, c.owner).Err()
 }
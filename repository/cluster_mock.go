@@ -55,3 +55,17 @@ func (mr *MockClusterRepositoryerMockRecorder) GetLockforPermittedNumber(arg0, a
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLockforPermittedNumber", reflect.TypeOf((*MockClusterRepositoryer)(nil).GetLockforPermittedNumber), arg0, arg1, arg2)
 }
+
+// ReleaseLockforPermittedNumber mocks base method.
+func (m *MockClusterRepositoryer) ReleaseLockforPermittedNumber(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseLockforPermittedNumber", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLockforPermittedNumber indicates an expected call of ReleaseLockforPermittedNumber.
+func (mr *MockClusterRepositoryerMockRecorder) ReleaseLockforPermittedNumber(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseLockforPermittedNumber", reflect.TypeOf((*MockClusterRepositoryer)(nil).ReleaseLockforPermittedNumber), arg0, arg1)
+}
@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterRepository_ReleaseLockforPermittedNumber(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	domain := testutils.TestRandomString(10) + ".example.com"
+	key := repository.Keys().Queue(domain, "permitted_no_lock")
+	defer redisClient.Del(ctx, key)
+
+	a := repository.NewClusterRepository(redisClient, repository.Keys())
+	b := repository.NewClusterRepository(redisClient, repository.Keys())
+
+	ok, err := a.GetLockforPermittedNumber(ctx, domain, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.GetLockforPermittedNumber(ctx, domain, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 期限が切れて他のインスタンスが取ったロックは消さない
+	redisClient.Del(ctx, key)
+	ok, err = b.GetLockforPermittedNumber(ctx, domain, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, a.ReleaseLockforPermittedNumber(ctx, domain))
+	assert.Equal(t, int64(1), redisClient.Exists(ctx, key).Val())
+
+	assert.NoError(t, b.ReleaseLockforPermittedNumber(ctx, domain))
+	assert.Equal(t, int64(0), redisClient.Exists(ctx, key).Val())
+}
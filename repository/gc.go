@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 見つかった不整合の種類
+const (
+	GCLockWithoutTTL      = "lock_without_ttl"       // 取得中に停止したため、有効期限を持たない許可番号のロック
+	GCKeyWithoutTTL       = "key_without_ttl"        // 有効期限を持たないため、消えることのない番号や許可、回数
+	GCMissingPermittedNo  = "missing_permitted_no"   // 有効な待合室に許可番号がない
+	GCCurrentBehindLastNo = "current_behind_last_no" // 通し番号が前回の判定時より小さい
+)
+
+// 不整合の直し方
+const (
+	GCFixDelete   = "delete"    // キーを削除する
+	GCFixExpire   = "expire"    // 有効期限を設定する
+	GCFixDisable  = "disable"   // 待合室を無効にし、番号を削除する
+	GCFixSyncLast = "sync_last" // 前回の通し番号を現在の通し番号に合わせる
+)
+
+const gcLockKey = "gc_lock"
+
+const gcScanCount = 1000
+
+// 見つかった不整合と直し方
+type Inconsistency struct {
+	Key    string `json:"key"`
+	Queue  string `json:"queue,omitempty"`
+	Kind   string `json:"kind"`
+	Fix    string `json:"fix"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// 稼働中のインスタンスが書き込んでいても壊さないよう、直す直前に不整合が残っているかを確かめる
+var gcFixScript = redis.NewScript(`
+local fix = ARGV[1]
+if fix == 'delete' then
+  if redis.call('PTTL', KEYS[1]) == -1 then
+    return redis.call('DEL', KEYS[1])
+  end
+elseif fix == 'expire' then
+  if redis.call('PTTL', KEYS[1]) == -1 then
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  end
+elseif fix == 'disable' then
+  if redis.call('EXISTS', KEYS[2]) == 0 and redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+    redis.call('ZREM', KEYS[1], ARGV[2])
+    redis.call('DEL', KEYS[3], KEYS[4], KEYS[5])
+    return 1
+  end
+elseif fix == 'sync_last' then
+  local cur = redis.call('GET', KEYS[1])
+  local last = redis.call('GET', KEYS[2])
+  if cur and last and tonumber(cur) < tonumber(last) then
+    local ttl = redis.call('PTTL', KEYS[2])
+    if ttl > 0 then
+      redis.call('SET', KEYS[2], cur, 'PX', ttl)
+    else
+      redis.call('SET', KEYS[2], cur)
+    end
+    return 1
+  end
+end
+return 0
+`)
+
+// 停止や有効期限切れで取り残されたキーを探して片付ける
+type GarbageCollector struct {
+	redisC *redis.Client
+	keys   *Keyspace
+}
+
+func NewGarbageCollector(redisC *redis.Client, keys *Keyspace) *GarbageCollector {
+	return &GarbageCollector{
+		redisC: redisC,
+		keys:   keys,
+	}
+}
+
+// 複数のインスタンスが同時に片付けないよう、ttlの間だけ取れるロックを取る
+func (g *GarbageCollector) TryLock(ctx context.Context, ttl time.Duration) (bool, error) {
+	return g.redisC.SetNX(ctx, g.keys.Global(gcLockKey), "1", ttl).Result()
+}
+
+// キーを走査して不整合を列挙する
+func (g *GarbageCollector) Scan(ctx context.Context) ([]Inconsistency, error) {
+	queuePrefix := strings.TrimSuffix(g.keys.Queue("", ""), ":")
+	permitPrefix := g.keys.Permit("")
+	throttlePrefix := g.keys.Global(throttleKeyPrefix) + ":"
+
+	// 有効期限を持つべきキーと、待合室ごとにあるキー
+	volatile := map[string]string{}
+	queues := map[string]map[string]bool{}
+	iter := g.redisC.Scan(ctx, 0, g.keys.Prefix+":*", gcScanCount).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		switch {
+		case strings.HasPrefix(key, queuePrefix):
+			i := strings.LastIndex(key, ":")
+			queue, name := key[len(queuePrefix):i], key[i+1:]
+			if queue == "" {
+				continue
+			}
+			switch name {
+			case keyPermittedNoLock, keyPermittedNo, keyCurrentNo, keyLastNo, keyPermitUnit:
+				volatile[key] = queue
+			default:
+				continue
+			}
+			if queues[queue] == nil {
+				queues[queue] = map[string]bool{}
+			}
+			queues[queue][name] = true
+		case strings.HasPrefix(key, permitPrefix), strings.HasPrefix(key, throttlePrefix):
+			volatile[key] = ""
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	enabled, err := g.redisC.ZRange(ctx, g.keys.Global(enableDomainKey), 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	isEnabled := map[string]bool{}
+	for _, m := range enabled {
+		isEnabled[m] = true
+	}
+
+	ret := []Inconsistency{}
+	persistent, err := g.persistentKeys(ctx, volatile)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range persistent {
+		queue := volatile[key]
+		switch {
+		case strings.HasSuffix(key, ":"+keyPermittedNoLock):
+			ret = append(ret, Inconsistency{Key: key, Queue: queue, Kind: GCLockWithoutTTL, Fix: GCFixDelete})
+		case queue != "" && isEnabled[queue]:
+			// 有効な待合室の番号は消さず、判定が止まれば消えるようにする
+			ret = append(ret, Inconsistency{Key: key, Queue: queue, Kind: GCKeyWithoutTTL, Fix: GCFixExpire})
+		default:
+			ret = append(ret, Inconsistency{Key: key, Queue: queue, Kind: GCKeyWithoutTTL, Fix: GCFixDelete})
+		}
+	}
+
+	for _, m := range enabled {
+		if !queues[m][keyPermittedNo] {
+			ret = append(ret, Inconsistency{Key: g.keys.Global(enableDomainKey), Queue: m, Kind: GCMissingPermittedNo, Fix: GCFixDisable})
+		}
+	}
+
+	behind, err := g.currentBehindLast(ctx, queues)
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, behind...), nil
+}
+
+// 有効期限を持たないキーを返す
+func (g *GarbageCollector) persistentKeys(ctx context.Context, keys map[string]string) ([]string, error) {
+	all := make([]string, 0, len(keys))
+	for k := range keys {
+		all = append(all, k)
+	}
+	ret := []string{}
+	for len(all) > 0 {
+		n := min(len(all), gcScanCount)
+		pipe := g.redisC.Pipeline()
+		cmds := make([]*redis.DurationCmd, n)
+		for i, k := range all[:n] {
+			cmds[i] = pipe.PTTL(ctx, k)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			// 走査の後に消えたキーは-2になる
+			if cmd.Val() == -1 {
+				ret = append(ret, all[i])
+			}
+		}
+		all = all[n:]
+	}
+	return ret, nil
+}
+
+// 通し番号と前回の判定時の通し番号の両方がある待合室のうち、通し番号が小さいものを返す
+// 前回の判定時より通し番号が増えていないことを判定できず、待合室が解除されなくなる
+func (g *GarbageCollector) currentBehindLast(ctx context.Context, queues map[string]map[string]bool) ([]Inconsistency, error) {
+	targets := []string{}
+	for queue, names := range queues {
+		if names[keyCurrentNo] && names[keyLastNo] {
+			targets = append(targets, queue)
+		}
+	}
+	ret := []Inconsistency{}
+	for len(targets) > 0 {
+		n := min(len(targets), gcScanCount)
+		pipe := g.redisC.Pipeline()
+		cmds := make([]*redis.SliceCmd, n)
+		for i, queue := range targets[:n] {
+			cmds[i] = pipe.MGet(ctx, g.keys.Queue(queue, keyCurrentNo), g.keys.Queue(queue, keyLastNo))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			v := cmd.Val()
+			if len(v) != 2 || v[0] == nil || v[1] == nil {
+				continue
+			}
+			cur, err := strconv.ParseInt(v[0].(string), 10, 64)
+			if err != nil {
+				continue
+			}
+			last, err := strconv.ParseInt(v[1].(string), 10, 64)
+			if err != nil {
+				continue
+			}
+			if cur < last {
+				queue := targets[i]
+				ret = append(ret, Inconsistency{
+					Key:    g.keys.Queue(queue, keyLastNo),
+					Queue:  queue,
+					Kind:   GCCurrentBehindLastNo,
+					Fix:    GCFixSyncLast,
+					Detail: "current=" + v[0].(string) + " last=" + v[1].(string),
+				})
+			}
+		}
+		targets = targets[n:]
+	}
+	return ret, nil
+}
+
+// 不整合を直し、直した数を返す。走査の後に解消していたものは何もしない
+// ttlは有効期限を失った番号に設定する有効期限
+func (g *GarbageCollector) Fix(ctx context.Context, list []Inconsistency, ttl time.Duration) (int, error) {
+	fixed := 0
+	for _, in := range list {
+		var keys []string
+		var args []interface{}
+		switch in.Fix {
+		case GCFixDelete:
+			keys, args = []string{in.Key}, []interface{}{in.Fix}
+		case GCFixExpire:
+			keys, args = []string{in.Key}, []interface{}{in.Fix, ttl.Milliseconds()}
+		case GCFixDisable:
+			keys = []string{
+				g.keys.Global(enableDomainKey),
+				g.keys.Queue(in.Queue, keyPermittedNo),
+				g.keys.Queue(in.Queue, keyCurrentNo),
+				g.keys.Queue(in.Queue, keyLastNo),
+				g.keys.Queue(in.Queue, keyPermitUnit),
+			}
+			args = []interface{}{in.Fix, in.Queue}
+		case GCFixSyncLast:
+			keys = []string{g.keys.Queue(in.Queue, keyCurrentNo), g.keys.Queue(in.Queue, keyLastNo)}
+			args = []interface{}{in.Fix}
+		default:
+			continue
+		}
+		n, err := gcFixScript.Run(ctx, g.redisC, keys, args...).Int64()
+		if err != nil {
+			return fixed, err
+		}
+		if n > 0 {
+			fixed++
+		}
+	}
+	return fixed, nil
+}
@@ -0,0 +1,98 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGarbageCollector(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	k := repository.NewKeyspace("test-" + testutils.TestRandomString(10))
+	defer func() {
+		keys, _ := redisClient.Keys(ctx, k.Prefix+":*").Result()
+		redisClient.Del(ctx, keys...)
+	}()
+
+	// 正常な待合室
+	redisClient.ZAdd(ctx, k.Global("domains"), &redis.Z{Score: 1, Member: "ok.example.com"})
+	redisClient.Set(ctx, k.Queue("ok.example.com", "permitted_no"), 10, time.Minute)
+	redisClient.Set(ctx, k.Queue("ok.example.com", "current_no"), 20, time.Minute)
+	redisClient.Set(ctx, k.Queue("ok.example.com", "last_no"), 15, time.Minute)
+	redisClient.Set(ctx, k.Queue("ok.example.com", "permitted_no_lock"), 1, time.Minute)
+	redisClient.HSet(ctx, k.Queue("ok.example.com", "limit"), "issued", 20)
+
+	// 停止で取り残されたロック
+	redisClient.Set(ctx, k.Queue("lock.example.com:checkout", "permitted_no_lock"), 1, 0)
+	// 許可番号が期限切れになった待合室
+	redisClient.ZAdd(ctx, k.Global("domains"), &redis.Z{Score: 1, Member: "expired.example.com"})
+	redisClient.Set(ctx, k.Queue("expired.example.com", "current_no"), 5, time.Minute)
+	// 通し番号が前回の判定時より小さい待合室
+	redisClient.ZAdd(ctx, k.Global("domains"), &redis.Z{Score: 1, Member: "behind.example.com"})
+	redisClient.Set(ctx, k.Queue("behind.example.com", "permitted_no"), 10, time.Minute)
+	redisClient.Set(ctx, k.Queue("behind.example.com", "current_no"), 3, time.Minute)
+	redisClient.Set(ctx, k.Queue("behind.example.com", "last_no"), 8, time.Minute)
+	// 有効期限を持たない番号
+	redisClient.ZAdd(ctx, k.Global("domains"), &redis.Z{Score: 1, Member: "persist.example.com"})
+	redisClient.Set(ctx, k.Queue("persist.example.com", "permitted_no"), 10, 0)
+	redisClient.Set(ctx, k.Queue("orphan.example.com", "current_no"), 10, 0)
+	redisClient.Set(ctx, k.Permit("client"), "1", 0)
+
+	gc := repository.NewGarbageCollector(redisClient, k)
+	list, err := gc.Scan(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []repository.Inconsistency{
+		{Key: k.Queue("lock.example.com:checkout", "permitted_no_lock"), Queue: "lock.example.com:checkout", Kind: repository.GCLockWithoutTTL, Fix: repository.GCFixDelete},
+		{Key: k.Global("domains"), Queue: "expired.example.com", Kind: repository.GCMissingPermittedNo, Fix: repository.GCFixDisable},
+		{Key: k.Queue("behind.example.com", "last_no"), Queue: "behind.example.com", Kind: repository.GCCurrentBehindLastNo, Fix: repository.GCFixSyncLast, Detail: "current=3 last=8"},
+		{Key: k.Queue("persist.example.com", "permitted_no"), Queue: "persist.example.com", Kind: repository.GCKeyWithoutTTL, Fix: repository.GCFixExpire},
+		{Key: k.Queue("orphan.example.com", "current_no"), Queue: "orphan.example.com", Kind: repository.GCKeyWithoutTTL, Fix: repository.GCFixDelete},
+		{Key: k.Permit("client"), Kind: repository.GCKeyWithoutTTL, Fix: repository.GCFixDelete},
+	}, list)
+
+	// 走査の後に待合室が作り直されていれば無効にしない
+	redisClient.Set(ctx, k.Queue("expired.example.com", "permitted_no"), 0, time.Minute)
+	fixed, err := gc.Fix(ctx, list, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, len(list)-1, fixed)
+
+	n, err := redisClient.Exists(ctx,
+		k.Queue("lock.example.com:checkout", "permitted_no_lock"),
+		k.Queue("orphan.example.com", "current_no"),
+		k.Permit("client"),
+	).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.Equal(t, "3", redisClient.Get(ctx, k.Queue("behind.example.com", "last_no")).Val())
+	assert.Greater(t, redisClient.TTL(ctx, k.Queue("behind.example.com", "last_no")).Val(), time.Duration(0))
+	assert.Greater(t, redisClient.TTL(ctx, k.Queue("persist.example.com", "permitted_no")).Val(), time.Duration(0))
+	_, err = redisClient.ZScore(ctx, k.Global("domains"), "expired.example.com").Result()
+	assert.NoError(t, err)
+
+	list, err = gc.Scan(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	// 期限切れになったので無効にする
+	redisClient.Del(ctx, k.Queue("expired.example.com", "permitted_no"))
+	list, err = gc.Scan(ctx)
+	assert.NoError(t, err)
+	fixed, err = gc.Fix(ctx, list, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fixed)
+	assert.Equal(t, redis.Nil, redisClient.ZScore(ctx, k.Global("domains"), "expired.example.com").Err())
+	assert.Equal(t, int64(0), redisClient.Exists(ctx, k.Queue("expired.example.com", "current_no")).Val())
+
+	ok, err := gc.TryLock(ctx, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = gc.TryLock(ctx, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
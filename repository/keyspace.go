@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redisのキーの配置の版。配置を変えたら上げ、migrateで移行できるようにする
+// 1は接頭辞を持たない以前の配置
+const SchemaVersion = 2
+
+const DefaultKeyPrefix = "waitingroom"
+
+const schemaVersionKey = "schema_version"
+
+var ErrSchemaTooNew = errors.New("redis schema is newer than this version supports")
+
+// 待合室が使うRedisのキーとチャンネルの名前を決める
+type Keyspace struct {
+	Prefix  string
+	Version int
+}
+
+func NewKeyspace(prefix string) *Keyspace {
+	return &Keyspace{Prefix: prefix, Version: SchemaVersion}
+}
+
+// 接頭辞を持たない以前の配置
+var LegacyKeyspace = &Keyspace{Version: 1}
+
+var currentKeyspace atomic.Pointer[Keyspace]
+
+func init() {
+	currentKeyspace.Store(NewKeyspace(DefaultKeyPrefix))
+}
+
+// 以降に作るリポジトリが使うキーの接頭辞を設定する
+// 同じRedisを他の用途と共有する場合や、複数の待合室を同居させる場合に変更する
+func SetKeyPrefix(prefix string) error {
+	if prefix == "" || strings.ContainsAny(prefix, " :*?[]") {
+		return fmt.Errorf("invalid key prefix: %q", prefix)
+	}
+	currentKeyspace.Store(NewKeyspace(prefix))
+	return nil
+}
+
+// 現在の配置を返す
+func Keys() *Keyspace {
+	return currentKeyspace.Load()
+}
+
+// ドメインによらないキー。以前の配置ではqueue-を付けていた
+func (k *Keyspace) Global(name string) string {
+	if k.Version < 2 {
+		return "queue-" + name
+	}
+	return k.Prefix + ":" + name
+}
+
+// 待合室ごとのキー。以前の配置では待合室のキーに_で名前を付けていた
+func (k *Keyspace) Queue(queue, name string) string {
+	if k.Version < 2 {
+		return queue + "_" + name
+	}
+	return k.Prefix + ":queue:" + queue + ":" + name
+}
+
+// 許可済みのクライアントのキー。以前の配置ではクライアントのキーをそのまま使っていた
+func (k *Keyspace) Permit(id string) string {
+	if k.Version < 2 {
+		return id
+	}
+	return k.Prefix + ":permit:" + id
+}
+
+// 配置の版を保存するキー。以前の配置には存在しない
+func (k *Keyspace) SchemaVersionKey() string {
+	return k.Prefix + ":" + schemaVersionKey
+}
+
+// 保存された配置の版を返す。保存されていなければ0を返す
+func GetSchemaVersion(ctx context.Context, redisC *redis.Client, k *Keyspace) (int, error) {
+	v, err := redisC.Get(ctx, k.SchemaVersionKey()).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return v, nil
+}
+
+func SaveSchemaVersion(ctx context.Context, redisC *redis.Client, k *Keyspace) error {
+	return redisC.Set(ctx, k.SchemaVersionKey(), k.Version, 0).Err()
+}
+
+// 以前の配置のキーが残っているかを返す
+func HasLegacyKeys(ctx context.Context, redisC *redis.Client) (bool, error) {
+	n, err := redisC.Exists(ctx,
+		LegacyKeyspace.Global(enableDomainKey),
+		LegacyKeyspace.Global(whiteListKey),
+		LegacyKeyspace.Global(settingKey),
+		LegacyKeyspace.Global(maintenanceKey),
+		LegacyKeyspace.Global(routeKey),
+		LegacyKeyspace.Global(groupKey),
+		LegacyKeyspace.Global(ipRuleKey),
+		LegacyKeyspace.Global(pageKey),
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// 起動時に配置の版を確認する
+// 空のRedisには現在の版を保存し、以前の配置のデータが残っていれば移行が必要であることを返す
+func CheckSchema(ctx context.Context, redisC *redis.Client, k *Keyspace) (bool, error) {
+	v, err := GetSchemaVersion(ctx, redisC, k)
+	if err != nil {
+		return false, err
+	}
+	if v > k.Version {
+		return false, fmt.Errorf("%w: %d", ErrSchemaTooNew, v)
+	}
+	if v == k.Version {
+		return false, nil
+	}
+
+	legacy, err := HasLegacyKeys(ctx, redisC)
+	if err != nil {
+		return false, err
+	}
+	if legacy {
+		return true, nil
+	}
+	return false, SaveSchemaVersion(ctx, redisC, k)
+}
@@ -0,0 +1,172 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/pyama86/waitingroom/repository"
+	"github.com/pyama86/waitingroom/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyspace(t *testing.T) {
+	k := repository.NewKeyspace("wr")
+	assert.Equal(t, "wr:domains", k.Global("domains"))
+	assert.Equal(t, "wr:queue:example.com:checkout:current_no", k.Queue("example.com:checkout", "current_no"))
+	assert.Equal(t, "wr:permit:id", k.Permit("id"))
+	assert.Equal(t, "wr:schema_version", k.SchemaVersionKey())
+
+	l := repository.LegacyKeyspace
+	assert.Equal(t, "queue-domains", l.Global("domains"))
+	assert.Equal(t, "example.com:checkout_current_no", l.Queue("example.com:checkout", "current_no"))
+	assert.Equal(t, "id", l.Permit("id"))
+
+	for _, prefix := range []string{"", "a:b", "a b", "a*"} {
+		assert.Error(t, repository.SetKeyPrefix(prefix), prefix)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	to := repository.NewKeyspace("test-" + testutils.TestRandomString(10))
+	from := repository.LegacyKeyspace
+	domain := strings.ToLower(testutils.TestRandomString(10)) + ".example.com"
+	id := uuid.NewString()
+	route := domain + ":checkout"
+	lock := from.Queue(domain, "permitted_no_lock")
+	other := "other-" + testutils.TestRandomString(10)
+	// 同じDBを使う他のアプリケーションのキーは、以前の配置に似た名前でも移さない
+	foreign := []string{
+		"session_" + uuid.NewString(),
+		uuid.NewString(),
+		strings.ToLower(testutils.TestRandomString(10)) + ".example.com_current_no",
+	}
+
+	// 以前のバージョンのインスタンスが書き込んだ値
+	redisClient.Set(ctx, from.Queue(domain, "current_no"), 5, time.Minute)
+	redisClient.Set(ctx, from.Queue(domain, "permitted_no"), 3, time.Minute)
+	redisClient.Set(ctx, from.Queue(route, "permitted_no"), 8, time.Hour)
+	redisClient.HSet(ctx, from.Queue(domain, "limit"), "max_serial_no", 10, "issued", 4, "closed", 0)
+	redisClient.Set(ctx, from.Permit(route+"_"+id), "1", time.Minute)
+	redisClient.HSet(ctx, from.Global("maintenances"), domain, `{"message":"legacy"}`, domain+".old", `{"message":"old"}`)
+	redisClient.Set(ctx, lock, 1, time.Minute)
+	redisClient.Set(ctx, other, 1, time.Minute)
+	for _, k := range foreign {
+		redisClient.Set(ctx, k, 1, time.Minute)
+	}
+	redisClient.ZAdd(ctx, from.Global("domains"), &redis.Z{Score: 1, Member: domain}, &redis.Z{Score: 1, Member: route})
+	defer redisClient.Del(ctx, append(foreign, lock, other)...)
+	defer redisClient.ZRem(ctx, from.Global("domains"), domain, route)
+	defer redisClient.HDel(ctx, from.Global("maintenances"), domain, domain+".old")
+
+	// 移行前に現在のバージョンのインスタンスが書き込んだ値
+	redisClient.Set(ctx, to.Queue(domain, "current_no"), 7, 10*time.Second)
+	redisClient.HSet(ctx, to.Queue(domain, "limit"), "max_serial_no", 20, "issued", 2)
+	redisClient.HSet(ctx, to.Global("maintenances"), domain, `{"message":"current"}`)
+
+	m := repository.NewMigrator(redisClient, to)
+	plan, err := m.Plan(ctx)
+	assert.NoError(t, err)
+
+	mine := []repository.Migration{}
+	for _, mg := range plan {
+		assert.NotEqual(t, lock, mg.From)
+		assert.NotEqual(t, other, mg.From)
+		assert.NotContains(t, foreign, mg.From)
+		assert.False(t, strings.HasPrefix(mg.From, to.Prefix))
+		if strings.Contains(mg.From, domain) || mg.From == from.Global("maintenances") {
+			mine = append(mine, mg)
+		}
+	}
+	assert.ElementsMatch(t, []repository.Migration{
+		{From: from.Queue(domain, "current_no"), To: to.Queue(domain, "current_no"), Method: repository.MigrateMax},
+		{From: from.Queue(domain, "permitted_no"), To: to.Queue(domain, "permitted_no"), Method: repository.MigrateMax},
+		{From: from.Queue(route, "permitted_no"), To: to.Queue(route, "permitted_no"), Method: repository.MigrateMax},
+		{From: from.Queue(domain, "limit"), To: to.Queue(domain, "limit"), Method: repository.MigrateLimit},
+		{From: route + "_" + id, To: to.Permit(route + "_" + id), Method: repository.MigrateMerge},
+		{From: from.Global("maintenances"), To: to.Global("maintenances"), Method: repository.MigrateMerge},
+	}, mine)
+
+	// 何度実行しても結果は変わらない
+	assert.NoError(t, m.Apply(ctx, mine, false))
+	assert.NoError(t, m.Apply(ctx, mine, true))
+
+	assert.Equal(t, "7", redisClient.Get(ctx, to.Queue(domain, "current_no")).Val())
+	assert.Greater(t, redisClient.TTL(ctx, to.Queue(domain, "current_no")).Val(), 10*time.Second)
+	assert.Equal(t, "3", redisClient.Get(ctx, to.Queue(domain, "permitted_no")).Val())
+	assert.Greater(t, redisClient.TTL(ctx, to.Queue(route, "permitted_no")).Val(), time.Minute)
+	assert.Equal(t, map[string]string{"max_serial_no": "20", "issued": "4", "closed": "0"}, redisClient.HGetAll(ctx, to.Queue(domain, "limit")).Val())
+	assert.Equal(t, "1", redisClient.Get(ctx, to.Permit(route+"_"+id)).Val())
+	assert.Equal(t, `{"message":"current"}`, redisClient.HGet(ctx, to.Global("maintenances"), domain).Val())
+	assert.Equal(t, `{"message":"old"}`, redisClient.HGet(ctx, to.Global("maintenances"), domain+".old").Val())
+
+	// 移行元は削除する
+	n, err := redisClient.Exists(ctx, from.Queue(domain, "current_no"), from.Queue(domain, "limit"), route+"_"+id).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	version, err := repository.GetSchemaVersion(ctx, redisClient, to)
+	assert.NoError(t, err)
+	assert.Equal(t, repository.SchemaVersion, version)
+
+	keys, _ := redisClient.Keys(ctx, to.Prefix+":*").Result()
+	redisClient.Del(ctx, keys...)
+}
+
+func TestMigrator_setting(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	to := repository.NewKeyspace("test-" + testutils.TestRandomString(10))
+	from := repository.LegacyKeyspace
+	defer redisClient.Del(ctx, to.Global("settings"), to.SchemaVersionKey())
+
+	legacy, _ := redisClient.HGetAll(ctx, from.Global("settings")).Result()
+	defer func() {
+		redisClient.Del(ctx, from.Global("settings"))
+		if len(legacy) > 0 {
+			redisClient.HSet(ctx, from.Global("settings"), legacy)
+		}
+	}()
+
+	redisClient.Del(ctx, from.Global("settings"))
+	redisClient.HSet(ctx, from.Global("settings"), "version", 3, "value", "legacy")
+	redisClient.HSet(ctx, to.Global("settings"), "version", 1, "value", "current")
+
+	m := repository.NewMigrator(redisClient, to)
+	mg := repository.Migration{From: from.Global("settings"), To: to.Global("settings"), Method: repository.MigrateSetting}
+	assert.NoError(t, m.Apply(ctx, []repository.Migration{mg}, false))
+	assert.Equal(t, "legacy", redisClient.HGet(ctx, to.Global("settings"), "value").Val())
+
+	// 移行先のほうが新しければ上書きしない
+	redisClient.HSet(ctx, to.Global("settings"), "version", 4, "value", "current")
+	assert.NoError(t, m.Apply(ctx, []repository.Migration{mg}, false))
+	assert.Equal(t, "current", redisClient.HGet(ctx, to.Global("settings"), "value").Val())
+}
+
+func TestCheckSchema(t *testing.T) {
+	ctx := context.Background()
+	redisClient := testutils.TestRedisClient()
+	k := repository.NewKeyspace("test-" + testutils.TestRandomString(10))
+	defer redisClient.Del(ctx, k.SchemaVersionKey())
+
+	legacy, err := repository.HasLegacyKeys(ctx, redisClient)
+	assert.NoError(t, err)
+	required, err := repository.CheckSchema(ctx, redisClient, k)
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, required)
+
+	assert.NoError(t, repository.SaveSchemaVersion(ctx, redisClient, k))
+	required, err = repository.CheckSchema(ctx, redisClient, k)
+	assert.NoError(t, err)
+	assert.False(t, required)
+
+	redisClient.Set(ctx, k.SchemaVersionKey(), repository.SchemaVersion+1, 0)
+	_, err = repository.CheckSchema(ctx, redisClient, k)
+	assert.True(t, errors.Is(err, repository.ErrSchemaTooNew))
+}
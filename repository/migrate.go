@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// キーの移行方法
+const (
+	MigrateMax     = "max"     // 大きいほうの値を残す。通し番号や許可番号は増える一方のため
+	MigrateLimit   = "limit"   // 発行済みの数は大きいほう、それ以外のフィールドは移行先を優先する
+	MigrateMerge   = "merge"   // 移行先にない値、フィールド、メンバーだけを追加する
+	MigrateSetting = "setting" // 版の大きいほうを残す
+)
+
+// 以前の配置のキーと、移行先のキー
+type Migration struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Method string `json:"method"`
+}
+
+// 移行元と移行先を1つずつまとめ、稼働中のインスタンスが書き込んでいても値を失わないように移す
+// 移行先が先に作られていれば、移行方法に従って統合する。何度実行しても結果は変わらない
+// 有効期限は長いほうに合わせ、どちらかが無期限なら無期限にする
+var migrateKeyScript = redis.NewScript(`
+local t = redis.call('TYPE', KEYS[1])['ok']
+if t == 'none' then
+  return 0
+end
+local src_ttl = redis.call('PTTL', KEYS[1])
+local dst_ttl = redis.call('PTTL', KEYS[2])
+local method = ARGV[1]
+if t == 'string' then
+  local v = redis.call('GET', KEYS[1])
+  local cur = redis.call('GET', KEYS[2])
+  if not cur or (method == 'max' and tonumber(v) > tonumber(cur)) then
+    redis.call('SET', KEYS[2], v)
+  end
+elseif t == 'hash' then
+  local src = redis.call('HGETALL', KEYS[1])
+  if method == 'setting' then
+    local v = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+    local cur = tonumber(redis.call('HGET', KEYS[2], 'version') or '-1')
+    if v > cur then
+      redis.call('DEL', KEYS[2])
+      for i = 1, #src, 2 do
+        redis.call('HSET', KEYS[2], src[i], src[i + 1])
+      end
+    end
+  else
+    for i = 1, #src, 2 do
+      if method == 'limit' and src[i] == 'issued' then
+        local cur = tonumber(redis.call('HGET', KEYS[2], 'issued') or '0')
+        if tonumber(src[i + 1]) > cur then
+          redis.call('HSET', KEYS[2], src[i], src[i + 1])
+        end
+      else
+        redis.call('HSETNX', KEYS[2], src[i], src[i + 1])
+      end
+    end
+  end
+elseif t == 'zset' then
+  local src = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+  for i = 1, #src, 2 do
+    if not redis.call('ZSCORE', KEYS[2], src[i]) then
+      redis.call('ZADD', KEYS[2], src[i + 1], src[i])
+    end
+  end
+else
+  return redis.error_reply('unsupported type ' .. t .. ': ' .. KEYS[1])
+end
+if src_ttl == -1 or dst_ttl == -1 then
+  redis.call('PERSIST', KEYS[2])
+elseif src_ttl > dst_ttl then
+  redis.call('PEXPIRE', KEYS[2], src_ttl)
+else
+  redis.call('PEXPIRE', KEYS[2], dst_ttl)
+end
+if ARGV[2] == '1' then
+  redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+const migrateScanCount = 1000
+
+// 以前の配置から現在の配置へキーを移行する
+type Migrator struct {
+	redisC *redis.Client
+	from   *Keyspace
+	to     *Keyspace
+}
+
+func NewMigrator(redisC *redis.Client, to *Keyspace) *Migrator {
+	return &Migrator{
+		redisC: redisC,
+		from:   LegacyKeyspace,
+		to:     to,
+	}
+}
+
+// 移行が必要なキーを列挙する
+// 以前の配置は接頭辞を持たないため、同じDBにある他のアプリケーションのキーを移さないよう
+// ドメインによらない値はqueue-で始まる名前に、待合室ごとの値と許可済みのクライアントは
+// 以前の配置で有効な待合室またはホワイトリストにある待合室のものに限る
+func (m *Migrator) Plan(ctx context.Context) ([]Migration, error) {
+	queues, err := m.legacyQueues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Migration{}
+	iter := m.redisC.Scan(ctx, 0, "*", migrateScanCount).Iterator()
+	for iter.Next(ctx) {
+		if mg := m.classify(iter.Val(), queues); mg != nil {
+			ret = append(ret, *mg)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// 以前の配置で有効な待合室とホワイトリストにある待合室を返す
+func (m *Migrator) legacyQueues(ctx context.Context) (map[string]bool, error) {
+	ret := map[string]bool{}
+	for _, name := range []string{enableDomainKey, whiteListKey} {
+		members, err := m.redisC.ZRange(ctx, m.from.Global(name), 0, -1).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, q := range members {
+			ret[q] = true
+		}
+	}
+	return ret, nil
+}
+
+var legacyGlobalKeys = map[string]string{
+	enableDomainKey:  MigrateMerge,
+	whiteListKey:     MigrateMerge,
+	whiteListMetaKey: MigrateMerge,
+	maintenanceKey:   MigrateMerge,
+	routeKey:         MigrateMerge,
+	groupKey:         MigrateMerge,
+	groupDomainKey:   MigrateMerge,
+	ipRuleKey:        MigrateMerge,
+	pageKey:          MigrateMerge,
+	instanceKey:      MigrateMerge,
+	settingKey:       MigrateSetting,
+}
+
+var legacyQueueKeys = map[string]string{
+	keyPermittedNo: MigrateMax,
+	keyCurrentNo:   MigrateMax,
+	keyLastNo:      MigrateMax,
+	keyLimit:       MigrateLimit,
+}
+
+func (m *Migrator) classify(key string, queues map[string]bool) *Migration {
+	if m.to.Prefix != "" && strings.HasPrefix(key, m.to.Prefix+":") {
+		return nil
+	}
+
+	if name, ok := strings.CutPrefix(key, m.from.Global("")); ok {
+		if method, ok := legacyGlobalKeys[name]; ok {
+			return &Migration{From: key, To: m.to.Global(name), Method: method}
+		}
+		if rest, ok := strings.CutPrefix(name, throttleKeyPrefix+":"); ok {
+			return &Migration{From: key, To: m.to.Global(throttleKeyPrefix) + ":" + rest, Method: MigrateMerge}
+		}
+		return nil
+	}
+
+	// 待合室のキーと_でつないだ値の名前、または許可済みのクライアントのIDだけを対象にする
+	// 許可番号のロックは短い有効期限を持つため、移行しない
+	for name, method := range legacyQueueKeys {
+		if queue, ok := strings.CutSuffix(key, "_"+name); ok && queues[queue] {
+			return &Migration{From: key, To: m.to.Queue(queue, name), Method: method}
+		}
+	}
+	// IDだけをキーにした待合室の許可は移さない
+	// 許可番号以下の通し番号を持つクライアントは、次の要求で許可し直される
+	if i := len(key) - 37; i > 0 && key[i] == '_' && queues[key[:i]] {
+		if _, err := uuid.Parse(key[i+1:]); err == nil {
+			return &Migration{From: key, To: m.to.Permit(key), Method: MigrateMerge}
+		}
+	}
+	return nil
+}
+
+// キーを移行し、現在の配置の版を保存する
+// deleteSourceなら移行元を削除する。以前のバージョンのインスタンスが残っている間は削除しない
+func (m *Migrator) Apply(ctx context.Context, migrations []Migration, deleteSource bool) error {
+	del := "0"
+	if deleteSource {
+		del = "1"
+	}
+	for _, mg := range migrations {
+		if err := migrateKeyScript.Run(ctx, m.redisC, []string{mg.From, mg.To}, mg.Method, del).Err(); err != nil {
+			return err
+		}
+	}
+	return SaveSchemaVersion(ctx, m.redisC, m.to)
+}
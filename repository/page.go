@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const pageKey = "pages"
+
+type PageRepositoryer interface {
+	GetPage(context.Context, string) (string, error)
+	GetPages(context.Context) (map[string]string, error)
+	SavePage(context.Context, string, string) error
+	DeletePage(context.Context, string) error
+}
+
+type PageRepository struct {
+	redisC *redis.Client
+	keys   *Keyspace
+}
+
+func NewPageRepository(redisC *redis.Client) *PageRepository {
+	return &PageRepository{
+		redisC: redisC,
+		keys:   Keys(),
+	}
+}
+
+func (p *PageRepository) GetPage(ctx context.Context, domain string) (string, error) {
+	v, err := p.redisC.HGet(ctx, p.keys.Global(pageKey), domain).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+func (p *PageRepository) GetPages(ctx context.Context) (map[string]string, error) {
+	return p.redisC.HGetAll(ctx, p.keys.Global(pageKey)).Result()
+}
+
+func (p *PageRepository) SavePage(ctx context.Context, domain string, page string) error {
+	return p.redisC.HSet(ctx, p.keys.Global(pageKey), domain, page).Err()
+}
+
+func (p *PageRepository) DeletePage(ctx context.Context, domain string) error {
+	return p.redisC.HDel(ctx, p.keys.Global(pageKey), domain).Err()
+}
@@ -0,0 +1,99 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository/page.go
+//
+// Generated by this command:
+//
+//	mockgen -package=repository -source=./repository/page.go -destination=./repository/page_mock.go PageRepositoryer
+//
+
+// Package repository is a generated GoMock package.
+package repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPageRepositoryer is a mock of PageRepositoryer interface.
+type MockPageRepositoryer struct {
+	ctrl     *gomock.Controller
+	recorder *MockPageRepositoryerMockRecorder
+	isgomock struct{}
+}
+
+// MockPageRepositoryerMockRecorder is the mock recorder for MockPageRepositoryer.
+type MockPageRepositoryerMockRecorder struct {
+	mock *MockPageRepositoryer
+}
+
+// NewMockPageRepositoryer creates a new mock instance.
+func NewMockPageRepositoryer(ctrl *gomock.Controller) *MockPageRepositoryer {
+	mock := &MockPageRepositoryer{ctrl: ctrl}
+	mock.recorder = &MockPageRepositoryerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPageRepositoryer) EXPECT() *MockPageRepositoryerMockRecorder {
+	return m.recorder
+}
+
+// DeletePage mocks base method.
+func (m *MockPageRepositoryer) DeletePage(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePage", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePage indicates an expected call of DeletePage.
+func (mr *MockPageRepositoryerMockRecorder) DeletePage(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePage", reflect.TypeOf((*MockPageRepositoryer)(nil).DeletePage), arg0, arg1)
+}
+
+// GetPage mocks base method.
+func (m *MockPageRepositoryer) GetPage(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPage", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPage indicates an expected call of GetPage.
+func (mr *MockPageRepositoryerMockRecorder) GetPage(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPage", reflect.TypeOf((*MockPageRepositoryer)(nil).GetPage), arg0, arg1)
+}
+
+// GetPages mocks base method.
+func (m *MockPageRepositoryer) GetPages(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPages", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPages indicates an expected call of GetPages.
+func (mr *MockPageRepositoryerMockRecorder) GetPages(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPages", reflect.TypeOf((*MockPageRepositoryer)(nil).GetPages), arg0)
+}
+
+// SavePage mocks base method.
+func (m *MockPageRepositoryer) SavePage(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePage indicates an expected call of SavePage.
+func (mr *MockPageRepositoryerMockRecorder) SavePage(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePage", reflect.TypeOf((*MockPageRepositoryer)(nil).SavePage), arg0, arg1, arg2)
+}
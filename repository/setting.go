@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const settingKey = "settings"
+const settingChannel = "settings-changed"
+const instanceKey = "instances"
+
+var ErrSettingVersionConflict = errors.New("setting version conflict")
+
+// バージョンが一致する場合のみ更新し、変更を通知する
+var saveSettingScript = redis.NewScript(`
+local v = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if v ~= tonumber(ARGV[1]) then
+  return -1
+end
+v = v + 1
+redis.call('HSET', KEYS[1], 'version', v, 'value', ARGV[2])
+redis.call('PUBLISH', ARGV[3], v)
+return v
+`)
+
+type SettingRepositoryer interface {
+	GetSetting(context.Context) (string, int64, error)
+	SaveSetting(context.Context, string, int64) (int64, error)
+	SubscribeSetting(context.Context) *redis.PubSub
+	SaveInstance(context.Context, string, string) error
+	GetInstances(context.Context) (map[string]string, error)
+	DeleteInstance(context.Context, string) error
+}
+
+type SettingRepository struct {
+	redisC *redis.Client
+	keys   *Keyspace
+}
+
+func NewSettingRepository(redisC *redis.Client) *SettingRepository {
+	return &SettingRepository{
+		redisC: redisC,
+		keys:   Keys(),
+	}
+}
+
+func (s *SettingRepository) GetSetting(ctx context.Context) (string, int64, error) {
+	v, err := s.redisC.HMGet(ctx, s.keys.Global(settingKey), "value", "version").Result()
+	if err != nil {
+		return "", 0, err
+	}
+	value, _ := v[0].(string)
+	version := int64(0)
+	if vs, ok := v[1].(string); ok {
+		version, err = strconv.ParseInt(vs, 10, 64)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	return value, version, nil
+}
+
+// 更新後のバージョンを返す。現在のバージョンがversionと異なる場合はErrSettingVersionConflictを返す
+func (s *SettingRepository) SaveSetting(ctx context.Context, value string, version int64) (int64, error) {
+	v, err := saveSettingScript.Run(ctx, s.redisC, []string{s.keys.Global(settingKey)}, version, value, s.keys.Global(settingChannel)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, ErrSettingVersionConflict
+	}
+	return v, nil
+}
+
+func (s *SettingRepository) SubscribeSetting(ctx context.Context) *redis.PubSub {
+	return s.redisC.Subscribe(ctx, s.keys.Global(settingChannel))
+}
+
+func (s *SettingRepository) SaveInstance(ctx context.Context, id string, value string) error {
+	return s.redisC.HSet(ctx, s.keys.Global(instanceKey), id, value).Err()
+}
+
+func (s *SettingRepository) GetInstances(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(instanceKey)).Result()
+}
+
+func (s *SettingRepository) DeleteInstance(ctx context.Context, id string) error {
+	return s.redisC.HDel(ctx, s.keys.Global(instanceKey), id).Err()
+}
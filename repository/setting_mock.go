@@ -0,0 +1,130 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository/setting.go
+//
+// Generated by this command:
+//
+//	mockgen -package=repository -source=./repository/setting.go -destination=./repository/setting_mock.go SettingRepositoryer
+//
+
+// Package repository is a generated GoMock package.
+package repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	redis "github.com/go-redis/redis/v8"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockSettingRepositoryer is a mock of SettingRepositoryer interface.
+type MockSettingRepositoryer struct {
+	ctrl     *gomock.Controller
+	recorder *MockSettingRepositoryerMockRecorder
+	isgomock struct{}
+}
+
+// MockSettingRepositoryerMockRecorder is the mock recorder for MockSettingRepositoryer.
+type MockSettingRepositoryerMockRecorder struct {
+	mock *MockSettingRepositoryer
+}
+
+// NewMockSettingRepositoryer creates a new mock instance.
+func NewMockSettingRepositoryer(ctrl *gomock.Controller) *MockSettingRepositoryer {
+	mock := &MockSettingRepositoryer{ctrl: ctrl}
+	mock.recorder = &MockSettingRepositoryerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSettingRepositoryer) EXPECT() *MockSettingRepositoryerMockRecorder {
+	return m.recorder
+}
+
+// DeleteInstance mocks base method.
+func (m *MockSettingRepositoryer) DeleteInstance(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteInstance", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteInstance indicates an expected call of DeleteInstance.
+func (mr *MockSettingRepositoryerMockRecorder) DeleteInstance(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteInstance", reflect.TypeOf((*MockSettingRepositoryer)(nil).DeleteInstance), arg0, arg1)
+}
+
+// GetInstances mocks base method.
+func (m *MockSettingRepositoryer) GetInstances(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInstances", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInstances indicates an expected call of GetInstances.
+func (mr *MockSettingRepositoryerMockRecorder) GetInstances(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstances", reflect.TypeOf((*MockSettingRepositoryer)(nil).GetInstances), arg0)
+}
+
+// GetSetting mocks base method.
+func (m *MockSettingRepositoryer) GetSetting(arg0 context.Context) (string, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSetting", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSetting indicates an expected call of GetSetting.
+func (mr *MockSettingRepositoryerMockRecorder) GetSetting(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSetting", reflect.TypeOf((*MockSettingRepositoryer)(nil).GetSetting), arg0)
+}
+
+// SaveInstance mocks base method.
+func (m *MockSettingRepositoryer) SaveInstance(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveInstance", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveInstance indicates an expected call of SaveInstance.
+func (mr *MockSettingRepositoryerMockRecorder) SaveInstance(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveInstance", reflect.TypeOf((*MockSettingRepositoryer)(nil).SaveInstance), arg0, arg1, arg2)
+}
+
+// SaveSetting mocks base method.
+func (m *MockSettingRepositoryer) SaveSetting(arg0 context.Context, arg1 string, arg2 int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSetting", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveSetting indicates an expected call of SaveSetting.
+func (mr *MockSettingRepositoryerMockRecorder) SaveSetting(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSetting", reflect.TypeOf((*MockSettingRepositoryer)(nil).SaveSetting), arg0, arg1, arg2)
+}
+
+// SubscribeSetting mocks base method.
+func (m *MockSettingRepositoryer) SubscribeSetting(arg0 context.Context) *redis.PubSub {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeSetting", arg0)
+	ret0, _ := ret[0].(*redis.PubSub)
+	return ret0
+}
+
+// SubscribeSetting indicates an expected call of SubscribeSetting.
+func (mr *MockSettingRepositoryerMockRecorder) SubscribeSetting(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeSetting", reflect.TypeOf((*MockSettingRepositoryer)(nil).SubscribeSetting), arg0)
+}
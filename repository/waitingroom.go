@@ -2,22 +2,92 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-const suffixPermittedNo = "_permitted_no"
-const suffixCurrentNo = "_current_no"
-const suffixLastNo = "_last_no"
-const enableDomainKey = "queue-domains"
-const whiteListKey = "queue-whitelist"
+const keyPermittedNo = "permitted_no"
+const keyCurrentNo = "current_no"
+const keyLastNo = "last_no"
+const keyLimit = "limit"
+const keyPermitUnit = "permit_unit"
+const enableDomainKey = "domains"
+const whiteListKey = "whitelist"
+const whiteListMetaKey = "whitelist-meta"
+const maintenanceKey = "maintenances"
+const routeKey = "routes"
+const groupKey = "groups"
+const groupDomainKey = "group-domains"
+const ipRuleKey = "ip-rules"
+const throttleKeyPrefix = "throttle"
+const cacheChannel = "cache-invalidated"
+
+var ErrSoldOut = errors.New("sold out")
+
+// 受付終了、または発行数が上限に達していれば-1を返し、それ以外は通し番号を発行する
+// 発行数は待合室がリセットされても引き継ぐため、上限の設定と一緒に保持する
+var incrCurrentNumberScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], 'closed') == '1' then
+  return -1
+end
+local max = tonumber(redis.call('HGET', KEYS[2], 'max_serial_no') or '0')
+if max > 0 then
+  local issued = tonumber(redis.call('HGET', KEYS[2], 'issued') or '0')
+  if issued >= max then
+    return -1
+  end
+  redis.call('HINCRBY', KEYS[2], 'issued', 1)
+end
+local v = redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return v
+`)
+
+// グループの設定と、ドメインからグループを引くための対応を同時に書き換える
+// ドメインを渡さなければグループを削除する
+var saveGroupScript = redis.NewScript(`
+local members = redis.call('HGETALL', KEYS[2])
+for i = 1, #members, 2 do
+  if members[i + 1] == ARGV[1] then
+    redis.call('HDEL', KEYS[2], members[i])
+  end
+end
+if #ARGV == 2 then
+  redis.call('HDEL', KEYS[1], ARGV[1])
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+for i = 3, #ARGV do
+  redis.call('HSET', KEYS[2], ARGV[i], ARGV[1])
+end
+return 0
+`)
+
+// 窓の最初の1回で有効期限を設定し、窓の中での回数と窓が終わるまでのミリ秒を返す
+var incrThrottleScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+if v == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {v, ttl}
+`)
 
 type WaitingroomRepositoryer interface {
 	AppendPermitNumber(context.Context, string, int64, time.Duration) error
 	SaveLastNumber(context.Context, string, int64, time.Duration) error
-	PermitClient(context.Context, string, time.Duration) error
+	SavePermitUnit(context.Context, string, int64, time.Duration) error
+	PermitClient(context.Context, string, string, time.Duration) error
+	GetPermit(context.Context, string) (string, error)
+	IsPermitted(context.Context, string) (bool, error)
 	ExtendCurrentNumberTTL(context.Context, string, time.Duration) error
 	GetCurrentPermitNumber(context.Context, string) (int64, error)
 	GetCurrentPermitNumberTTL(context.Context, string) (time.Duration, error)
@@ -35,26 +105,57 @@ type WaitingroomRepositoryer interface {
 	SaveCurrentPermitNumber(context.Context, string, int64, time.Duration) error
 	GetWhiteListDomains(context.Context, int64, int64) ([]string, error)
 	GetWhiteListDomainsCount(context.Context) (int64, error)
-	AddWhiteListDomain(context.Context, string) error
-	RemoveWhiteListDomain(context.Context, string) error
+	AddWhiteListDomain(context.Context, string, string) error
+	RemoveWhiteListDomain(context.Context, string) (bool, error)
+	GetWhiteListMetas(context.Context) (map[string]string, error)
+	GetMaintenance(context.Context, string) (string, error)
+	GetMaintenances(context.Context) (map[string]string, error)
+	SaveMaintenance(context.Context, string, string) error
+	DeleteMaintenance(context.Context, string) (bool, error)
+	GetRoute(context.Context, string) (string, error)
+	GetRoutes(context.Context) (map[string]string, error)
+	SaveRoute(context.Context, string, string) error
+	DeleteRoute(context.Context, string) error
+	GetGroup(context.Context, string) (string, error)
+	GetGroupName(context.Context, string) (string, error)
+	GetGroups(context.Context) (map[string]string, error)
+	SaveGroup(context.Context, string, string, []string) error
+	DeleteGroup(context.Context, string) error
+	GetQueueLimit(context.Context, string) (int64, bool, int64, error)
+	SaveQueueLimit(context.Context, string, int64, bool) error
+	GetIPRules(context.Context) (map[string]string, error)
+	SaveIPRule(context.Context, string, string) error
+	DeleteIPRule(context.Context, string) error
+	IncrThrottle(context.Context, string, string, string, time.Duration) (int64, time.Duration, error)
+	GetDomainState(context.Context, string) (*DomainState, error)
+	GetQueueState(context.Context, string) (*QueueState, error)
+	PublishInvalidation(context.Context, string) error
+	SubscribeInvalidation(context.Context) *redis.PubSub
 }
 
 type WaitingroomRepository struct {
 	redisC *redis.Client
+	keys   *Keyspace
 }
 
 func NewWaitingroomRepository(redisC *redis.Client) *WaitingroomRepository {
 	return &WaitingroomRepository{
 		redisC: redisC,
+		keys:   Keys(),
 	}
 }
 
+// 待合室ごとのキーや許可のキーの配置
+func (s *WaitingroomRepository) Keyspace() *Keyspace {
+	return s.keys
+}
+
 func (s *WaitingroomRepository) permittedNumberKey(domain string) string {
-	return domain + suffixPermittedNo
+	return s.keys.Queue(domain, keyPermittedNo)
 }
 
 func (s *WaitingroomRepository) currentNumberKey(domain string) string {
-	return domain + suffixCurrentNo
+	return s.keys.Queue(domain, keyCurrentNo)
 }
 func (s *WaitingroomRepository) AppendPermitNumber(ctx context.Context, domain string, appendNum int64, ttl time.Duration) error {
 	pipe := s.redisC.Pipeline()
@@ -91,7 +192,7 @@ func (s *WaitingroomRepository) GetCurrentNumber(ctx context.Context, domain str
 }
 
 func (s *WaitingroomRepository) lastNumberKey(domain string) string {
-	return domain + suffixLastNo
+	return s.keys.Queue(domain, keyLastNo)
 }
 func (s *WaitingroomRepository) GetLastNumber(ctx context.Context, domain string) (int64, error) {
 	v, err := s.redisC.Get(ctx, s.lastNumberKey(domain)).Int64()
@@ -104,8 +205,34 @@ func (s *WaitingroomRepository) GetLastNumber(ctx context.Context, domain string
 func (s *WaitingroomRepository) SaveLastNumber(ctx context.Context, domain string, lastNum int64, ttl time.Duration) error {
 	return s.redisC.SetEX(ctx, s.lastNumberKey(domain), lastNum, ttl).Err()
 }
-func (s *WaitingroomRepository) PermitClient(ctx context.Context, clientID string, ttl time.Duration) error {
-	return s.redisC.SetEX(ctx, clientID, 1, ttl).Err()
+func (s *WaitingroomRepository) permitUnitKey(domain string) string {
+	return s.keys.Queue(domain, keyPermitUnit)
+}
+
+// 直近の判定で待合室に配分した許可数を保存する。待ち時間の見積もりに使う
+func (s *WaitingroomRepository) SavePermitUnit(ctx context.Context, domain string, unit int64, ttl time.Duration) error {
+	return s.redisC.SetEX(ctx, s.permitUnitKey(domain), unit, ttl).Err()
+}
+
+func (s *WaitingroomRepository) PermitClient(ctx context.Context, clientID, value string, ttl time.Duration) error {
+	return s.redisC.SetEX(ctx, s.keys.Permit(clientID), value, ttl).Err()
+}
+
+// 許可済みのクライアントかを返す
+func (s *WaitingroomRepository) IsPermitted(ctx context.Context, clientID string) (bool, error) {
+	return s.Exists(ctx, s.keys.Permit(clientID))
+}
+
+// 許可済みのクライアントの記録を返す。許可されていなければ空文字を返す
+func (s *WaitingroomRepository) GetPermit(ctx context.Context, clientID string) (string, error) {
+	v, err := s.redisC.Get(ctx, s.keys.Permit(clientID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
 }
 
 func (s *WaitingroomRepository) ExtendCurrentNumberTTL(ctx context.Context, domain string, ttl time.Duration) error {
@@ -113,7 +240,7 @@ func (s *WaitingroomRepository) ExtendCurrentNumberTTL(ctx context.Context, doma
 }
 
 func (s *WaitingroomRepository) GetEnableDomains(ctx context.Context, page, perPage int64) ([]string, error) {
-	v, err := s.redisC.ZRange(ctx, enableDomainKey, page, perPage).Result()
+	v, err := s.redisC.ZRange(ctx, s.keys.Global(enableDomainKey), page, perPage).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return []string{}, nil
@@ -124,27 +251,28 @@ func (s *WaitingroomRepository) GetEnableDomains(ctx context.Context, page, perP
 }
 
 func (s *WaitingroomRepository) GetEnableDomainsCount(ctx context.Context) (int64, error) {
-	return s.redisC.ZCount(ctx, enableDomainKey, "-inf", "+inf").Result()
+	return s.redisC.ZCount(ctx, s.keys.Global(enableDomainKey), "-inf", "+inf").Result()
 }
 
+// ルールの文字列が登録されているかを返す。ワイルドカードや正規表現は展開しない
 func (s *WaitingroomRepository) IsWhiteListDomain(ctx context.Context, domain string) (bool, error) {
-	v, _, err := s.redisC.ZScan(ctx, whiteListKey, 0, domain, 1).Result()
+	_, err := s.redisC.ZScore(ctx, s.keys.Global(whiteListKey), domain).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return false, nil
 		}
 		return false, err
 	}
-
-	return len(v) > 0, err
+	return true, nil
 }
 
 func (s *WaitingroomRepository) DisableDomain(ctx context.Context, domain string) error {
 	pipe := s.redisC.Pipeline()
-	pipe.ZRem(ctx, enableDomainKey, domain)
+	pipe.ZRem(ctx, s.keys.Global(enableDomainKey), domain)
 	pipe.Del(ctx, s.currentNumberKey(domain),
 		s.permittedNumberKey(domain),
-		s.lastNumberKey(domain))
+		s.lastNumberKey(domain),
+		s.permitUnitKey(domain))
 	_, err := pipe.Exec(ctx)
 	if err != nil && err != redis.Nil {
 		return err
@@ -152,7 +280,7 @@ func (s *WaitingroomRepository) DisableDomain(ctx context.Context, domain string
 	return nil
 }
 func (s *WaitingroomRepository) ExtendDomainsTTL(ctx context.Context, ttl time.Duration) error {
-	return s.redisC.Expire(ctx, enableDomainKey, ttl).Err()
+	return s.redisC.Expire(ctx, s.keys.Global(enableDomainKey), ttl).Err()
 }
 
 func (s *WaitingroomRepository) EnableDomain(ctx context.Context, domain string, ttl time.Duration) error {
@@ -160,11 +288,11 @@ func (s *WaitingroomRepository) EnableDomain(ctx context.Context, domain string,
 	// 値があれば上書きしない、なければ作る
 	pipe.SetNX(ctx, s.permittedNumberKey(domain), "0", 0)
 	pipe.Expire(ctx, s.permittedNumberKey(domain), ttl)
-	pipe.ZAdd(ctx, enableDomainKey, &redis.Z{
+	pipe.ZAdd(ctx, s.keys.Global(enableDomainKey), &redis.Z{
 		Score:  1,
 		Member: domain,
 	})
-	pipe.Expire(ctx, enableDomainKey, ttl*2)
+	pipe.Expire(ctx, s.keys.Global(enableDomainKey), ttl*2)
 	_, err := pipe.Exec(ctx)
 	return err
 }
@@ -180,15 +308,67 @@ func (s *WaitingroomRepository) Exists(ctx context.Context, key string) (bool, e
 	return v > 0, err
 }
 
+func (s *WaitingroomRepository) limitKey(domain string) string {
+	return s.keys.Queue(domain, keyLimit)
+}
+
+// 受付を終了している場合はErrSoldOutを返す
 func (s *WaitingroomRepository) IncrCurrentNumber(ctx context.Context, domain string, ttl time.Duration) (int64, error) {
-	pipe := s.redisC.Pipeline()
-	incr := pipe.Incr(ctx, s.currentNumberKey(domain))
-	pipe.Expire(ctx,
-		s.currentNumberKey(domain), ttl)
-	if _, err := pipe.Exec(ctx); err != nil {
+	v, err := incrCurrentNumberScript.Run(ctx, s.redisC,
+		[]string{s.currentNumberKey(domain), s.limitKey(domain)},
+		int64(ttl/time.Second),
+	).Int64()
+	if err != nil {
 		return 0, err
 	}
-	return incr.Val(), nil
+	if v < 0 {
+		return 0, ErrSoldOut
+	}
+	return v, nil
+}
+
+// 通し番号の発行上限、受付終了フラグ、発行済みの数を返す
+func (s *WaitingroomRepository) GetQueueLimit(ctx context.Context, domain string) (int64, bool, int64, error) {
+	v, err := s.redisC.HGetAll(ctx, s.limitKey(domain)).Result()
+	if err != nil {
+		return 0, false, 0, err
+	}
+
+	var max, issued int64
+	if v["max_serial_no"] != "" {
+		if max, err = strconv.ParseInt(v["max_serial_no"], 10, 64); err != nil {
+			return 0, false, 0, err
+		}
+	}
+	if v["issued"] != "" {
+		if issued, err = strconv.ParseInt(v["issued"], 10, 64); err != nil {
+			return 0, false, 0, err
+		}
+	}
+	return max, v["closed"] == "1", issued, nil
+}
+
+// 上限も受付終了も指定されなければ、発行済みの数ごと削除する
+func (s *WaitingroomRepository) SaveQueueLimit(ctx context.Context, domain string, max int64, closed bool) error {
+	if max == 0 && !closed {
+		return s.redisC.Del(ctx, s.limitKey(domain)).Err()
+	}
+
+	c := "0"
+	if closed {
+		c = "1"
+	}
+	cn, err := s.redisC.Get(ctx, s.currentNumberKey(domain)).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := s.redisC.Pipeline()
+	pipe.HSet(ctx, s.limitKey(domain), "max_serial_no", max, "closed", c)
+	// 途中から上限を設定した場合は、発行済みの通し番号から数える
+	pipe.HSetNX(ctx, s.limitKey(domain), "issued", cn)
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
 func (s *WaitingroomRepository) SaveCurrentNumber(ctx context.Context, domain string, num int64, ttl time.Duration) error {
@@ -200,20 +380,248 @@ func (s *WaitingroomRepository) SaveCurrentPermitNumber(ctx context.Context, dom
 }
 
 func (s *WaitingroomRepository) GetWhiteListDomains(ctx context.Context, page, perPage int64) ([]string, error) {
-	return s.redisC.ZRange(ctx, whiteListKey, page, perPage).Result()
+	return s.redisC.ZRange(ctx, s.keys.Global(whiteListKey), page, perPage).Result()
 }
 
 func (s *WaitingroomRepository) GetWhiteListDomainsCount(ctx context.Context) (int64, error) {
-	return s.redisC.ZCount(ctx, whiteListKey, "-inf", "+inf").Result()
+	return s.redisC.ZCount(ctx, s.keys.Global(whiteListKey), "-inf", "+inf").Result()
 }
 
-func (s *WaitingroomRepository) AddWhiteListDomain(ctx context.Context, domain string) error {
-	if err := s.redisC.ZAdd(ctx, whiteListKey, &redis.Z{Score: 1, Member: domain}).Err(); err != nil {
-		return err
+// ルールと、有効期限や登録理由などの付随する情報を同時に保存する
+func (s *WaitingroomRepository) AddWhiteListDomain(ctx context.Context, domain, meta string) error {
+	pipe := s.redisC.TxPipeline()
+	pipe.ZAdd(ctx, s.keys.Global(whiteListKey), &redis.Z{Score: 1, Member: domain})
+	pipe.Persist(ctx, s.keys.Global(whiteListKey))
+	if meta == "" {
+		pipe.HDel(ctx, s.keys.Global(whiteListMetaKey), domain)
+	} else {
+		pipe.HSet(ctx, s.keys.Global(whiteListMetaKey), domain, meta)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// 削除したルールがあればtrueを返す
+func (s *WaitingroomRepository) RemoveWhiteListDomain(ctx context.Context, domain string) (bool, error) {
+	pipe := s.redisC.TxPipeline()
+	n := pipe.ZRem(ctx, s.keys.Global(whiteListKey), domain)
+	pipe.HDel(ctx, s.keys.Global(whiteListMetaKey), domain)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
 	}
-	return s.redisC.Persist(ctx, whiteListKey).Err()
+	return n.Val() > 0, nil
 }
 
-func (s *WaitingroomRepository) RemoveWhiteListDomain(ctx context.Context, domain string) error {
-	return s.redisC.ZRem(ctx, whiteListKey, domain).Err()
+func (s *WaitingroomRepository) GetWhiteListMetas(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(whiteListMetaKey)).Result()
+}
+
+func (s *WaitingroomRepository) GetMaintenance(ctx context.Context, domain string) (string, error) {
+	v, err := s.redisC.HGet(ctx, s.keys.Global(maintenanceKey), domain).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+func (s *WaitingroomRepository) GetMaintenances(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(maintenanceKey)).Result()
+}
+
+func (s *WaitingroomRepository) SaveMaintenance(ctx context.Context, domain string, maintenance string) error {
+	return s.redisC.HSet(ctx, s.keys.Global(maintenanceKey), domain, maintenance).Err()
+}
+
+// 削除した場合にtrueを返す
+func (s *WaitingroomRepository) DeleteMaintenance(ctx context.Context, domain string) (bool, error) {
+	n, err := s.redisC.HDel(ctx, s.keys.Global(maintenanceKey), domain).Result()
+	return n > 0, err
+}
+
+func (s *WaitingroomRepository) GetRoute(ctx context.Context, domain string) (string, error) {
+	v, err := s.redisC.HGet(ctx, s.keys.Global(routeKey), domain).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+func (s *WaitingroomRepository) GetRoutes(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(routeKey)).Result()
+}
+
+func (s *WaitingroomRepository) SaveRoute(ctx context.Context, domain string, route string) error {
+	return s.redisC.HSet(ctx, s.keys.Global(routeKey), domain, route).Err()
+}
+
+func (s *WaitingroomRepository) DeleteRoute(ctx context.Context, domain string) error {
+	return s.redisC.HDel(ctx, s.keys.Global(routeKey), domain).Err()
+}
+
+func (s *WaitingroomRepository) GetGroup(ctx context.Context, name string) (string, error) {
+	v, err := s.redisC.HGet(ctx, s.keys.Global(groupKey), name).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+// ドメインが属するグループ名を返す。属していなければ空文字を返す
+func (s *WaitingroomRepository) GetGroupName(ctx context.Context, domain string) (string, error) {
+	v, err := s.redisC.HGet(ctx, s.keys.Global(groupDomainKey), domain).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+func (s *WaitingroomRepository) GetGroups(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(groupKey)).Result()
+}
+
+func (s *WaitingroomRepository) SaveGroup(ctx context.Context, name string, group string, domains []string) error {
+	args := []interface{}{name, group}
+	for _, d := range domains {
+		args = append(args, d)
+	}
+	return saveGroupScript.Run(ctx, s.redisC, []string{s.keys.Global(groupKey), s.keys.Global(groupDomainKey)}, args...).Err()
+}
+
+func (s *WaitingroomRepository) DeleteGroup(ctx context.Context, name string) error {
+	return saveGroupScript.Run(ctx, s.redisC, []string{s.keys.Global(groupKey), s.keys.Global(groupDomainKey)}, name, "").Err()
+}
+
+func (s *WaitingroomRepository) GetIPRules(ctx context.Context) (map[string]string, error) {
+	return s.redisC.HGetAll(ctx, s.keys.Global(ipRuleKey)).Result()
+}
+
+func (s *WaitingroomRepository) SaveIPRule(ctx context.Context, id, rule string) error {
+	return s.redisC.HSet(ctx, s.keys.Global(ipRuleKey), id, rule).Err()
+}
+
+func (s *WaitingroomRepository) DeleteIPRule(ctx context.Context, id string) error {
+	return s.redisC.HDel(ctx, s.keys.Global(ipRuleKey), id).Err()
+}
+
+func (s *WaitingroomRepository) throttleKey(kind, domain, subject string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", s.keys.Global(throttleKeyPrefix), kind, domain, subject)
+}
+
+// 待合室とクライアントごとに、窓の中で発行した回数を数える
+// 回数と窓が終わるまでの時間を返す
+func (s *WaitingroomRepository) IncrThrottle(ctx context.Context, kind, domain, subject string, window time.Duration) (int64, time.Duration, error) {
+	v, err := incrThrottleScript.Run(ctx, s.redisC,
+		[]string{s.throttleKey(kind, domain, subject)},
+		window.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return v[0], time.Duration(v[1]) * time.Millisecond, nil
+}
+
+// キャッシュを破棄するよう各インスタンスに通知する
+func (s *WaitingroomRepository) PublishInvalidation(ctx context.Context, message string) error {
+	return s.redisC.Publish(ctx, s.keys.Global(cacheChannel), message).Err()
+}
+
+func (s *WaitingroomRepository) SubscribeInvalidation(ctx context.Context) *redis.PubSub {
+	return s.redisC.Subscribe(ctx, s.keys.Global(cacheChannel))
+}
+
+// 判定でドメインごとに参照する値
+type DomainState struct {
+	Maintenance string
+	Route       string
+	GroupName   string
+}
+
+// メンテナンス、ルート、グループを1往復で取得する
+func (s *WaitingroomRepository) GetDomainState(ctx context.Context, domain string) (*DomainState, error) {
+	pipe := s.redisC.Pipeline()
+	maintenance := pipe.HGet(ctx, s.keys.Global(maintenanceKey), domain)
+	route := pipe.HGet(ctx, s.keys.Global(routeKey), domain)
+	group := pipe.HGet(ctx, s.keys.Global(groupDomainKey), domain)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	return &DomainState{
+		Maintenance: maintenance.Val(),
+		Route:       route.Val(),
+		GroupName:   group.Val(),
+	}, nil
+}
+
+// 判定で待合室ごとに参照する値
+type QueueState struct {
+	PermittedNumber int64 // 待合室が無効なら-1
+	CurrentNumber   int64
+	MaxSerialNumber int64
+	Closed          bool
+	IssuedNumber    int64
+	PermitUnit      int64 // 直近の判定で配分した許可数。全体の許可数を配分していなければ0
+}
+
+// 許可番号、通し番号と通し番号の発行上限を1往復で取得する
+func (s *WaitingroomRepository) GetQueueState(ctx context.Context, domain string) (*QueueState, error) {
+	pipe := s.redisC.Pipeline()
+	permitted := pipe.Get(ctx, s.permittedNumberKey(domain))
+	current := pipe.Get(ctx, s.currentNumberKey(domain))
+	limit := pipe.HGetAll(ctx, s.limitKey(domain))
+	unit := pipe.Get(ctx, s.permitUnitKey(domain))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ret := &QueueState{PermittedNumber: -1}
+	if permitted.Err() != redis.Nil {
+		v, err := permitted.Int64()
+		if err != nil {
+			return nil, err
+		}
+		ret.PermittedNumber = v
+	}
+	if current.Err() != redis.Nil {
+		v, err := current.Int64()
+		if err != nil {
+			return nil, err
+		}
+		ret.CurrentNumber = v
+	}
+
+	if unit.Err() != redis.Nil {
+		v, err := unit.Int64()
+		if err != nil {
+			return nil, err
+		}
+		ret.PermitUnit = v
+	}
+
+	var err error
+	v := limit.Val()
+	if v["max_serial_no"] != "" {
+		if ret.MaxSerialNumber, err = strconv.ParseInt(v["max_serial_no"], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if v["issued"] != "" {
+		if ret.IssuedNumber, err = strconv.ParseInt(v["issued"], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	ret.Closed = v["closed"] == "1"
+	return ret, nil
 }
@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	redis "github.com/go-redis/redis/v8"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -42,17 +43,17 @@ func (m *MockWaitingroomRepositoryer) EXPECT() *MockWaitingroomRepositoryerMockR
 }
 
 // AddWhiteListDomain mocks base method.
-func (m *MockWaitingroomRepositoryer) AddWhiteListDomain(arg0 context.Context, arg1 string) error {
+func (m *MockWaitingroomRepositoryer) AddWhiteListDomain(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddWhiteListDomain", arg0, arg1)
+	ret := m.ctrl.Call(m, "AddWhiteListDomain", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddWhiteListDomain indicates an expected call of AddWhiteListDomain.
-func (mr *MockWaitingroomRepositoryerMockRecorder) AddWhiteListDomain(arg0, arg1 any) *gomock.Call {
+func (mr *MockWaitingroomRepositoryerMockRecorder) AddWhiteListDomain(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWhiteListDomain", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).AddWhiteListDomain), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWhiteListDomain", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).AddWhiteListDomain), arg0, arg1, arg2)
 }
 
 // AppendPermitNumber mocks base method.
@@ -69,6 +70,63 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) AppendPermitNumber(arg0, arg1
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendPermitNumber", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).AppendPermitNumber), arg0, arg1, arg2, arg3)
 }
 
+// DeleteGroup mocks base method.
+func (m *MockWaitingroomRepositoryer) DeleteGroup(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGroup", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGroup indicates an expected call of DeleteGroup.
+func (mr *MockWaitingroomRepositoryerMockRecorder) DeleteGroup(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGroup", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).DeleteGroup), arg0, arg1)
+}
+
+// DeleteIPRule mocks base method.
+func (m *MockWaitingroomRepositoryer) DeleteIPRule(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIPRule", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIPRule indicates an expected call of DeleteIPRule.
+func (mr *MockWaitingroomRepositoryerMockRecorder) DeleteIPRule(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIPRule", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).DeleteIPRule), arg0, arg1)
+}
+
+// DeleteMaintenance mocks base method.
+func (m *MockWaitingroomRepositoryer) DeleteMaintenance(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMaintenance", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMaintenance indicates an expected call of DeleteMaintenance.
+func (mr *MockWaitingroomRepositoryerMockRecorder) DeleteMaintenance(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMaintenance", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).DeleteMaintenance), arg0, arg1)
+}
+
+// DeleteRoute mocks base method.
+func (m *MockWaitingroomRepositoryer) DeleteRoute(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRoute", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRoute indicates an expected call of DeleteRoute.
+func (mr *MockWaitingroomRepositoryerMockRecorder) DeleteRoute(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRoute", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).DeleteRoute), arg0, arg1)
+}
+
 // DisableDomain mocks base method.
 func (m *MockWaitingroomRepositoryer) DisableDomain(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -185,6 +243,21 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) GetCurrentPermitNumberTTL(arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentPermitNumberTTL", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetCurrentPermitNumberTTL), arg0, arg1)
 }
 
+// GetDomainState mocks base method.
+func (m *MockWaitingroomRepositoryer) GetDomainState(arg0 context.Context, arg1 string) (*DomainState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDomainState", arg0, arg1)
+	ret0, _ := ret[0].(*DomainState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDomainState indicates an expected call of GetDomainState.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetDomainState(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDomainState", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetDomainState), arg0, arg1)
+}
+
 // GetEnableDomains mocks base method.
 func (m *MockWaitingroomRepositoryer) GetEnableDomains(arg0 context.Context, arg1, arg2 int64) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -215,6 +288,66 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) GetEnableDomainsCount(arg0 an
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnableDomainsCount", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetEnableDomainsCount), arg0)
 }
 
+// GetGroup mocks base method.
+func (m *MockWaitingroomRepositoryer) GetGroup(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroup", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroup indicates an expected call of GetGroup.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetGroup(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroup", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetGroup), arg0, arg1)
+}
+
+// GetGroupName mocks base method.
+func (m *MockWaitingroomRepositoryer) GetGroupName(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupName", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupName indicates an expected call of GetGroupName.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetGroupName(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupName", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetGroupName), arg0, arg1)
+}
+
+// GetGroups mocks base method.
+func (m *MockWaitingroomRepositoryer) GetGroups(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroups", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroups indicates an expected call of GetGroups.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetGroups(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroups", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetGroups), arg0)
+}
+
+// GetIPRules mocks base method.
+func (m *MockWaitingroomRepositoryer) GetIPRules(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIPRules", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIPRules indicates an expected call of GetIPRules.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetIPRules(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIPRules", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetIPRules), arg0)
+}
+
 // GetLastNumber mocks base method.
 func (m *MockWaitingroomRepositoryer) GetLastNumber(arg0 context.Context, arg1 string) (int64, error) {
 	m.ctrl.T.Helper()
@@ -230,6 +363,113 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) GetLastNumber(arg0, arg1 any)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastNumber", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetLastNumber), arg0, arg1)
 }
 
+// GetMaintenance mocks base method.
+func (m *MockWaitingroomRepositoryer) GetMaintenance(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaintenance", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMaintenance indicates an expected call of GetMaintenance.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetMaintenance(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaintenance", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetMaintenance), arg0, arg1)
+}
+
+// GetMaintenances mocks base method.
+func (m *MockWaitingroomRepositoryer) GetMaintenances(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaintenances", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMaintenances indicates an expected call of GetMaintenances.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetMaintenances(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaintenances", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetMaintenances), arg0)
+}
+
+// GetPermit mocks base method.
+func (m *MockWaitingroomRepositoryer) GetPermit(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPermit", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPermit indicates an expected call of GetPermit.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetPermit(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPermit", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetPermit), arg0, arg1)
+}
+
+// GetQueueLimit mocks base method.
+func (m *MockWaitingroomRepositoryer) GetQueueLimit(arg0 context.Context, arg1 string) (int64, bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQueueLimit", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(int64)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetQueueLimit indicates an expected call of GetQueueLimit.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetQueueLimit(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueueLimit", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetQueueLimit), arg0, arg1)
+}
+
+// GetQueueState mocks base method.
+func (m *MockWaitingroomRepositoryer) GetQueueState(arg0 context.Context, arg1 string) (*QueueState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQueueState", arg0, arg1)
+	ret0, _ := ret[0].(*QueueState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQueueState indicates an expected call of GetQueueState.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetQueueState(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueueState", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetQueueState), arg0, arg1)
+}
+
+// GetRoute mocks base method.
+func (m *MockWaitingroomRepositoryer) GetRoute(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoute", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoute indicates an expected call of GetRoute.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetRoute(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoute", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetRoute), arg0, arg1)
+}
+
+// GetRoutes mocks base method.
+func (m *MockWaitingroomRepositoryer) GetRoutes(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoutes", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoutes indicates an expected call of GetRoutes.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetRoutes(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoutes", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetRoutes), arg0)
+}
+
 // GetWhiteListDomains mocks base method.
 func (m *MockWaitingroomRepositoryer) GetWhiteListDomains(arg0 context.Context, arg1, arg2 int64) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -260,6 +500,21 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) GetWhiteListDomainsCount(arg0
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWhiteListDomainsCount", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetWhiteListDomainsCount), arg0)
 }
 
+// GetWhiteListMetas mocks base method.
+func (m *MockWaitingroomRepositoryer) GetWhiteListMetas(arg0 context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWhiteListMetas", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWhiteListMetas indicates an expected call of GetWhiteListMetas.
+func (mr *MockWaitingroomRepositoryerMockRecorder) GetWhiteListMetas(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWhiteListMetas", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).GetWhiteListMetas), arg0)
+}
+
 // IncrCurrentNumber mocks base method.
 func (m *MockWaitingroomRepositoryer) IncrCurrentNumber(arg0 context.Context, arg1 string, arg2 time.Duration) (int64, error) {
 	m.ctrl.T.Helper()
@@ -275,6 +530,37 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) IncrCurrentNumber(arg0, arg1,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrCurrentNumber", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).IncrCurrentNumber), arg0, arg1, arg2)
 }
 
+// IncrThrottle mocks base method.
+func (m *MockWaitingroomRepositoryer) IncrThrottle(arg0 context.Context, arg1, arg2, arg3 string, arg4 time.Duration) (int64, time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrThrottle", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(time.Duration)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrThrottle indicates an expected call of IncrThrottle.
+func (mr *MockWaitingroomRepositoryerMockRecorder) IncrThrottle(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrThrottle", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).IncrThrottle), arg0, arg1, arg2, arg3, arg4)
+}
+
+// IsPermitted mocks base method.
+func (m *MockWaitingroomRepositoryer) IsPermitted(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsPermitted", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsPermitted indicates an expected call of IsPermitted.
+func (mr *MockWaitingroomRepositoryerMockRecorder) IsPermitted(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPermitted", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).IsPermitted), arg0, arg1)
+}
+
 // IsWhiteListDomain mocks base method.
 func (m *MockWaitingroomRepositoryer) IsWhiteListDomain(arg0 context.Context, arg1 string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -291,27 +577,42 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) IsWhiteListDomain(arg0, arg1
 }
 
 // PermitClient mocks base method.
-func (m *MockWaitingroomRepositoryer) PermitClient(arg0 context.Context, arg1 string, arg2 time.Duration) error {
+func (m *MockWaitingroomRepositoryer) PermitClient(arg0 context.Context, arg1, arg2 string, arg3 time.Duration) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PermitClient", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "PermitClient", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PermitClient indicates an expected call of PermitClient.
-func (mr *MockWaitingroomRepositoryerMockRecorder) PermitClient(arg0, arg1, arg2 any) *gomock.Call {
+func (mr *MockWaitingroomRepositoryerMockRecorder) PermitClient(arg0, arg1, arg2, arg3 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PermitClient", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).PermitClient), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PermitClient", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).PermitClient), arg0, arg1, arg2, arg3)
 }
 
-// RemoveWhiteListDomain mocks base method.
-func (m *MockWaitingroomRepositoryer) RemoveWhiteListDomain(arg0 context.Context, arg1 string) error {
+// PublishInvalidation mocks base method.
+func (m *MockWaitingroomRepositoryer) PublishInvalidation(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveWhiteListDomain", arg0, arg1)
+	ret := m.ctrl.Call(m, "PublishInvalidation", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// PublishInvalidation indicates an expected call of PublishInvalidation.
+func (mr *MockWaitingroomRepositoryerMockRecorder) PublishInvalidation(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishInvalidation", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).PublishInvalidation), arg0, arg1)
+}
+
+// RemoveWhiteListDomain mocks base method.
+func (m *MockWaitingroomRepositoryer) RemoveWhiteListDomain(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveWhiteListDomain", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // RemoveWhiteListDomain indicates an expected call of RemoveWhiteListDomain.
 func (mr *MockWaitingroomRepositoryerMockRecorder) RemoveWhiteListDomain(arg0, arg1 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
@@ -346,6 +647,34 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) SaveCurrentPermitNumber(arg0,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCurrentPermitNumber", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveCurrentPermitNumber), arg0, arg1, arg2, arg3)
 }
 
+// SaveGroup mocks base method.
+func (m *MockWaitingroomRepositoryer) SaveGroup(arg0 context.Context, arg1, arg2 string, arg3 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveGroup", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveGroup indicates an expected call of SaveGroup.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SaveGroup(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveGroup", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveGroup), arg0, arg1, arg2, arg3)
+}
+
+// SaveIPRule mocks base method.
+func (m *MockWaitingroomRepositoryer) SaveIPRule(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIPRule", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIPRule indicates an expected call of SaveIPRule.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SaveIPRule(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIPRule", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveIPRule), arg0, arg1, arg2)
+}
+
 // SaveLastNumber mocks base method.
 func (m *MockWaitingroomRepositoryer) SaveLastNumber(arg0 context.Context, arg1 string, arg2 int64, arg3 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -359,3 +688,73 @@ func (mr *MockWaitingroomRepositoryerMockRecorder) SaveLastNumber(arg0, arg1, ar
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveLastNumber", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveLastNumber), arg0, arg1, arg2, arg3)
 }
+
+// SaveMaintenance mocks base method.
+func (m *MockWaitingroomRepositoryer) SaveMaintenance(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveMaintenance", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveMaintenance indicates an expected call of SaveMaintenance.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SaveMaintenance(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMaintenance", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveMaintenance), arg0, arg1, arg2)
+}
+
+// SavePermitUnit mocks base method.
+func (m *MockWaitingroomRepositoryer) SavePermitUnit(arg0 context.Context, arg1 string, arg2 int64, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePermitUnit", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePermitUnit indicates an expected call of SavePermitUnit.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SavePermitUnit(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePermitUnit", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SavePermitUnit), arg0, arg1, arg2, arg3)
+}
+
+// SaveQueueLimit mocks base method.
+func (m *MockWaitingroomRepositoryer) SaveQueueLimit(arg0 context.Context, arg1 string, arg2 int64, arg3 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveQueueLimit", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveQueueLimit indicates an expected call of SaveQueueLimit.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SaveQueueLimit(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveQueueLimit", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveQueueLimit), arg0, arg1, arg2, arg3)
+}
+
+// SaveRoute mocks base method.
+func (m *MockWaitingroomRepositoryer) SaveRoute(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRoute", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRoute indicates an expected call of SaveRoute.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SaveRoute(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRoute", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SaveRoute), arg0, arg1, arg2)
+}
+
+// SubscribeInvalidation mocks base method.
+func (m *MockWaitingroomRepositoryer) SubscribeInvalidation(arg0 context.Context) *redis.PubSub {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeInvalidation", arg0)
+	ret0, _ := ret[0].(*redis.PubSub)
+	return ret0
+}
+
+// SubscribeInvalidation indicates an expected call of SubscribeInvalidation.
+func (mr *MockWaitingroomRepositoryerMockRecorder) SubscribeInvalidation(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeInvalidation", reflect.TypeOf((*MockWaitingroomRepositoryer)(nil).SubscribeInvalidation), arg0)
+}
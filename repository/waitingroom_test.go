@@ -34,12 +34,28 @@ func TestWaitingroomRepository(t *testing.T) {
 	})
 
 	t.Run("PermitClient", func(t *testing.T) {
-		err := repo.PermitClient(ctx, "test_client", time.Minute)
+		err := repo.PermitClient(ctx, "test_client", "record", time.Minute)
 		assert.NoError(t, err)
 
-		exists, err := repo.Exists(ctx, "test_client")
+		exists, err := repo.Exists(ctx, repository.Keys().Permit("test_client"))
 		assert.NoError(t, err)
 		assert.True(t, exists)
+
+		permitted, err := repo.IsPermitted(ctx, "test_client")
+		assert.NoError(t, err)
+		assert.True(t, permitted)
+
+		permitted, err = repo.IsPermitted(ctx, "unknown_client")
+		assert.NoError(t, err)
+		assert.False(t, permitted)
+
+		v, err := repo.GetPermit(ctx, "test_client")
+		assert.NoError(t, err)
+		assert.Equal(t, "record", v)
+
+		v, err = repo.GetPermit(ctx, "unknown_client")
+		assert.NoError(t, err)
+		assert.Equal(t, "", v)
 	})
 
 	t.Run("ExtendCurrentNumberTTL", func(t *testing.T) {
@@ -49,7 +65,7 @@ func TestWaitingroomRepository(t *testing.T) {
 		err = repo.ExtendCurrentNumberTTL(ctx, "test_domain", time.Hour)
 		assert.NoError(t, err)
 
-		ttl, err := redisClient.TTL(ctx, "test_domain"+"_current_no").Result()
+		ttl, err := redisClient.TTL(ctx, repository.Keys().Queue("test_domain", "current_no")).Result()
 		assert.NoError(t, err)
 		assert.Greater(t, ttl, time.Minute)
 	})
@@ -58,7 +74,7 @@ func TestWaitingroomRepository(t *testing.T) {
 		err := repo.EnableDomain(ctx, "test_domain", time.Minute)
 		assert.NoError(t, err)
 
-		domains, err := repo.GetEnableDomains(ctx, 0, 1)
+		domains, err := repo.GetEnableDomains(ctx, 0, -1)
 		assert.NoError(t, err)
 		assert.Contains(t, domains, "test_domain")
 	})
@@ -73,20 +89,161 @@ func TestWaitingroomRepository(t *testing.T) {
 	})
 
 	t.Run("AddWhiteListDomain", func(t *testing.T) {
-		err := repo.AddWhiteListDomain(ctx, "test_domain")
+		err := repo.AddWhiteListDomain(ctx, "test_domain", `{"reason":"r"}`)
 		assert.NoError(t, err)
 
 		isWhiteList, err := repo.IsWhiteListDomain(ctx, "test_domain")
 		assert.NoError(t, err)
 		assert.True(t, isWhiteList)
+
+		metas, err := repo.GetWhiteListMetas(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"reason":"r"}`, metas["test_domain"])
+	})
+
+	t.Run("IsWhiteListDomainGlob", func(t *testing.T) {
+		domain := "*." + testutils.TestRandomString(10) + ".example.com"
+		defer repo.RemoveWhiteListDomain(ctx, domain)
+		assert.NoError(t, repo.AddWhiteListDomain(ctx, domain, ""))
+
+		// ワイルドカードを含むルールも、文字列が一致するものだけを返す
+		isWhiteList, err := repo.IsWhiteListDomain(ctx, "a"+domain[1:])
+		assert.NoError(t, err)
+		assert.False(t, isWhiteList)
+
+		isWhiteList, err = repo.IsWhiteListDomain(ctx, domain)
+		assert.NoError(t, err)
+		assert.True(t, isWhiteList)
 	})
 
 	t.Run("RemoveWhiteListDomain", func(t *testing.T) {
-		err := repo.RemoveWhiteListDomain(ctx, "test_domain")
+		deleted, err := repo.RemoveWhiteListDomain(ctx, "test_domain")
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+
+		metas, err := repo.GetWhiteListMetas(ctx)
 		assert.NoError(t, err)
+		assert.NotContains(t, metas, "test_domain")
+
+		deleted, err = repo.RemoveWhiteListDomain(ctx, "test_domain")
+		assert.NoError(t, err)
+		assert.False(t, deleted)
 
 		isWhiteList, err := repo.IsWhiteListDomain(ctx, "test_domain")
 		assert.NoError(t, err)
 		assert.False(t, isWhiteList)
 	})
+	t.Run("QueueLimit", func(t *testing.T) {
+		domain := "test_limit_domain"
+		defer redisClient.Del(ctx, repository.Keys().Queue(domain, "current_no"), repository.Keys().Queue(domain, "limit"))
+
+		err := repo.SaveCurrentNumber(ctx, domain, 5, time.Minute)
+		assert.NoError(t, err)
+		// 発行済みの通し番号5から数えて、7番まで発行できる
+		err = repo.SaveQueueLimit(ctx, domain, 7, false)
+		assert.NoError(t, err)
+
+		num, err := repo.IncrCurrentNumber(ctx, domain, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), num)
+		num, err = repo.IncrCurrentNumber(ctx, domain, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), num)
+		_, err = repo.IncrCurrentNumber(ctx, domain, time.Minute)
+		assert.ErrorIs(t, err, repository.ErrSoldOut)
+
+		max, closed, issued, err := repo.GetQueueLimit(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), max)
+		assert.False(t, closed)
+		assert.Equal(t, int64(7), issued)
+
+		err = repo.SaveQueueLimit(ctx, domain, 0, true)
+		assert.NoError(t, err)
+		_, err = repo.IncrCurrentNumber(ctx, domain, time.Minute)
+		assert.ErrorIs(t, err, repository.ErrSoldOut)
+
+		err = repo.SaveQueueLimit(ctx, domain, 0, false)
+		assert.NoError(t, err)
+		num, err = repo.IncrCurrentNumber(ctx, domain, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), num)
+	})
+	t.Run("Group", func(t *testing.T) {
+		defer repo.DeleteGroup(ctx, "shop")
+
+		err := repo.SaveGroup(ctx, "shop", `{"domains":["a.example.com","b.example.com"]}`, []string{"a.example.com", "b.example.com"})
+		assert.NoError(t, err)
+		name, err := repo.GetGroupName(ctx, "b.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "shop", name)
+
+		err = repo.SaveGroup(ctx, "shop", `{"domains":["a.example.com"]}`, []string{"a.example.com"})
+		assert.NoError(t, err)
+		name, err = repo.GetGroupName(ctx, "b.example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, name)
+
+		err = repo.DeleteGroup(ctx, "shop")
+		assert.NoError(t, err)
+		name, err = repo.GetGroupName(ctx, "a.example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, name)
+		group, err := repo.GetGroup(ctx, "shop")
+		assert.NoError(t, err)
+		assert.Empty(t, group)
+	})
+
+	t.Run("DomainState", func(t *testing.T) {
+		domain := testutils.TestRandomString(10) + ".example.com"
+		defer repo.DeleteMaintenance(ctx, domain)
+		defer repo.DeleteRoute(ctx, domain)
+
+		st, err := repo.GetDomainState(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, &repository.DomainState{}, st)
+
+		assert.NoError(t, repo.SaveMaintenance(ctx, domain, `{"message":"m"}`))
+		assert.NoError(t, repo.SaveRoute(ctx, domain, `{"rules":[]}`))
+		st, err = repo.GetDomainState(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, &repository.DomainState{Maintenance: `{"message":"m"}`, Route: `{"rules":[]}`}, st)
+	})
+
+	t.Run("QueueState", func(t *testing.T) {
+		domain := testutils.TestRandomString(10) + ".example.com"
+		defer repo.DisableDomain(ctx, domain)
+		defer repo.SaveQueueLimit(ctx, domain, 0, false)
+
+		st, err := repo.GetQueueState(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, &repository.QueueState{PermittedNumber: -1}, st)
+
+		assert.NoError(t, repo.SaveCurrentPermitNumber(ctx, domain, 3, time.Minute))
+		assert.NoError(t, repo.SaveQueueLimit(ctx, domain, 10, true))
+		assert.NoError(t, redisClient.Set(ctx, repository.Keys().Queue(domain, "current_no"), 7, time.Minute).Err())
+		st, err = repo.GetQueueState(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, &repository.QueueState{PermittedNumber: 3, CurrentNumber: 7, MaxSerialNumber: 10, Closed: true}, st)
+
+		assert.NoError(t, repo.SavePermitUnit(ctx, domain, 50, time.Minute))
+		st, err = repo.GetQueueState(ctx, domain)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(50), st.PermitUnit)
+	})
+
+	t.Run("IncrThrottle", func(t *testing.T) {
+		subject := testutils.TestRandomString(10)
+		for i := int64(1); i <= 3; i++ {
+			n, ttl, err := repo.IncrThrottle(ctx, "id", "test_domain", subject, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, i, n)
+			assert.Greater(t, ttl, time.Duration(0))
+			assert.LessOrEqual(t, ttl, time.Minute)
+		}
+
+		n, _, err := repo.IncrThrottle(ctx, "serial", "test_domain", subject, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
 }